@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// viewer — пользователь, для которого проверяется видимость категорий и документов.
+type viewer struct {
+	ID       int64
+	Username string // без @, в нижнем регистре
+	Role     Role
+	Tags     map[string]bool // теги в нижнем регистре
+}
+
+// viewerOf собирает viewer для автора апдейта: роль из «Админы», теги из «Пользователи».
+func viewerOf(c tele.Context, app *App) viewer {
+	v := viewer{Role: senderRole(c, app)}
+	if s := c.Sender(); s != nil {
+		v.ID = s.ID
+		v.Username = strings.ToLower(s.Username)
+		if app.GetUserTags != nil {
+			v.Tags = app.GetUserTags(s.ID)
+		}
+	}
+	return v
+}
+
+// accessAllows проверяет правило видимости из колонки «Доступ» (листы «Категории», «Документы»).
+// Пустое правило — видно всем. Иначе — список через запятую или пробел, достаточно одного совпадения:
+//   - роль: owner, editor, moderator, notifier (и русские синонимы); admins/админы — любая роль;
+//   - @username;
+//   - числовой ID пользователя;
+//   - #тег — тег пользователя из колонки «Теги» листа «Пользователи».
+//
+// Админ с ролью owner видит всё.
+func accessAllows(rule string, v viewer) bool {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || v.Role == roleOwner {
+		return true
+	}
+	for _, item := range splitList(rule) {
+		low := strings.ToLower(item)
+		switch {
+		case strings.HasPrefix(low, "@"):
+			if v.Username != "" && strings.TrimPrefix(low, "@") == v.Username {
+				return true
+			}
+		case strings.HasPrefix(low, "#"):
+			if v.Tags[strings.TrimPrefix(low, "#")] {
+				return true
+			}
+		case low == "admins" || low == "админы":
+			if v.Role != "" {
+				return true
+			}
+		default:
+			if id, err := strconv.ParseInt(low, 10, 64); err == nil {
+				if id == v.ID {
+					return true
+				}
+				continue
+			}
+			if r, ok := roleAliases[low]; ok && r != "" && v.Role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList разбивает значение ячейки по запятым, точкам с запятой и пробелам.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// listedCategories оставляет категории, которые показываются v в списке: доступные и те,
+// доступ к которым можно запросить (у них выставлен Locked). Остальные скрыты.
+func listedCategories(cats []Category, v viewer) []Category {
+	out := cats[:0:0]
+	for _, cat := range cats {
+		switch {
+		case accessAllows(cat.Доступ, v):
+			out = append(out, cat)
+		case requestGroup(cat.Доступ) != "":
+			cat.Locked = true
+			out = append(out, cat)
+		}
+	}
+	return out
+}
+
+// findCategory ищет категорию по ID в кэше.
+func findCategory(app *App, categoryID string) (Category, bool) {
+	cats, err := app.GetCategories()
+	if err != nil {
+		return Category{}, false
+	}
+	for _, cat := range cats {
+		if cat.ID == categoryID {
+			return cat, true
+		}
+	}
+	return Category{}, false
+}
+
+// categoryVisible — найдена ли категория categoryID и доступна ли она v.
+func categoryVisible(app *App, categoryID string, v viewer) bool {
+	cat, ok := findCategory(app, categoryID)
+	return ok && accessAllows(cat.Доступ, v)
+}
+
+// requestGroup возвращает первую группу (#тег) из правила «Доступ» — её можно запросить
+// через «Запросить доступ». Пусто — доступ по запросу не выдаётся.
+func requestGroup(rule string) string {
+	for _, item := range splitList(rule) {
+		if strings.HasPrefix(item, "#") && len(item) > 1 {
+			return strings.ToLower(item[1:])
+		}
+	}
+	return ""
+}
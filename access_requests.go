@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const accessDefaultDays = 30 // срок доступа для кнопки «На 30 дней»
+
+// accessDeniedMarkup — кнопки под «Категория недоступна»: запрос доступа (если у категории есть #группа) и « Назад.
+func accessDeniedMarkup(t tr, cat Category, found bool) *tele.ReplyMarkup {
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	if found && requestGroup(cat.Доступ) != "" {
+		rows = append(rows, m.Row(m.Data(t.T(keyКнопкаЗапроситьДоступ), "acc_req", cat.ID)))
+	}
+	rows = append(rows, m.Row(m.Data(t.T(keyКнопкаНазад), "back_cats")))
+	m.Inline(rows...)
+	return m
+}
+
+// accessAdminMarkup — кнопки решения под уведомлением админам о запросе доступа.
+func accessAdminMarkup(t tr, id string) *tele.ReplyMarkup {
+	m := &tele.ReplyMarkup{}
+	m.Inline(
+		m.Row(m.Data(t.T(keyКнопкаБессрочно), "acc", id, "ok"), m.Data(t.T(keyКнопкаНаДней, "{дней}", strconv.Itoa(accessDefaultDays)), "acc", id, "ok_days")),
+		m.Row(m.Data(t.T(keyКнопкаОтклонить), "acc", id, "rej")),
+	)
+	return m
+}
+
+// onAccessRequest — кнопка «Запросить доступ» у недоступной категории (callback acc_req|categoryID).
+// Записывает заявку в «Доступы» и уведомляет админов.
+func onAccessRequest(c tele.Context, app *App, categoryID string) error {
+	if c.Sender() == nil {
+		return c.Respond(&tele.CallbackResponse{})
+	}
+	t := trFor(c, app)
+	cat, ok := findCategory(app, categoryID)
+	group := requestGroup(cat.Доступ)
+	if !ok || group == "" {
+		return c.Respond(&tele.CallbackResponse{Text: t.T(keyДоступНеПоЗапросу)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
+	defer cancel()
+	list, err := app.Sheets.GetAccessGrants(ctx)
+	if err != nil {
+		logFor(c, app).Error("GetAccessGrants acc_req", "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: sheetsErrText(t, err, keyОшибкаЗапросаДоступа)})
+	}
+	for _, g := range list {
+		if g.UserID == c.Sender().ID && g.Группа == group && g.Статус == accessЗапрошен {
+			return c.Respond(&tele.CallbackResponse{Text: t.T(keyЗапросУжеЕсть)})
+		}
+	}
+	username := c.Sender().Username
+	if username == "" {
+		username = c.Sender().FirstName
+	}
+	id, err := app.Sheets.AppendAccessRequest(ctx, c.Sender().ID, username, group)
+	if err != nil {
+		logFor(c, app).Error("AppendAccessRequest", "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: sheetsErrText(t, err, keyОшибкаЗапросаДоступа)})
+	}
+	_ = c.Respond(&tele.CallbackResponse{})
+
+	display := username
+	if c.Sender().Username != "" {
+		display = "@" + c.Sender().Username
+	}
+	userID := strconv.FormatInt(c.Sender().ID, 10)
+	go notifyAdmins(c.Bot(), app, notifyAccess, func(at tr) (string, []interface{}) {
+		msg := at.T(keyУведомлениеЗапрос, "{от}", display, "{id}", userID, "{категория}", cat.Name, "{группа}", group)
+		return msg, []interface{}{accessAdminMarkup(at, id)}
+	})
+	return c.Send(t.T(keyЗапросОтправлен))
+}
+
+// onAccessDecision — решение админа по запросу доступа (callback acc|ID|ok|ok_days|rej).
+// Права проверяет commandGuard по callbackTable.
+func onAccessDecision(c tele.Context, app *App, payload string) error {
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) != 2 {
+		return c.Respond(&tele.CallbackResponse{})
+	}
+	status := accessАктивен
+	var expires time.Time
+	switch parts[1] {
+	case "ok":
+	case "ok_days":
+		expires = time.Now().AddDate(0, 0, accessDefaultDays)
+	case "rej":
+		status = accessОтклонён
+	default:
+		return c.Respond(&tele.CallbackResponse{})
+	}
+	by := ""
+	if c.Sender() != nil && c.Sender().Username != "" {
+		by = "@" + c.Sender().Username
+	}
+	t := trFor(c, app)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+	g, err := app.Sheets.SetAccessStatus(ctx, parts[0], status, expires, by)
+	if errors.Is(err, ErrAccessDecided) {
+		return c.Respond(&tele.CallbackResponse{Text: t.T(keyЗапросРассмотрен, "{статус}", statusLabel(t, g.Статус))})
+	}
+	if err != nil {
+		logFor(c, app).Error("SetAccessStatus", "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: sheetsErrText(t, err, keyОшибкаРешения)})
+	}
+	if app.OnGrantsChanged != nil {
+		app.OnGrantsChanged()
+	}
+	_ = c.Respond(&tele.CallbackResponse{Text: statusLabel(t, status)})
+
+	result := statusLabel(t, status)
+	if !expires.IsZero() {
+		result += t.T(keyСрокДо, "{дата}", expires.Format("02.01.2006"))
+	}
+	if by != "" {
+		result += " (" + by + ")"
+	}
+	if msg := c.Message(); msg != nil {
+		_, _ = c.Bot().Edit(msg, msg.Text+"\n\n"+t.T(keyРешение, "{решение}", result))
+	}
+
+	ut := trUser(app, g.UserID)
+	userMsg := ut.T(keyДоступОтклонён, "{группа}", g.Группа)
+	if status == accessАктивен {
+		until := ""
+		if !expires.IsZero() {
+			until = ut.T(keyСрокДо, "{дата}", expires.Format("02.01.2006"))
+		}
+		userMsg = ut.T(keyДоступОткрыт, "{группа}", g.Группа, "{срок}", until, "{кнопка}", ut.T(keyКнопкаДокументы))
+	}
+	if _, err := c.Bot().Send(&tele.Chat{ID: g.UserID}, userMsg); err != nil {
+		logFor(c, app).Error("notify access decision", "err", err, "chat_id", g.UserID)
+	}
+	return nil
+}
+
+// onRevoke — /revoke <@username|ID> <группа>: отзыв доступа.
+func onRevoke(c tele.Context, app *App) error {
+	t := trFor(c, app)
+	args := strings.Fields(strings.TrimSpace(strings.TrimPrefix(c.Text(), "/revoke")))
+	if len(args) != 2 {
+		return c.Send(t.T(keyОтзывИспользование))
+	}
+	var userID int64
+	username := ""
+	if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+		userID = id
+	} else {
+		username = args[0]
+	}
+	by := ""
+	if c.Sender() != nil && c.Sender().Username != "" {
+		by = "@" + c.Sender().Username
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+	revoked, err := app.Sheets.RevokeAccess(ctx, userID, username, args[1], by)
+	if err != nil {
+		logFor(c, app).Error("RevokeAccess", "err", err)
+	}
+	if len(revoked) == 0 {
+		if err != nil {
+			return c.Send(sheetsErrText(t, err, keyОшибкаОтзыва))
+		}
+		return c.Send(t.T(keyДоступНеНайден))
+	}
+	if app.OnGrantsChanged != nil {
+		app.OnGrantsChanged()
+	}
+	for _, g := range revoked {
+		if _, err := c.Bot().Send(&tele.Chat{ID: g.UserID}, trUser(app, g.UserID).T(keyДоступОтозван, "{группа}", g.Группа)); err != nil {
+			logFor(c, app).Error("notify revoke", "err", err, "chat_id", g.UserID)
+		}
+	}
+	return c.Send(t.T(keyОтозвано, "{число}", strconv.Itoa(len(revoked))))
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Состояния FSM диалогов управления категориями и документами. Все начинаются с "adm_".
+const (
+	stateAdmAddCatName   = "adm_addcat_name"
+	stateAdmAddCatAccess = "adm_addcat_access"
+	stateAdmPickCat      = "adm_pick_cat"
+	stateAdmAddDocName   = "adm_adddoc_name"
+	stateAdmAddDocDesc   = "adm_adddoc_desc"
+	stateAdmAddDocSrc    = "adm_adddoc_src"
+	stateAdmPickDoc      = "adm_pick_doc"
+	stateAdmPickField    = "adm_pick_field"
+	stateAdmEditValue    = "adm_edit_value"
+	stateAdmDelConfirm   = "adm_del_confirm"
+	stateAdmMoveTarget   = "adm_move_target"
+)
+
+// Операции диалога (ключ "op" в данных FSM).
+const (
+	admOpAddDoc  = "adddoc"
+	admOpEditDoc = "editdoc"
+	admOpDelDoc  = "deldoc"
+	admOpMoveDoc = "movedoc"
+	admOpNotify  = "notifydoc"
+)
+
+// admFields — редактируемые поля документа: код для callback_data -> подпись и колонка.
+// Подпись на кнопке — текст «Поле_<код>» на языке админа, иначе Label.
+var admFields = []struct {
+	Code, Label, Col string
+}{
+	{"name", "Название", docColНазвание},
+	{"desc", "Описание", docColОписание},
+	{"link", "Ссылка", docColСсылка},
+	{"file", "Файл", docColFileID},
+	{"access", "Доступ", docColДоступ},
+	{"delivery", "Доставка", docColДоставка},
+}
+
+// admCancelHint — подсказка об отмене в конце вопроса диалога.
+func admCancelHint(t tr) string { return "\n\n" + t.T(keyПодсказкаОтмена) }
+
+// canManageDocs — может ли автор апдейта управлять документами (права команды /adddoc).
+func canManageDocs(c tele.Context, app *App) bool {
+	spec, _ := findSpec(commandTable, "adddoc")
+	return spec.canUse(senderRole(c, app))
+}
+
+// onAdmCommand — точка входа /addcat, /adddoc, /editdoc, /deldoc, /movedoc, /notifydoc.
+func onAdmCommand(c tele.Context, app *App, op string) error {
+	t := trFor(c, app)
+	uid := c.Sender().ID
+	app.ResetState(uid)
+	if op == "addcat" {
+		app.SetState(uid, stateAdmAddCatName)
+		return c.Send(t.T(keyАдмНазваниеКатегории) + admCancelHint(t))
+	}
+	app.SetData(uid, "op", op)
+	return admSendCategoryPicker(c, app, "pc", "", t.T(keyАдмВыберитеКатегорию))
+}
+
+// admSendCategoryPicker отправляет список всех категорий кнопками adm|action|catID (без учёта «Доступ»).
+func admSendCategoryPicker(c tele.Context, app *App, action, excludeID, prompt string) error {
+	t := trFor(c, app)
+	cats, err := app.GetCategories()
+	if err != nil {
+		logFor(c, app).Error("GetCategories admin", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаКатегорий))
+	}
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, cat := range cats {
+		if cat.ID == excludeID {
+			continue
+		}
+		rows = append(rows, m.Row(m.Data(cat.Name, "adm", action, cat.ID)))
+	}
+	if len(rows) == 0 {
+		app.ResetState(c.Sender().ID)
+		return c.Send(t.T(keyАдмКатегорийНет))
+	}
+	rows = append(rows, m.Row(m.Data(t.T(keyКнопкаОтмена), "adm", "x", "")))
+	m.Inline(rows...)
+	if action == "mv" {
+		app.SetState(c.Sender().ID, stateAdmMoveTarget)
+	} else {
+		app.SetState(c.Sender().ID, stateAdmPickCat)
+	}
+	return c.Send(prompt, m)
+}
+
+// onAdmCallback обрабатывает кнопки диалогов (callback adm|action|arg). Права проверяет commandGuard.
+func onAdmCallback(c tele.Context, app *App, payload string) error {
+	t := trFor(c, app)
+	_ = c.Respond(&tele.CallbackResponse{})
+	uid := c.Sender().ID
+	action, arg, _ := strings.Cut(payload, "|")
+	state := app.GetState(uid)
+	if c.Message() != nil {
+		_, _ = c.Bot().EditReplyMarkup(c.Message(), nil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+
+	switch {
+	case action == "x":
+		app.ResetState(uid)
+		return c.Send(t.T(keyОтменено))
+
+	case action == "pc" && state == stateAdmPickCat:
+		app.SetData(uid, "cat", arg)
+		if app.GetData(uid, "op") == admOpAddDoc {
+			app.SetState(uid, stateAdmAddDocName)
+			prompt := t.T(keyАдмНазваниеДокумента)
+			if app.GetData(uid, "file") != "" {
+				prompt += "\n" + t.T(keyАдмИмяФайла)
+			}
+			return c.Send(prompt + admCancelHint(t))
+		}
+		return admSendDocPicker(ctx, c, app, arg)
+
+	case action == "pd" && state == stateAdmPickDoc:
+		d, err := app.Sheets.GetDocument(ctx, arg)
+		if err != nil {
+			app.ResetState(uid)
+			return c.Send(t.T(keyДокументНеНайден))
+		}
+		app.SetData(uid, "doc", d.ID)
+		switch app.GetData(uid, "op") {
+		case admOpEditDoc:
+			m := &tele.ReplyMarkup{}
+			var rows []tele.Row
+			for _, f := range admFields {
+				label := t.Custom(keyPrefixПоле + f.Code)
+				if label == "" {
+					label = f.Label
+				}
+				rows = append(rows, m.Row(m.Data(label, "adm", "pf", f.Code)))
+			}
+			rows = append(rows, m.Row(m.Data(t.T(keyКнопкаОтмена), "adm", "x", "")))
+			m.Inline(rows...)
+			app.SetState(uid, stateAdmPickField)
+			return c.Send(t.T(keyАдмЧтоИзменить, "{название}", d.Название), m)
+		case admOpDelDoc:
+			m := &tele.ReplyMarkup{}
+			m.Inline(m.Row(m.Data(t.T(keyКнопкаУдалить), "adm", "del", d.ID), m.Data(t.T(keyКнопкаОтмена), "adm", "x", "")))
+			app.SetState(uid, stateAdmDelConfirm)
+			return c.Send(t.T(keyАдмУдалить, "{название}", d.Название), m)
+		case admOpMoveDoc:
+			return admSendCategoryPicker(c, app, "mv", d.IDКатегории, t.T(keyАдмКудаПеренести, "{название}", d.Название))
+		case admOpNotify:
+			app.ResetState(uid)
+			return admNotifyDownloaders(ctx, c, app, d)
+		}
+		app.ResetState(uid)
+		return nil
+
+	case action == "pf" && state == stateAdmPickField:
+		app.SetData(uid, "field", arg)
+		app.SetState(uid, stateAdmEditValue)
+		switch arg {
+		case "file":
+			return c.Send(t.T(keyАдмЗаменаФайла) + admCancelHint(t))
+		case "access":
+			return c.Send(t.T(keyАдмПравилоДоступа) + admCancelHint(t))
+		case "desc":
+			return c.Send(t.T(keyАдмНовоеОписание) + admCancelHint(t))
+		case "delivery":
+			return c.Send(t.T(keyАдмДоставка) + admCancelHint(t))
+		}
+		return c.Send(t.T(keyАдмНовоеЗначение) + admCancelHint(t))
+
+	case action == "del" && state == stateAdmDelConfirm:
+		app.ResetState(uid)
+		d, err := app.Sheets.GetDocument(ctx, arg)
+		if err != nil {
+			return c.Send(t.T(keyДокументНеНайден))
+		}
+		if err := app.Sheets.DeleteRow(ctx, sheetДокументы, d.SheetRow); err != nil {
+			logFor(c, app).Error("DeleteRow Документы", "err", err)
+			return c.Send(sheetsErrText(t, err, keyОшибкаУдаления))
+		}
+		return c.Send(t.T(keyДокументУдалён, "{название}", d.Название))
+
+	case action == "mv" && state == stateAdmMoveTarget:
+		docID := app.GetData(uid, "doc")
+		app.ResetState(uid)
+		d, err := app.Sheets.GetDocument(ctx, docID)
+		if err != nil {
+			return c.Send(t.T(keyДокументНеНайден))
+		}
+		cat, ok := findCategory(app, arg)
+		if !ok {
+			return c.Send(t.T(keyКатегорияНеНайдена))
+		}
+		if err := app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, docColКатегория, cat.ID); err != nil {
+			logFor(c, app).Error("UpdateDocumentCell move", "err", err)
+			return c.Send(sheetsErrText(t, err, keyОшибкаПереноса))
+		}
+		return c.Send(t.T(keyДокументПеренесён, "{название}", d.Название, "{категория}", cat.Name))
+
+	case action == "ntf":
+		d, err := app.Sheets.GetDocument(ctx, arg)
+		if err != nil {
+			return c.Send(t.T(keyДокументНеНайден))
+		}
+		return admNotifyDownloaders(ctx, c, app, d)
+	}
+	return nil
+}
+
+// admSendDocPicker отправляет документы категории кнопками adm|pd|docID.
+func admSendDocPicker(ctx context.Context, c tele.Context, app *App, categoryID string) error {
+	t := trFor(c, app)
+	uid := c.Sender().ID
+	docs, err := app.Sheets.GetDocumentsByCategory(ctx, categoryID)
+	if err != nil {
+		logFor(c, app).Error("GetDocumentsByCategory admin", "err", err)
+		app.ResetState(uid)
+		return c.Send(sheetsErrText(t, err, keyОшибкаДокументов))
+	}
+	if len(docs) == 0 {
+		app.ResetState(uid)
+		return c.Send(t.T(keyАдмДокументовНет))
+	}
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, d := range docs {
+		rows = append(rows, m.Row(m.Data(d.Название, "adm", "pd", d.ID)))
+	}
+	rows = append(rows, m.Row(m.Data(t.T(keyКнопкаОтмена), "adm", "x", "")))
+	m.Inline(rows...)
+	app.SetState(uid, stateAdmPickDoc)
+	return c.Send(t.T(keyАдмВыберитеДокумент), m)
+}
+
+// onAdmText обрабатывает текстовые шаги диалогов (состояния adm_*).
+func onAdmText(c tele.Context, app *App, state, txt string) error {
+	t := trFor(c, app)
+	uid := c.Sender().ID
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+	dash := txt == "-"
+
+	switch state {
+	case stateAdmAddCatName:
+		if txt == "" {
+			return nil
+		}
+		app.SetData(uid, "name", txt)
+		app.SetState(uid, stateAdmAddCatAccess)
+		return c.Send(t.T(keyАдмДоступКатегории) + admCancelHint(t))
+
+	case stateAdmAddCatAccess:
+		access := txt
+		if dash {
+			access = ""
+		}
+		name := app.GetData(uid, "name")
+		app.ResetState(uid)
+		cat, err := app.Sheets.AppendCategory(ctx, name, access)
+		if err != nil {
+			logFor(c, app).Error("AppendCategory", "err", err)
+			return c.Send(sheetsErrText(t, err, keyОшибкаДобавленияКатегории))
+		}
+		if app.OnReload != nil {
+			app.OnReload()
+		}
+		return c.Send(t.T(keyКатегорияДобавлена, "{название}", cat.Name))
+
+	case stateAdmAddDocName:
+		name := txt
+		if dash {
+			name = strings.TrimSuffix(app.GetData(uid, "filename"), filepath.Ext(app.GetData(uid, "filename")))
+		}
+		if name == "" {
+			return c.Send(t.T(keyАдмНазваниеДокумента) + admCancelHint(t))
+		}
+		app.SetData(uid, "name", name)
+		app.SetState(uid, stateAdmAddDocDesc)
+		return c.Send(t.T(keyАдмОписание) + admCancelHint(t))
+
+	case stateAdmAddDocDesc:
+		desc := txt
+		if dash {
+			desc = ""
+		}
+		app.SetData(uid, "desc", desc)
+		if app.GetData(uid, "file") != "" {
+			return admSaveNewDoc(ctx, c, app, "", app.GetData(uid, "file"))
+		}
+		app.SetState(uid, stateAdmAddDocSrc)
+		return c.Send(t.T(keyАдмИсточник) + admCancelHint(t))
+
+	case stateAdmAddDocSrc:
+		if !isHTTPURL(txt) {
+			return c.Send(t.T(keyАдмНужнаСсылкаИлиФайл) + admCancelHint(t))
+		}
+		return admSaveNewDoc(ctx, c, app, txt, "")
+
+	case stateAdmEditValue:
+		field := app.GetData(uid, "field")
+		if field == "file" {
+			return c.Send(t.T(keyАдмЗагрузитеФайл) + admCancelHint(t))
+		}
+		value := txt
+		if dash && (field == "desc" || field == "access" || field == "delivery") {
+			value = ""
+		}
+		if field == "delivery" && value != "" {
+			if value = parseDeliveryMode(value); value == "" {
+				return c.Send(t.T(keyАдмДоставкаОшибка) + admCancelHint(t))
+			}
+		}
+		if field == "link" && !isHTTPURL(value) {
+			return c.Send(t.T(keyАдмНужнаСсылка) + admCancelHint(t))
+		}
+		if value == "" && field == "name" {
+			return c.Send(t.T(keyАдмПустоеНазвание) + admCancelHint(t))
+		}
+		docID := app.GetData(uid, "doc")
+		app.ResetState(uid)
+		return admUpdateDoc(ctx, c, app, docID, field, value)
+	}
+	return nil
+}
+
+// onAdmDocument — файл, загруженный админом: шаг «ссылка или файл» диалога /adddoc, замена файла в /editdoc
+// или (вне диалога) начало /adddoc с этим файлом.
+func onAdmDocument(c tele.Context, app *App) error {
+	if c.Sender() == nil || c.Message() == nil || c.Message().Document == nil || !canManageDocs(c, app) {
+		return nil
+	}
+	uid := c.Sender().ID
+	doc := c.Message().Document
+	t := trFor(c, app)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+
+	switch app.GetState(uid) {
+	case stateAdmAddDocSrc:
+		return admSaveNewDoc(ctx, c, app, "", doc.FileID)
+	case stateAdmEditValue:
+		if app.GetData(uid, "field") != "file" {
+			return nil
+		}
+		docID := app.GetData(uid, "doc")
+		app.ResetState(uid)
+		return admUpdateDoc(ctx, c, app, docID, "file", doc.FileID)
+	case "":
+		app.SetData(uid, "op", admOpAddDoc)
+		app.SetData(uid, "file", doc.FileID)
+		app.SetData(uid, "filename", doc.FileName)
+		return admSendCategoryPicker(c, app, "pc", "", t.T(keyАдмДобавитьФайл, "{файл}", doc.FileName))
+	}
+	return nil
+}
+
+// admSaveNewDoc записывает новый документ из данных диалога: со ссылкой или с File_ID загруженного файла.
+func admSaveNewDoc(ctx context.Context, c tele.Context, app *App, link, fileID string) error {
+	t := trFor(c, app)
+	uid := c.Sender().ID
+	d := Document{
+		IDКатегории: app.GetData(uid, "cat"),
+		Название:    app.GetData(uid, "name"),
+		Описание:    app.GetData(uid, "desc"),
+		Ссылка:      link,
+		FileID:      fileID,
+	}
+	app.ResetState(uid)
+	if _, err := app.Sheets.AppendDocument(ctx, d); err != nil {
+		logFor(c, app).Error("AppendDocument", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаДобавленияДокумента))
+	}
+	return c.Send(t.T(keyДокументДобавлен, "{название}", d.Название))
+}
+
+// admUpdateDoc меняет поле документа. При смене ссылки сбрасывается сохранённый File_ID (архив устарел),
+// при загрузке файла очищается ссылка — документ отдаётся загруженным файлом. Смена ссылки или файла
+// повышает версию документа (только после успешной записи нового значения) и предлагает уведомить
+// тех, кто его скачивал.
+func admUpdateDoc(ctx context.Context, c tele.Context, app *App, docID, field, value string) error {
+	t := trFor(c, app)
+	d, err := app.Sheets.GetDocument(ctx, docID)
+	if err != nil {
+		return c.Send(t.T(keyДокументНеНайден))
+	}
+	col := ""
+	for _, f := range admFields {
+		if f.Code == field {
+			col = f.Col
+		}
+	}
+	if col == "" {
+		return nil
+	}
+	if err := app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, col, value); err != nil {
+		logFor(c, app).Error("UpdateDocumentCell", "err", err, "field", field)
+		return c.Send(sheetsErrText(t, err, keyОшибкаИзменения))
+	}
+	newVersion := 0
+	if field == "link" || field == "file" {
+		by := ""
+		if c.Sender() != nil && c.Sender().Username != "" {
+			by = "@" + c.Sender().Username
+		}
+		// d — снимок до записи: в историю уходят прежние ссылка и file_id.
+		if newVersion, err = app.Sheets.BumpDocumentVersion(ctx, d, by); err != nil {
+			logFor(c, app).Error("BumpDocumentVersion", "err", err)
+		}
+	}
+	switch field {
+	case "link":
+		err = app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, docColFileID, "")
+		if err == nil {
+			err = app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, docColFileIDOrig, "")
+		}
+	case "file":
+		err = app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, docColСсылка, "")
+	}
+	if err != nil {
+		logFor(c, app).Error("UpdateDocumentCell", "err", err, "field", field)
+	}
+	if newVersion == 0 {
+		return c.Send(t.T(keyДокументИзменён, "{название}", d.Название))
+	}
+	m := &tele.ReplyMarkup{}
+	m.Inline(m.Row(m.Data(t.T(keyКнопкаУведомить), "adm", "ntf", d.ID)))
+	return c.Send(t.T(keyДокументИзменёнВерсия, "{название}", d.Название, "{версия}", strconv.Itoa(newVersion)), m)
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
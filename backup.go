@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Резервные копии таблицы: каждый лист из sheetHeaders — в CSV (для восстановления) и JSON (для чтения
+// и скриптов) в каталоге <dir>/<2006-01-02_150405>/ с manifest.json. Восстановление (-restore) пишет
+// лист из CSV целиком, начиная с A1, с предварительным сравнением (-dry-run — только сравнение).
+
+const (
+	backupStampLayout = "2006-01-02_150405"
+	backupManifest    = "manifest.json"
+	backupDiffLines   = 20 // строк различий на лист в выводе -restore
+)
+
+// backupManifestFile — содержимое manifest.json.
+type backupManifestFile struct {
+	Created       string            `json:"created"`
+	SpreadsheetID string            `json:"spreadsheet_id"`
+	SchemaVersion int               `json:"schema_version"`
+	Sheets        []backupSheetInfo `json:"sheets"`
+}
+
+type backupSheetInfo struct {
+	Name    string `json:"name"`
+	Rows    int    `json:"rows"` // строк данных без заголовка
+	Columns int    `json:"columns"`
+	CSV     string `json:"csv"`
+	JSON    string `json:"json"`
+	SHA256  string `json:"sha256"` // CSV-файла
+}
+
+// backupJSONFile — лист в JSON: заголовок и строки как объекты «колонка → значение».
+type backupJSONFile struct {
+	Sheet  string              `json:"sheet"`
+	Header []string            `json:"header"`
+	Rows   []map[string]string `json:"rows"`
+}
+
+// readSheetGrid читает лист целиком (с заголовком) как строки; все строки дополнены до одной ширины.
+func readSheetGrid(ctx context.Context, api *SheetsAPI, sheet string) ([][]string, error) {
+	resp, err := api.getValues(ctx, sheet+"!A1:ZZ")
+	if err != nil {
+		return nil, fmt.Errorf("Values.Get %s: %w", sheet, err)
+	}
+	width := 0
+	for _, row := range resp.Values {
+		width = max(width, len(row))
+	}
+	grid := make([][]string, len(resp.Values))
+	for i, row := range resp.Values {
+		grid[i] = make([]string, width)
+		for j, c := range row {
+			grid[i][j] = strCell(c)
+		}
+	}
+	return grid, nil
+}
+
+// backupSheets сохраняет все листы схемы в новый каталог внутри dir и возвращает его путь.
+// Каталог появляется только целиком: файлы пишутся во временный и затем переименовываются.
+func backupSheets(ctx context.Context, api *SheetsAPI, dir string) (string, error) {
+	now := time.Now()
+	final := filepath.Join(dir, now.Format(backupStampLayout))
+	tmp := filepath.Join(dir, ".tmp-"+now.Format(backupStampLayout))
+	if err := os.MkdirAll(tmp, 0o750); err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	m := backupManifestFile{Created: now.Format("2006-01-02 15:04:05"), SpreadsheetID: api.spreadsheetID}
+	if v, err := api.SchemaVersion(ctx); err == nil {
+		m.SchemaVersion = v
+	}
+	for _, sheet := range sortedSheets() {
+		grid, err := readSheetGrid(ctx, api, sheet)
+		if err != nil {
+			return "", err
+		}
+		info := backupSheetInfo{Name: sheet, CSV: sheet + ".csv", JSON: sheet + ".json"}
+		if len(grid) > 0 {
+			info.Rows, info.Columns = len(grid)-1, len(grid[0])
+		}
+		if info.SHA256, err = writeBackupCSV(filepath.Join(tmp, info.CSV), grid); err != nil {
+			return "", err
+		}
+		if err := writeJSONFile(filepath.Join(tmp, info.JSON), gridToJSON(sheet, grid)); err != nil {
+			return "", err
+		}
+		m.Sheets = append(m.Sheets, info)
+	}
+	if err := writeJSONFile(filepath.Join(tmp, backupManifest), m); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return "", err
+	}
+	return final, nil
+}
+
+// writeBackupCSV пишет grid в CSV и возвращает SHA-256 файла.
+func writeBackupCSV(path string, grid [][]string) (string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	w := csv.NewWriter(io.MultiWriter(f, h))
+	if err := w.WriteAll(grid); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o640)
+}
+
+// gridToJSON — лист в виде backupJSONFile. Колонки без заголовка называются по букве.
+func gridToJSON(sheet string, grid [][]string) backupJSONFile {
+	out := backupJSONFile{Sheet: sheet, Rows: []map[string]string{}}
+	if len(grid) == 0 {
+		return out
+	}
+	out.Header = grid[0]
+	for _, row := range grid[1:] {
+		obj := make(map[string]string, len(row))
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			key := strings.TrimSpace(out.Header[j])
+			if key == "" {
+				key = colToLetter(j + 1)
+			}
+			obj[key] = v
+		}
+		out.Rows = append(out.Rows, obj)
+	}
+	return out
+}
+
+// pruneBackups удаляет самые старые копии в dir, оставляя keep последних (0 — не удалять).
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	list, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	for len(list) > keep {
+		if err := os.RemoveAll(filepath.Join(dir, list[0])); err != nil {
+			return err
+		}
+		list = list[1:]
+	}
+	return nil
+}
+
+// listBackups — имена каталогов копий в dir по возрастанию времени.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	for _, e := range entries {
+		if _, err := time.Parse(backupStampLayout, e.Name()); err == nil && e.IsDir() {
+			list = append(list, e.Name())
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// lastBackupTime — время последней копии в dir (нулевое — копий нет).
+func lastBackupTime(dir string) time.Time {
+	list, err := listBackups(dir)
+	if err != nil || len(list) == 0 {
+		return time.Time{}
+	}
+	t, _ := time.ParseInLocation(backupStampLayout, list[len(list)-1], time.Local)
+	return t
+}
+
+// StartBackupWorker делает копию раз в interval (первую — когда с последней копии в dir прошёл interval)
+// и оставляет keep последних. При ошибке повторяет через 10 минут. Вызывать в горутине.
+func StartBackupWorker(api *SheetsAPI, dir string, interval time.Duration, keep int) {
+	wait := time.Minute
+	if last := lastBackupTime(dir); !last.IsZero() {
+		wait = max(wait, time.Until(last.Add(interval)))
+	}
+	for {
+		time.Sleep(wait)
+		ctx, cancel := context.WithTimeout(lowPriority(context.Background()), 10*time.Minute)
+		path, err := backupSheets(ctx, api, dir)
+		cancel()
+		if err != nil {
+			mBackups.Inc("error")
+			if errors.Is(err, ErrSheetsDeferred) {
+				api.logger().Warn("Резервная копия отложена: бюджет запросов к таблице почти исчерпан", "err", err)
+			} else {
+				api.logger().Error("Резервная копия", "err", err)
+			}
+			wait = 10 * time.Minute
+			continue
+		}
+		mBackups.Inc("ok")
+		api.logger().Info("Резервная копия таблицы", "path", path)
+		if err := pruneBackups(dir, keep); err != nil {
+			api.logger().Error("Удаление старых резервных копий", "err", err)
+		}
+		wait = interval
+	}
+}
+
+// resolveBackupDir — каталог копии: src, если в нём есть manifest.json, иначе последняя копия внутри src.
+func resolveBackupDir(src string) (string, error) {
+	if _, err := os.Stat(filepath.Join(src, backupManifest)); err == nil {
+		return src, nil
+	}
+	list, err := listBackups(src)
+	if err != nil {
+		return "", err
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("в %s нет резервных копий (%s)", src, backupManifest)
+	}
+	return filepath.Join(src, list[len(list)-1]), nil
+}
+
+// readBackupCSV читает CSV листа и сверяет SHA-256 с манифестом.
+func readBackupCSV(dir string, info backupSheetInfo) ([][]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, info.CSV))
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); info.SHA256 != "" && hex.EncodeToString(sum[:]) != info.SHA256 {
+		return nil, fmt.Errorf("%s: контрольная сумма не совпадает с %s — файл изменён или повреждён", info.CSV, backupManifest)
+	}
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// restoreSheets восстанавливает листы из копии src (каталог копии или каталог с копиями — берётся
+// последняя). only — один лист ("" — все). Различия печатаются в w; при dryRun таблица не меняется.
+func restoreSheets(ctx context.Context, api *SheetsAPI, src, only string, dryRun bool, w io.Writer) error {
+	dir, err := resolveBackupDir(src)
+	if err != nil {
+		return err
+	}
+	var m backupManifestFile
+	data, err := os.ReadFile(filepath.Join(dir, backupManifest))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s: %w", backupManifest, err)
+	}
+	fmt.Fprintf(w, "Копия %s от %s (схема v%d)\n", dir, m.Created, m.SchemaVersion)
+	if m.SpreadsheetID != api.spreadsheetID {
+		fmt.Fprintf(w, "Внимание: копия снята с другой таблицы (%s)\n", m.SpreadsheetID)
+	}
+	if v, err := api.SchemaVersion(ctx); err == nil && v != m.SchemaVersion {
+		fmt.Fprintf(w, "Внимание: версия схемы таблицы v%d, копии v%d — колонки восстановятся как в копии\n", v, m.SchemaVersion)
+	}
+
+	var list []backupSheetInfo
+	for _, info := range m.Sheets {
+		if only == "" || info.Name == only {
+			list = append(list, info)
+		}
+	}
+	if len(list) == 0 {
+		return fmt.Errorf("листа %q нет в копии", only)
+	}
+	if !dryRun {
+		if err := api.EnsureSheets(ctx); err != nil {
+			return err
+		}
+	}
+	for _, info := range list {
+		backup, err := readBackupCSV(dir, info)
+		if err != nil {
+			return err
+		}
+		current, err := readSheetGrid(ctx, api, info.Name)
+		if err != nil && !(dryRun && isMissingSheet(err)) {
+			return err
+		}
+		changed := printGridDiff(w, info.Name, current, backup)
+		if dryRun || changed == 0 {
+			continue
+		}
+		if err := writeSheetGrid(ctx, api, info.Name, current, backup); err != nil {
+			return fmt.Errorf("восстановление %s: %w", info.Name, err)
+		}
+		fmt.Fprintf(w, "  восстановлено\n")
+	}
+	if dryRun {
+		fmt.Fprintln(w, "Пробный запуск (-dry-run): таблица не изменена.")
+	}
+	return nil
+}
+
+// writeSheetGrid перезаписывает лист содержимым grid одним запросом; ячейки current за пределами
+// grid очищаются (записываются пустыми).
+func writeSheetGrid(ctx context.Context, api *SheetsAPI, sheet string, current, grid [][]string) error {
+	rows := max(len(current), len(grid))
+	width := 0
+	for _, r := range current {
+		width = max(width, len(r))
+	}
+	for _, r := range grid {
+		width = max(width, len(r))
+	}
+	if rows == 0 || width == 0 {
+		return nil
+	}
+	values := make([][]interface{}, rows)
+	for i := range values {
+		values[i] = make([]interface{}, width)
+		for j := range values[i] {
+			values[i][j] = ""
+			if i < len(grid) && j < len(grid[i]) {
+				values[i][j] = grid[i][j]
+			}
+		}
+	}
+	return api.updateValues(ctx, sheet+"!A1", &sheets.ValueRange{Values: values})
+}
+
+// printGridDiff печатает различия листа (строки таблицы → строки копии) и возвращает их число.
+func printGridDiff(w io.Writer, sheet string, current, backup [][]string) int {
+	n := max(len(current), len(backup))
+	var lines []string
+	changed := 0
+	for i := 0; i < n; i++ {
+		var cur, bak string
+		if i < len(current) {
+			cur = joinRow(current[i])
+		}
+		if i < len(backup) {
+			bak = joinRow(backup[i])
+		}
+		if cur == bak {
+			continue
+		}
+		changed++
+		if len(lines) >= backupDiffLines {
+			continue
+		}
+		cur, bak = diffText(cur), diffText(bak)
+		switch {
+		case cur == "":
+			lines = append(lines, fmt.Sprintf("  строка %d: + %s", i+1, bak))
+		case bak == "":
+			lines = append(lines, fmt.Sprintf("  строка %d: - %s", i+1, cur))
+		default:
+			lines = append(lines, fmt.Sprintf("  строка %d: %s → %s", i+1, cur, bak))
+		}
+	}
+	fmt.Fprintf(w, "== %s: в таблице строк %d, в копии %d, различается %d\n", sheet, max(len(current)-1, 0), max(len(backup)-1, 0), changed)
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	if changed > len(lines) {
+		fmt.Fprintf(w, "  …и ещё %d\n", changed-len(lines))
+	}
+	return changed
+}
+
+// joinRow — строка для сравнения: значения через « | » без пустого хвоста.
+func joinRow(row []string) string {
+	end := len(row)
+	for end > 0 && strings.TrimSpace(row[end-1]) == "" {
+		end--
+	}
+	return strings.Join(row[:end], " | ")
+}
+
+// diffText — значение строки для вывода: в одну строку и не длиннее 200 символов.
+func diffText(s string) string {
+	return truncateRunes(strings.ReplaceAll(s, "\n", "⏎"), 200)
+}
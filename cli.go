@@ -0,0 +1,794 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Командная строка: подкоманды (app users list, app schema migrate, …) с --help, общей загрузкой
+// конфигурации (bootstrap), кодами выхода и выводом --json. Без аргументов — запуск бота, как раньше;
+// прежние флаги (-log, -fill-settings, -backup, …) переводятся в подкоманды (legacyArgs).
+
+// Коды выхода.
+const (
+	exitOK    = 0  // успех
+	exitFail  = 1  // проверка не пройдена: ошибки в таблице или файле, часть рассылки не ушла
+	exitError = 2  // не удалось выполнить: нет настроек, таблица или Telegram недоступны
+	exitUsage = 64 // неверные аргументы (EX_USAGE)
+)
+
+// cliCommand — подкоманда. Setup объявляет флаги в fs и возвращает запуск с позиционными аргументами.
+type cliCommand struct {
+	Name    string // «users list»
+	Args    string // позиционные аргументы для справки
+	Summary string
+	MinArgs int
+	MaxArgs int // -1 — без ограничения
+	Setup   func(fs *flag.FlagSet) func(args []string) int
+}
+
+var cliCommands = []cliCommand{
+	{Name: "run", Summary: "Запустить бота (то же без аргументов)", Setup: setupRun},
+	{Name: "log", Args: "<сообщение>", Summary: "Записать сообщение в «Логи_Сервера» (для deploy.sh)", MinArgs: 1, MaxArgs: -1, Setup: setupLog},
+	{Name: "settings import", Summary: "Загрузить тексты из CSV в «Настройки_Текста» (merge по «Ключ» и «Язык»)", Setup: setupSettingsImport},
+	{Name: "seed", Summary: "Записать тестовые категории, документы и строку в «Админы»", Setup: setupSeed},
+	{Name: "users list", Summary: "Пользователи бота из листа «Пользователи»", Setup: setupUsersList},
+	{Name: "broadcast", Args: "<текст>", Summary: "Рассылка всем пользователям из «Пользователи» (как /send)", MaxArgs: -1, Setup: setupBroadcast},
+	{Name: "cache warm", Summary: "Прочитать всё, что бот держит в кэше, и показать объёмы и ошибки", Setup: setupCacheWarm},
+	{Name: "schema migrate", Summary: "Создать листы и колонки, применить миграции схемы", Setup: setupSchemaMigrate},
+	{Name: "validate", Summary: "Проверить таблицу (как /doctor)", Setup: setupValidate},
+	{Name: "backup", Args: "<каталог>", Summary: "Резервная копия всех листов в новый подкаталог", MinArgs: 1, MaxArgs: 1, Setup: setupBackup},
+	{Name: "restore", Args: "<каталог>", Summary: "Восстановить листы из копии (каталог копии или с копиями — последняя)", MinArgs: 1, MaxArgs: 1, Setup: setupRestore},
+	{Name: "sheet export", Args: "<Лист> <файл>", Summary: "Выгрузить лист в CSV, TSV, JSON или XLSX (по расширению)", MinArgs: 2, MaxArgs: 2, Setup: setupSheetExport},
+	{Name: "sheet import", Args: "<Лист> <файл>", Summary: "Загрузить лист из CSV, TSV, JSON или XLSX", MinArgs: 2, MaxArgs: 2, Setup: setupSheetImport},
+	{Name: "config print", Summary: "Действующая конфигурация (секреты скрыты) и откуда взято каждое значение", Setup: setupConfigPrint},
+}
+
+// legacyFlags — прежние флаги и соответствующие подкоманды.
+var legacyFlags = map[string][]string{
+	"-log":            {"log"},
+	"-fill-settings":  {"settings", "import"},
+	"-fill-test-data": {"seed"},
+	"-validate":       {"validate"},
+	"-backup":         {"backup"},
+	"-restore":        {"restore"},
+	"-export":         {"sheet", "export"},
+	"-import":         {"sheet", "import"},
+}
+
+// runCLI разбирает аргументы (без имени программы) и выполняет команду; результат — код выхода.
+func runCLI(args []string) int {
+	args, err := globalFlags(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	args = legacyArgs(args)
+	if len(args) == 0 {
+		return runBot()
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd, _ := findCommand(args[1:]); cmd != nil {
+				fs := cmd.flagSet()
+				cmd.Setup(fs)
+				cmd.usage(os.Stdout, fs)
+				return exitOK
+			}
+		}
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Неизвестная команда: %s\n\n", strings.Join(args, " "))
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+	fs := cmd.flagSet()
+	run := cmd.Setup(fs)
+	pos, err := parseInterspersed(fs, rest)
+	if errors.Is(err, flag.ErrHelp) {
+		cmd.usage(os.Stdout, fs)
+		return exitOK
+	}
+	if err == nil && (len(pos) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(pos) > cmd.MaxArgs)) {
+		err = fmt.Errorf("неверное число аргументов: %d", len(pos))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n\n", cmd.Name, err)
+		cmd.usage(os.Stderr, fs)
+		return exitUsage
+	}
+	return run(pos)
+}
+
+// cliTenant — бот из глобального --tenant: команды работают с его таблицей ("" — основной).
+var cliTenant string
+
+// globalFlags снимает глобальные флаги перед командой: --config <файл> (путь передаётся в LoadConfig
+// через CONFIG_FILE) и --tenant <бот>; оба можно писать и как --флаг=значение.
+func globalFlags(args []string) ([]string, error) {
+	for len(args) > 0 {
+		name, val, hasVal := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		if !strings.HasPrefix(args[0], "-") || (name != "config" && name != "tenant") {
+			break
+		}
+		n := 1
+		if !hasVal {
+			if len(args) < 2 {
+				return nil, fmt.Errorf("--%s: нужно значение", name)
+			}
+			val, n = args[1], 2
+		}
+		if name == "config" {
+			_ = os.Setenv("CONFIG_FILE", val)
+		} else {
+			cliTenant = val
+		}
+		args = args[n:]
+	}
+	return args, nil
+}
+
+// legacyArgs переводит прежний вызов «-import Лист файл -mode replace» в «sheet import Лист файл -mode replace».
+// Подкоманда в начале — уже новый вызов, его аргументы не трогаются.
+func legacyArgs(args []string) []string {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "-") {
+		return args
+	}
+	for i, a := range args {
+		if sub, ok := legacyFlags[a]; ok {
+			return append(append(append([]string{}, sub...), args[:i]...), args[i+1:]...)
+		}
+	}
+	return args
+}
+
+// findCommand ищет команду с самым длинным совпадением имени; rest — аргументы после имени.
+func findCommand(args []string) (*cliCommand, []string) {
+	var best *cliCommand
+	n := 0
+	for i := range cliCommands {
+		words := strings.Fields(cliCommands[i].Name)
+		if len(words) <= n || len(words) > len(args) {
+			continue
+		}
+		match := true
+		for j, w := range words {
+			match = match && args[j] == w
+		}
+		if match {
+			best, n = &cliCommands[i], len(words)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, args[n:]
+}
+
+func (c *cliCommand) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// usage печатает справку по команде; флаги в fs уже объявлены Setup.
+func (c *cliCommand) usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Использование: %s %s", progName(), c.Name)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprint(w, " [флаги]")
+	}
+	if c.Args != "" {
+		fmt.Fprint(w, " "+c.Args)
+	}
+	fmt.Fprintf(w, "\n\n%s.\n", c.Summary)
+	if hasFlags {
+		fmt.Fprint(w, "\nФлаги:\n")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(io.Discard)
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Использование: %s [--config файл] [--tenant бот] [команда] [флаги] [аргументы]\n\nКоманды:\n", progName())
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range cliCommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.Name, c.Args, c.Summary)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\nБез команды — run. Справка по команде: %s <команда> --help.\n", progName())
+	fmt.Fprintf(w, "Конфигурация: --config или CONFIG_FILE (иначе %s, если есть), переменные окружения и .env важнее файла.\n", defaultConfigFile)
+	fmt.Fprintln(w, "--tenant — команда работает с таблицей бота из [tenants.<бот>] (run — запускает только его).")
+	fmt.Fprintf(w, "Коды выхода: %d — успех, %d — проверка не пройдена, %d — ошибка, %d — неверные аргументы.\n",
+		exitOK, exitFail, exitError, exitUsage)
+}
+
+func progName() string { return filepath.Base(os.Args[0]) }
+
+// parseInterspersed разбирает флаги и до, и после позиционных аргументов («backup dir --json»).
+// После «--» всё — позиционные аргументы.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(pos, rest...), nil
+		}
+		if len(rest) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, rest[0])
+		args = rest[1:]
+	}
+}
+
+// bootstrap — общая подготовка команд: конфигурация (.env прочитан в main) и клиент таблицы.
+// needBot — команде нужен и BOT_TOKEN. Причину отказа пишет в лог.
+func bootstrap(ctx context.Context, name string, needBot bool) (*Config, *SheetsAPI, bool) {
+	cfg, err := loadCLIConfig()
+	if err != nil {
+		log.Printf("%s: конфигурация: %v", name, err)
+		return nil, nil, false
+	}
+	if cfg.SpreadsheetID == "" {
+		log.Printf("%s: нужен SPREADSHEET_ID и ключ Google (CREDENTIALS_PATH или GOOGLE_CREDENTIALS_JSON). См. env.example.", name)
+		return nil, nil, false
+	}
+	if needBot && cfg.BotToken == "" {
+		log.Printf("%s: нужен BOT_TOKEN. См. env.example.", name)
+		return nil, nil, false
+	}
+	api, err := newSheetsFor(ctx, cfg)
+	if err != nil {
+		log.Printf("%s: %v", name, err)
+		return nil, nil, false
+	}
+	return cfg, api, true
+}
+
+// loadCLIConfig — LoadConfig, а с --tenant — конфигурация этого бота.
+func loadCLIConfig() (*Config, error) {
+	cfg, err := LoadConfig()
+	if err != nil || cliTenant == "" {
+		return cfg, err
+	}
+	t, ok := cfg.TenantConfig(cliTenant)
+	if !ok {
+		return nil, fmt.Errorf("--tenant: нет бота %q (есть: %s)", cliTenant, strings.Join(cfg.TenantNames(), ", "))
+	}
+	return t, nil
+}
+
+// newSheetsFor — клиент таблицы бота cfg с его ключом Google и бюджетом запросов, общим для ботов
+// с тем же ключом.
+func newSheetsFor(ctx context.Context, cfg *Config) (*SheetsAPI, error) {
+	creds, credSource, account, err := sheetsCredentials(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("ключ Google: %w", err)
+	}
+	api, err := NewSheetsAPI(ctx, cfg.SpreadsheetID, creds)
+	if err != nil {
+		return nil, fmt.Errorf("Sheets API (ключ: %s): %w", credSource, err)
+	}
+	api.budget = sharedSheetsBudget(account)
+	api.SetRequestsPerMin(cfg.SheetsPerMin)
+	return api, nil
+}
+
+// newBot — клиент Telegram с метриками запросов. poller nil — без приёма апдейтов (команды CLI).
+func newBot(cfg *Config, poller tele.Poller) (*tele.Bot, error) {
+	return tele.NewBot(tele.Settings{
+		Token:  cfg.BotToken,
+		Poller: poller,
+		Client: &http.Client{Timeout: time.Minute, Transport: &telegramMetricsTransport{next: http.DefaultTransport}},
+	})
+}
+
+// printJSON — машиночитаемый вывод команды (--json) в stdout.
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// cliContext — контекст команды с таймаутом.
+func cliContext(d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), d)
+}
+
+func setupRun(*flag.FlagSet) func([]string) int {
+	return func([]string) int { return runBot() }
+}
+
+func setupLog(fs *flag.FlagSet) func([]string) int {
+	level := fs.String("level", "Info", "уровень записи: Info, Warning, Error")
+	return func(args []string) int {
+		ctx, cancel := cliContext(time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "log", false)
+		if !ok {
+			return exitError
+		}
+		_ = api.EnsureSchema(ctx)
+		if err := api.LogToSheets(ctx, *level, strings.Join(args, " ")); err != nil {
+			log.Printf("LogToSheets: %v", err)
+			return exitError
+		}
+		return exitOK
+	}
+}
+
+func setupSettingsImport(fs *flag.FlagSet) func([]string) int {
+	file := fs.String("file", "settings_text.example.csv", "файл с колонками «Ключ», «Текст» и «Язык» (CSV, TSV, JSON, XLSX)")
+	dryRun := fs.Bool("dry-run", false, "только показать изменения")
+	return func([]string) int {
+		return importCommand(sheetНастройкиТекста, *file, importMerge, *dryRun)
+	}
+}
+
+func setupSeed(*flag.FlagSet) func([]string) int {
+	return func([]string) int {
+		ctx, cancel := cliContext(5 * time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "seed", false)
+		if !ok {
+			return exitError
+		}
+		if err := api.EnsureSchema(ctx); err != nil {
+			log.Printf("EnsureSchema: %v", err)
+			return exitError
+		}
+
+		// Категории: Название, ID (фиксированные ID для привязки документов)
+		categories := [][]interface{}{
+			{"Внутренние документы", "test-cat-internal"},
+			{"Полезные ссылки", "test-cat-links"},
+		}
+		if err := api.WriteSheetData(ctx, sheetКатегории, 2, categories); err != nil {
+			log.Printf("Категории: %v", err)
+			return exitError
+		}
+		log.Printf("Категории: записано %d строк.", len(categories))
+
+		// Документы: ID_Категории, Название, Описание, Ссылка
+		documents := [][]interface{}{
+			{"test-cat-internal", "Регламент", "Внутренний регламент организации.", "https://example.com/reglament.pdf"},
+			{"test-cat-internal", "Инструкция по ОТ", "Инструкция по охране труда.", "https://example.com/ot.pdf"},
+			{"test-cat-links", "Яндекс.Диск (тест)", "При ссылке на disk.yandex.ru бот попытается скачать файл; при ошибке отправит ссылку.", "https://disk.yandex.ru/i/placeholder"},
+			{"test-cat-links", "Памятка", "Памятка для новичков.", "https://example.com/pamyatka.pdf"},
+		}
+		if err := api.WriteSheetData(ctx, sheetДокументы, 2, documents); err != nil {
+			log.Printf("Документы: %v", err)
+			return exitError
+		}
+		log.Printf("Документы: записано %d строк.", len(documents))
+
+		// Админы: одна строка-подсказка (замените на свой @username или добавьте свою строку)
+		if err := api.appendRow(ctx, sheetАдмины, []interface{}{"ЗАМЕНИТЕ_НА_СВОЙ_ЮЗЕРНЕЙМ", ""}); err != nil {
+			log.Printf("Админы: %v", err)
+			return exitError
+		}
+		log.Print("Админы: добавлена строка «ЗАМЕНИТЕ_НА_СВОЙ_ЮЗЕРНЕЙМ» — замените на свой @username или допишите себя вручную.")
+
+		log.Print("Тестовые данные записаны. Запустите бота (go run .) и проверьте: /start, Список документов, Пожелания, Запросить доступ в IMO.")
+		return exitOK
+	}
+}
+
+func setupUsersList(fs *flag.FlagSet) func([]string) int {
+	asJSON := fs.Bool("json", false, "вывод в JSON")
+	return func([]string) int {
+		ctx, cancel := cliContext(time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "users list", false)
+		if !ok {
+			return exitError
+		}
+		users, err := api.GetUsers(ctx)
+		if err != nil {
+			log.Printf("Пользователи: %v", err)
+			return exitError
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+		if *asJSON {
+			if users == nil {
+				users = []UserProfile{}
+			}
+			printJSON(users)
+			return exitOK
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tЮзернейм\tИмя\tЯзык\tРегистрация\tПоследний визит")
+		for _, u := range users {
+			name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+			username := ""
+			if u.Username != "" {
+				username = "@" + u.Username
+			}
+			lang := u.Lang
+			if u.BotLang != "" {
+				lang = u.BotLang + " (/lang)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", u.ID, username, name, lang, u.Registered, u.LastSeen)
+		}
+		_ = tw.Flush()
+		fmt.Printf("Всего: %d\n", len(users))
+		return exitOK
+	}
+}
+
+func setupBroadcast(fs *flag.FlagSet) func([]string) int {
+	file := fs.String("file", "", "взять текст из файла (вместо аргументов)")
+	dryRun := fs.Bool("dry-run", false, "только показать число получателей")
+	asJSON := fs.Bool("json", false, "итог в JSON")
+	return func(args []string) int {
+		text := strings.Join(args, " ")
+		if *file != "" {
+			data, err := os.ReadFile(*file)
+			if err != nil {
+				log.Printf("broadcast: %v", err)
+				return exitError
+			}
+			text = string(data)
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			log.Print("broadcast: пустой текст — передайте его аргументами или через --file.")
+			return exitUsage
+		}
+		ctx, cancel := cliContext(time.Minute)
+		defer cancel()
+		cfg, api, ok := bootstrap(ctx, "broadcast", !*dryRun)
+		if !ok {
+			return exitError
+		}
+		users, err := api.GetUsers(ctx)
+		if err != nil {
+			log.Printf("Пользователи: %v", err)
+			return exitError
+		}
+		ids := make([]int64, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		sent, failed := 0, 0
+		if !*dryRun {
+			b, err := newBot(cfg, nil)
+			if err != nil {
+				log.Printf("Telegram: %v", err)
+				return exitError
+			}
+			sent, failed = broadcast(b, ids, text, func(id int64, err error) {
+				log.Printf("Рассылка: chat_id %d: %v", id, err)
+			})
+		}
+		if *asJSON {
+			printJSON(map[string]interface{}{"recipients": len(ids), "sent": sent, "failed": failed, "dry_run": *dryRun})
+		} else if *dryRun {
+			fmt.Printf("Получателей: %d. Пробный запуск (--dry-run): ничего не отправлено.\n", len(ids))
+		} else {
+			fmt.Printf("Рассылка завершена. Отправлено: %d, ошибок: %d\n", sent, failed)
+		}
+		if failed > 0 {
+			return exitFail
+		}
+		return exitOK
+	}
+}
+
+// cacheSource — итог чтения одного источника для cache warm.
+type cacheSource struct {
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+func setupCacheWarm(fs *flag.FlagSet) func([]string) int {
+	asJSON := fs.Bool("json", false, "вывод в JSON")
+	return func([]string) int {
+		ctx, cancel := cliContext(2 * time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "cache warm", false)
+		if !ok {
+			return exitError
+		}
+		// То же, что cache.reload и userIndex.Load при старте бота, — по источникам.
+		loads := []struct {
+			name string
+			load func() (int, error)
+		}{
+			{sheetНастройкиТекста, func() (int, error) { ts, err := api.GetTextSettings(ctx); return ts.size(), err }},
+			{sheetКатегории, func() (int, error) { l, err := api.GetCategories(ctx); return len(l), err }},
+			{sheetДокументы, func() (int, error) { l, err := api.GetDocuments(ctx); return len(l), err }},
+			{sheetАдмины, func() (int, error) { ids, names, err := api.GetAdmins(ctx); return len(ids) + len(names), err }},
+			{sheetДоступы, func() (int, error) { l, err := api.GetAccessGrants(ctx); return len(l), err }},
+			{sheetПользователи, func() (int, error) { l, err := api.GetUsers(ctx); return len(l), err }},
+		}
+		var out []cacheSource
+		code := exitOK
+		for _, l := range loads {
+			start := time.Now()
+			n, err := l.load()
+			src := cacheSource{Name: l.name, Count: n, DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				src.Error = err.Error()
+				code = exitError
+			}
+			out = append(out, src)
+		}
+		if *asJSON {
+			printJSON(out)
+			return code
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, s := range out {
+			status := fmt.Sprintf("%d", s.Count)
+			if s.Error != "" {
+				status = "ошибка: " + s.Error
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d мс\n", s.Name, status, s.DurationMS)
+		}
+		_ = tw.Flush()
+		return code
+	}
+}
+
+func setupSchemaMigrate(fs *flag.FlagSet) func([]string) int {
+	dryRun := fs.Bool("dry-run", false, "только показать текущую версию и непримененные миграции")
+	asJSON := fs.Bool("json", false, "итог в JSON")
+	return func([]string) int {
+		ctx, cancel := cliContext(5 * time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "schema migrate", false)
+		if !ok {
+			return exitError
+		}
+		from, err := api.SchemaVersion(ctx)
+		if err != nil {
+			log.Printf("Версия схемы: %v", err)
+			return exitError
+		}
+		to := from
+		if !*dryRun {
+			if err := api.EnsureSchema(ctx); err != nil {
+				log.Printf("EnsureSchema: %v", err)
+				return exitError
+			}
+			if to, err = api.SchemaVersion(ctx); err != nil {
+				log.Printf("Версия схемы: %v", err)
+				return exitError
+			}
+		}
+		var names []string
+		for _, m := range migrations {
+			if m.Version > from && (*dryRun || m.Version <= to) {
+				names = append(names, fmt.Sprintf("%d: %s", m.Version, m.Name))
+			}
+		}
+		if *asJSON {
+			if names == nil {
+				names = []string{}
+			}
+			printJSON(map[string]interface{}{"from": from, "to": to, "latest": latestSchemaVersion(), "migrations": names, "dry_run": *dryRun})
+			return exitOK
+		}
+		switch {
+		case *dryRun && len(names) == 0:
+			fmt.Printf("Версия схемы %d — актуальная.\n", from)
+		case *dryRun:
+			fmt.Printf("Версия схемы %d, будут применены:\n  %s\n", from, strings.Join(names, "\n  "))
+		case len(names) == 0:
+			fmt.Printf("Версия схемы %d — актуальная; листы и колонки проверены.\n", to)
+		default:
+			fmt.Printf("Схема: %d → %d, применены:\n  %s\n", from, to, strings.Join(names, "\n  "))
+		}
+		return exitOK
+	}
+}
+
+func setupValidate(fs *flag.FlagSet) func([]string) int {
+	checkFiles := fs.Bool("check-files", false, "проверить file_id через Telegram (нужен BOT_TOKEN, медленнее)")
+	asJSON := fs.Bool("json", false, "отчёт в JSON")
+	return func([]string) int {
+		ctx, cancel := cliContext(5 * time.Minute)
+		defer cancel()
+		cfg, api, ok := bootstrap(ctx, "validate", *checkFiles)
+		if !ok {
+			return exitError
+		}
+		var files fileChecker
+		if *checkFiles {
+			b, err := newBot(cfg, nil)
+			if err != nil {
+				log.Printf("Telegram: %v", err)
+				return exitError
+			}
+			files = botFileChecker(b)
+		}
+		rep, err := runDoctor(ctx, api, files)
+		if err != nil {
+			log.Printf("Проверка таблицы: %v", err)
+			return exitError
+		}
+		if *asJSON {
+			if rep.Issues == nil {
+				rep.Issues = []doctorIssue{}
+			}
+			printJSON(rep)
+		} else {
+			fmt.Print(formatDoctorText(rep))
+		}
+		if rep.Errors() > 0 {
+			return exitFail
+		}
+		return exitOK
+	}
+}
+
+func setupBackup(fs *flag.FlagSet) func([]string) int {
+	asJSON := fs.Bool("json", false, "путь копии в JSON")
+	return func(args []string) int {
+		dir := args[0]
+		ctx, cancel := cliContext(10 * time.Minute)
+		defer cancel()
+		cfg, api, ok := bootstrap(ctx, "backup", false)
+		if !ok {
+			return exitError
+		}
+		path, err := backupSheets(ctx, api, dir)
+		if err != nil {
+			log.Printf("Резервная копия: %v", err)
+			return exitError
+		}
+		if err := pruneBackups(dir, cfg.BackupKeep); err != nil {
+			log.Printf("Удаление старых копий: %v", err)
+		}
+		if *asJSON {
+			printJSON(map[string]string{"path": path})
+		} else {
+			fmt.Println(path)
+		}
+		return exitOK
+	}
+}
+
+func setupRestore(fs *flag.FlagSet) func([]string) int {
+	sheet := fs.String("sheet", "", "восстановить только этот лист")
+	dryRun := fs.Bool("dry-run", false, "только показать различия")
+	return func(args []string) int {
+		ctx, cancel := cliContext(10 * time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "restore", false)
+		if !ok {
+			return exitError
+		}
+		if err := restoreSheets(ctx, api, args[0], *sheet, *dryRun, os.Stdout); err != nil {
+			log.Printf("Восстановление: %v", err)
+			return exitError
+		}
+		return exitOK
+	}
+}
+
+func setupSheetExport(*flag.FlagSet) func([]string) int {
+	return func(args []string) int {
+		sheet, file := args[0], args[1]
+		ctx, cancel := cliContext(5 * time.Minute)
+		defer cancel()
+		_, api, ok := bootstrap(ctx, "sheet export", false)
+		if !ok {
+			return exitError
+		}
+		n, err := exportSheet(ctx, api, sheet, file)
+		if err != nil {
+			log.Printf("Экспорт: %v", err)
+			return exitError
+		}
+		log.Printf("%s → %s: строк %d.", sheet, file, n)
+		return exitOK
+	}
+}
+
+func setupSheetImport(fs *flag.FlagSet) func([]string) int {
+	mode := fs.String("mode", importMerge, "merge — обновить по ключу и дописать новые, replace — заменить все строки")
+	dryRun := fs.Bool("dry-run", false, "только показать изменения")
+	return func(args []string) int {
+		return importCommand(args[0], args[1], *mode, *dryRun)
+	}
+}
+
+// importCommand — загрузка файла в лист (sheet import, settings import). Код выхода: exitFail —
+// файл не прошёл проверку, exitError — таблица недоступна.
+func importCommand(sheet, file, mode string, dryRun bool) int {
+	ctx, cancel := cliContext(5 * time.Minute)
+	defer cancel()
+	_, api, ok := bootstrap(ctx, "import", false)
+	if !ok {
+		return exitError
+	}
+	if err := importSheet(ctx, api, sheet, file, mode, dryRun, os.Stdout); err != nil {
+		log.Printf("Импорт: %v", err)
+		if errors.Is(err, ErrSheetsUnavailable) {
+			return exitError
+		}
+		return exitFail
+	}
+	return exitOK
+}
+
+func setupConfigPrint(fs *flag.FlagSet) func([]string) int {
+	asJSON := fs.Bool("json", false, "вывод в JSON")
+	return func([]string) int {
+		cfg, err := loadCLIConfig()
+		if err != nil {
+			log.Print(err)
+			return exitFail
+		}
+		root, _ := LoadConfig()
+		entries := cfg.Entries()
+		if *asJSON {
+			printJSON(map[string]interface{}{"file": cfg.ConfigFile, "tenant": cfg.Tenant, "tenants": root.TenantNames(), "settings": entries})
+			return exitOK
+		}
+		file := cfg.ConfigFile
+		if file == "" {
+			file = "нет"
+		}
+		fmt.Printf("# Действующая конфигурация. Файл: %s. Секреты скрыты. «при перезапуске» — SIGHUP не применяет.\n", file)
+		switch {
+		case cfg.Tenant != "":
+			fmt.Printf("# Бот %s ([tenants.%s.*]); «общая» — задаётся для всех ботов.\n", cfg.Tenant, cfg.Tenant)
+		case len(root.Tenants) > 0:
+			fmt.Printf("# Основной бот. Дополнительные: %s — см. --tenant <бот> config print.\n", strings.Join(root.TenantNames(), ", "))
+		}
+		section := ""
+		for i, e := range entries {
+			sec, name, _ := strings.Cut(e.Key, ".")
+			if sec != section {
+				fmt.Printf("\n[%s]\n", sec)
+				section = sec
+			}
+			v := strconv.Quote(e.Value)
+			if configFields[i].Int {
+				v = e.Value
+			}
+			comment := e.Source
+			if comment != "$"+e.Env {
+				comment += ", $" + e.Env
+			}
+			if e.Restart {
+				comment += ", при перезапуске"
+			}
+			if cfg.Tenant != "" && configFields[i].Shared {
+				comment += ", общая"
+			}
+			fmt.Printf("%-18s = %-24s # %s\n", name, v, comment)
+		}
+		return exitOK
+	}
+}
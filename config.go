@@ -1,53 +1,550 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// Config — конфигурация приложения из переменных окружения.
+// Конфигурация: значения по умолчанию, затем файл bugchat.toml (CONFIG_FILE или --config), затем
+// переменные окружения и .env — они важнее файла. Все настройки описаны в configFields; неверные
+// значения не заменяются умолчаниями молча — LoadConfig возвращает список всех проблем.
+
+// sourceDefault — источник значения по умолчанию (config print, Config.sources).
+const sourceDefault = "по умолчанию"
+
+// defaultConfigFile читается, если CONFIG_FILE не задан и файл есть в рабочем каталоге.
+const defaultConfigFile = "bugchat.toml"
+
+// Config — конфигурация приложения.
 type Config struct {
 	BotToken        string
 	BotUsername     string // без @ (опционально)
+	TelegramMaxMB   int64  // TELEGRAM_MAX_MB: наибольший документ, который бот отправляет файлом
 	SpreadsheetID   string
-	CredentialsPath string
+	CredentialsPath string // файл JSON-ключа; adc — Application Default Credentials
+	CredentialsJSON string // GOOGLE_CREDENTIALS_JSON: ключ целиком или в base64 (важнее CredentialsPath)
 	CacheTTLMin     int
 	YandexMaxMB     int64
+	DeliveryMode    string // zip | original | auto — режим доставки документов без своей «Доставки»
+	HTTPAddr        string // адрес HTTP для /metrics, /healthz, /readyz (пусто — выключено)
+	SheetsPerMin    int    // SHEETS_REQUESTS_PER_MIN: бюджет запросов к Sheets в минуту (чтение и запись отдельно), 0 — без учёта
+
+	BackupDir      string        // BACKUP_DIR: каталог резервных копий таблицы (пусто — без копий по расписанию)
+	BackupInterval time.Duration // BACKUP_INTERVAL_HOURS: как часто делать копию
+	BackupKeep     int           // BACKUP_KEEP: сколько последних копий хранить, 0 — все
+
+	LogLevel        slog.Level // LOG_LEVEL: уровень для stderr и файла
+	LogFormat       string     // LOG_FORMAT: json (по умолчанию) или text
+	LogFile         string     // LOG_FILE: путь к файлу лога (пусто — без файла)
+	LogFileMaxMB    int64      // LOG_FILE_MAX_MB: размер файла до ротации
+	LogFileBackups  int        // LOG_FILE_BACKUPS: сколько старых файлов хранить
+	LogSheetsLevel  slog.Level // LOG_SHEETS_LEVEL: с какого уровня писать в «Логи_Сервера» / «Логи_Ошибок»
+	LogSheetsPerMin int        // LOG_SHEETS_PER_MIN: не больше стольких запросов записи логов в минуту
+
+	MinFreeMB       int64         // MIN_FREE_MB: минимум свободного места во временном каталоге для скачивания
+	CleanupMaxAge   time.Duration // TMP_CLEANUP_MAX_AGE: временные файлы старше удаляются
+	CleanupInterval time.Duration // TMP_CLEANUP_INTERVAL: как часто чистить временный каталог
+
+	Timeouts Timeouts
+
+	DownloadWorkers int // DOWNLOAD_WORKERS: сколько скачиваний идёт одновременно (на все боты)
+
+	Tenant  string    // имя бота из [tenants.<имя>]; "" — основной
+	Tenants []*Config // дополнительные боты (только у конфигурации основного)
+
+	ConfigFile string            // прочитанный файл конфигурации ("" — без файла)
+	sources    map[string]string // ключ настройки -> откуда значение (для config print)
+}
+
+// Timeouts — таймауты обработчиков и запуска.
+type Timeouts struct {
+	Request  time.Duration // короткие операции пользователя: заявка, пожелание, /mystatus, deep link
+	Action   time.Duration // действия админов, уведомления, /whatsnew
+	Long     time.Duration // список документов категории, /stats, опрос статусов IMO
+	Download time.Duration // скачивание и отправка документа, архив категории
+	Doctor   time.Duration // /doctor
+	Startup  time.Duration // EnsureSchema при старте
+	Shutdown time.Duration // запись накопленного при остановке
+}
+
+// TelegramMaxBytes — лимит размера документа для отправки в байтах.
+func (c *Config) TelegramMaxBytes() int64 { return c.TelegramMaxMB * 1024 * 1024 }
+
+// MinFreeBytes — минимум свободного места в байтах.
+func (c *Config) MinFreeBytes() int64 { return c.MinFreeMB * 1024 * 1024 }
+
+// configField — одна настройка: ключ в файле, переменные окружения и значение по умолчанию.
+type configField struct {
+	Key     string   // «раздел.имя» в файле
+	Env     []string // переменные окружения; первая — основная, остальные — прежние имена
+	Default string
+	Int     bool   // в файле — число (иначе строка)
+	Secret  bool   // в config print маскируется
+	Restart bool   // применяется только при запуске; при перезагрузке (SIGHUP, /reloadconfig) нужен перезапуск
+	Shared  bool   // общая для всех ботов процесса; в [tenants.<имя>] не задаётся
+	Own     bool   // у каждого бота своя: дополнительные боты не наследуют значение основного
+	Doc     string // описание для config print и bugchat.example.toml
+	set     func(c *Config, v string) error
+	get     func(c *Config) string
+}
+
+var configFields = []configField{
+	own(restart(secret(strField("telegram.bot_token", "BOT_TOKEN", "", "токен от @BotFather", func(c *Config) *string { return &c.BotToken })))),
+	{Key: "telegram.bot_username", Own: true, Env: []string{"BOT_USERNAME"}, Doc: "юзернейм бота без @ — для ссылок t.me/<бот>?start=…",
+		set: func(c *Config, v string) error { c.BotUsername = strings.TrimPrefix(v, "@"); return nil },
+		get: func(c *Config) string { return c.BotUsername }},
+	intField("telegram.max_upload_mb", "TELEGRAM_MAX_MB", int64(50), 1, "наибольший документ, который бот отправляет файлом (50 — лимит api.telegram.org)", func(c *Config) *int64 { return &c.TelegramMaxMB }),
+
+	own(restart(strField("sheets.spreadsheet_id", "SPREADSHEET_ID", "", "ID Google Таблицы из URL", func(c *Config) *string { return &c.SpreadsheetID }))),
+	restart(strField("sheets.credentials_path", "CREDENTIALS_PATH", "credentials.json", "JSON-ключ Service Account; adc — Application Default Credentials (нет файла по умолчанию — тоже ADC)", func(c *Config) *string { return &c.CredentialsPath })),
+	restart(secret(strField("sheets.credentials_json", "GOOGLE_CREDENTIALS_JSON", "", "JSON-ключ целиком или в base64 вместо файла", func(c *Config) *string { return &c.CredentialsJSON }))),
+	intField("sheets.requests_per_min", "SHEETS_REQUESTS_PER_MIN", sheetsDefaultPerMin, 0, "бюджет запросов к Sheets в минуту, 0 — без учёта", func(c *Config) *int { return &c.SheetsPerMin }),
+	intField("sheets.cache_ttl_min", "CACHE_TTL_MIN", 5, 1, "сколько минут держать тексты, категории и админов в памяти", func(c *Config) *int { return &c.CacheTTLMin }),
+
+	intField("yandex.max_mb", "YANDEX_MAX_MB", int64(50), 1, "наибольший файл с Яндекс.Диска", func(c *Config) *int64 { return &c.YandexMaxMB }),
+	{Key: "delivery.mode", Env: []string{"DELIVERY_MODE"}, Default: deliveryZip, Doc: "zip, original или auto — для документов без своей «Доставки»",
+		set: func(c *Config, v string) error {
+			m := parseDeliveryMode(v)
+			if m == "" {
+				return fmt.Errorf("%q — нужно zip, original или auto", v)
+			}
+			c.DeliveryMode = m
+			return nil
+		},
+		get: func(c *Config) string { return c.DeliveryMode }},
+
+	shared(restart(intField("downloads.workers", "DOWNLOAD_WORKERS", 4, 1, "сколько документов и архивов готовится одновременно (на все боты)", func(c *Config) *int { return &c.DownloadWorkers }))),
+
+	{Key: "http.addr", Restart: true, Shared: true, Env: []string{"HTTP_ADDR", "METRICS_ADDR"}, Doc: "адрес для /metrics, /healthz, /readyz, например 127.0.0.1:9090 (пусто — выключено)",
+		set: func(c *Config, v string) error {
+			if v != "" && !strings.Contains(v, ":") {
+				return fmt.Errorf("%q — нужен адрес вида host:port или :port", v)
+			}
+			c.HTTPAddr = v
+			return nil
+		},
+		get: func(c *Config) string { return c.HTTPAddr }},
+
+	restart(strField("backup.dir", "BACKUP_DIR", "", "каталог резервных копий (пусто — без копий по расписанию)", func(c *Config) *string { return &c.BackupDir })),
+	{Key: "backup.interval_hours", Restart: true, Env: []string{"BACKUP_INTERVAL_HOURS"}, Default: "24", Int: true, Doc: "как часто делать копию, часов",
+		set: func(c *Config, v string) error {
+			n, err := parseIntMin(v, 1)
+			c.BackupInterval = time.Duration(n) * time.Hour
+			return err
+		},
+		get: func(c *Config) string { return strconv.Itoa(int(c.BackupInterval / time.Hour)) }},
+	restart(intField("backup.keep", "BACKUP_KEEP", 14, 0, "сколько последних копий хранить, 0 — все", func(c *Config) *int { return &c.BackupKeep })),
+
+	shared(levelField("log.level", "LOG_LEVEL", "уровень для stderr и файла: debug, info, warn, error", func(c *Config) *slog.Level { return &c.LogLevel })),
+	{Key: "log.format", Restart: true, Shared: true, Env: []string{"LOG_FORMAT"}, Default: "json", Doc: "json или text",
+		set: func(c *Config, v string) error {
+			v = strings.ToLower(v)
+			if v != "json" && v != "text" {
+				return fmt.Errorf("%q — нужно json или text", v)
+			}
+			c.LogFormat = v
+			return nil
+		},
+		get: func(c *Config) string { return c.LogFormat }},
+	shared(restart(strField("log.file", "LOG_FILE", "", "файл лога с ротацией (пусто — без файла)", func(c *Config) *string { return &c.LogFile }))),
+	shared(restart(intField("log.file_max_mb", "LOG_FILE_MAX_MB", int64(10), 1, "размер файла до ротации, МБ", func(c *Config) *int64 { return &c.LogFileMaxMB }))),
+	shared(restart(intField("log.file_backups", "LOG_FILE_BACKUPS", 5, 0, "сколько старых файлов хранить", func(c *Config) *int { return &c.LogFileBackups }))),
+	levelField("log.sheets_level", "LOG_SHEETS_LEVEL", "с какого уровня писать в «Логи_Сервера» / «Логи_Ошибок»", func(c *Config) *slog.Level { return &c.LogSheetsLevel }),
+	intField("log.sheets_per_min", "LOG_SHEETS_PER_MIN", 20, 1, "не больше стольких запросов записи логов в минуту", func(c *Config) *int { return &c.LogSheetsPerMin }),
+
+	shared(intField("files.min_free_mb", "MIN_FREE_MB", int64(100), 0, "минимум свободного места во временном каталоге для скачивания, МБ", func(c *Config) *int64 { return &c.MinFreeMB })),
+	shared(restart(durField("files.cleanup_max_age", "TMP_CLEANUP_MAX_AGE", 30*time.Minute, time.Minute, "временные файлы старше удаляются", func(c *Config) *time.Duration { return &c.CleanupMaxAge }))),
+	shared(restart(durField("files.cleanup_interval", "TMP_CLEANUP_INTERVAL", time.Hour, time.Minute, "как часто чистить временный каталог", func(c *Config) *time.Duration { return &c.CleanupInterval }))),
+
+	durField("timeouts.request", "TIMEOUT_REQUEST", 15*time.Second, time.Second, "заявка, пожелание, /mystatus, ссылка на документ", func(c *Config) *time.Duration { return &c.Timeouts.Request }),
+	durField("timeouts.action", "TIMEOUT_ACTION", 30*time.Second, time.Second, "действия админов, уведомления, /whatsnew", func(c *Config) *time.Duration { return &c.Timeouts.Action }),
+	durField("timeouts.long", "TIMEOUT_LONG", 45*time.Second, time.Second, "список документов категории, /stats, опрос статусов IMO", func(c *Config) *time.Duration { return &c.Timeouts.Long }),
+	durField("timeouts.download", "TIMEOUT_DOWNLOAD", 2*time.Minute, time.Second, "скачивание и отправка документа, архив категории", func(c *Config) *time.Duration { return &c.Timeouts.Download }),
+	durField("timeouts.doctor", "TIMEOUT_DOCTOR", 3*time.Minute, time.Second, "/doctor", func(c *Config) *time.Duration { return &c.Timeouts.Doctor }),
+	restart(durField("timeouts.startup", "TIMEOUT_STARTUP", 30*time.Second, time.Second, "создание листов и миграции при старте", func(c *Config) *time.Duration { return &c.Timeouts.Startup })),
+	shared(durField("timeouts.shutdown", "TIMEOUT_SHUTDOWN", 15*time.Second, time.Second, "запись накопленного при остановке", func(c *Config) *time.Duration { return &c.Timeouts.Shutdown })),
 }
 
-// LoadConfig загружает конфигурацию из .env-подобных переменных.
-// Переменные можно задать через .env файл (загрузка через godotenv) или в окружении.
+func strField(key, env, def, doc string, p func(*Config) *string) configField {
+	return configField{Key: key, Env: []string{env}, Default: def, Doc: doc,
+		set: func(c *Config, v string) error { *p(c) = v; return nil },
+		get: func(c *Config) string { return *p(c) }}
+}
+
+func secret(f configField) configField {
+	f.Secret = true
+	return f
+}
+
+func restart(f configField) configField {
+	f.Restart = true
+	return f
+}
+
+func shared(f configField) configField {
+	f.Shared = true
+	return f
+}
+
+func own(f configField) configField {
+	f.Own = true
+	return f
+}
+
+func intField[T int | int64](key, env string, def, min T, doc string, p func(*Config) *T) configField {
+	return configField{Key: key, Env: []string{env}, Default: fmt.Sprint(def), Int: true, Doc: doc,
+		set: func(c *Config, v string) error {
+			n, err := parseIntMin(v, int64(min))
+			*p(c) = T(n)
+			return err
+		},
+		get: func(c *Config) string { return fmt.Sprint(*p(c)) }}
+}
+
+func durField(key, env string, def, min time.Duration, doc string, p func(*Config) *time.Duration) configField {
+	return configField{Key: key, Env: []string{env}, Default: shortDuration(def), Doc: doc + " (например 30s, 5m, 1h)",
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%q — не длительность (например 30s, 5m, 1h)", v)
+			}
+			if d < min {
+				return fmt.Errorf("%s меньше %s", d, min)
+			}
+			*p(c) = d
+			return nil
+		},
+		get: func(c *Config) string { return shortDuration(*p(c)) }}
+}
+
+// shortDuration — «30m» вместо «30m0s», «1h» вместо «1h0m0s».
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func levelField(key, env, doc string, p func(*Config) *slog.Level) configField {
+	return configField{Key: key, Env: []string{env}, Default: "info", Doc: doc,
+		set: func(c *Config, v string) error {
+			l, ok := lookupLogLevel(v)
+			if !ok {
+				return fmt.Errorf("%q — нужно debug, info, warn или error", v)
+			}
+			*p(c) = l
+			return nil
+		},
+		get: func(c *Config) string { return strings.ToLower(p(c).String()) }}
+}
+
+// parseIntMin — целое не меньше min.
+func parseIntMin(v string, min int64) (int64, error) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q — не целое число", v)
+	}
+	if n < min {
+		return 0, fmt.Errorf("%d меньше %d", n, min)
+	}
+	return n, nil
+}
+
+// configFilePath — файл конфигурации: CONFIG_FILE или bugchat.toml в рабочем каталоге, если он есть.
+// explicit — путь задан явно (тогда отсутствие файла — ошибка).
+func configFilePath(getenv func(string) string) (path string, explicit bool) {
+	if p := strings.TrimSpace(getenv("CONFIG_FILE")); p != "" {
+		return p, true
+	}
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		return defaultConfigFile, false
+	}
+	return "", false
+}
+
+// LoadConfig собирает конфигурацию: умолчания, файл, файлы секретов (secrets.go), окружение
+// (.env загружает loadEnv в main).
+// Пустая переменная окружения считается незаданной. При ошибках возвращает их все одной ошибкой.
 func LoadConfig() (*Config, error) {
-	c := &Config{
-		BotToken:        os.Getenv("BOT_TOKEN"),
-		BotUsername:     strings.TrimSpace(strings.TrimPrefix(os.Getenv("BOT_USERNAME"), "@")),
-		SpreadsheetID:   strings.TrimSpace(os.Getenv("SPREADSHEET_ID")),
-		CredentialsPath: os.Getenv("CREDENTIALS_PATH"),
+	return loadConfig(os.Getenv)
+}
+
+// loadConfig — LoadConfig с заданным окружением (при перезагрузке — с заново прочитанным .env).
+func loadConfig(getenv func(string) string) (*Config, error) {
+	c := &Config{sources: make(map[string]string, len(configFields))}
+	byKey := make(map[string]*configField, len(configFields))
+	for i := range configFields {
+		f := &configFields[i]
+		byKey[f.Key] = f
+		if err := f.set(c, f.Default); err != nil {
+			panic(fmt.Sprintf("умолчание %s: %v", f.Key, err))
+		}
+		c.sources[f.Key] = sourceDefault
 	}
-	if c.CredentialsPath == "" {
-		c.CredentialsPath = "credentials.json"
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
 	}
 
-	// CACHE_TTL_MIN и YANDEX_MAX_MB — из .env, иначе 5 и 50
-	if v := os.Getenv("CACHE_TTL_MIN"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			c.CacheTTLMin = n
-		} else {
-			c.CacheTTLMin = 5
+	// fileValue — значение из файла для c; where — «файл:строка».
+	fileValue := func(c *Config, f *configField, k string, v confValue, where string) {
+		switch {
+		case f.Int && v.Kind != confInt:
+			problem("%s: %s: нужно число без кавычек", where, k)
+		case !f.Int && v.Kind != confString:
+			problem("%s: %s: нужна строка в кавычках", where, k)
+		default:
+			if err := f.set(c, strings.TrimSpace(v.Value)); err != nil {
+				problem("%s: %s: %v", where, k, err)
+			}
+			c.sources[f.Key] = where
 		}
-	} else {
-		c.CacheTTLMin = 5
 	}
-	if v := os.Getenv("YANDEX_MAX_MB"); v != "" {
-		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
-			c.YandexMaxMB = n
-		} else {
-			c.YandexMaxMB = 50
+	// envValues — файлы секретов и переменные окружения; env(name) — имя переменной для c.
+	envValues := func(c *Config, env func(string) string) {
+		for _, f := range configFields {
+			if f.Shared && c.Tenant != "" {
+				continue
+			}
+			if f.Secret && !envSet(f.Env, env, getenv) {
+				v, path, err := lookupSecretFile(env(f.Env[0]), getenv)
+				switch {
+				case err != nil:
+					problems = append(problems, err.Error())
+				case path != "":
+					if err := f.set(c, v); err != nil {
+						problem("%s: %v", path, err)
+					}
+					c.sources[f.Key] = path
+				}
+			}
+			for _, name := range f.Env {
+				name = env(name)
+				v := strings.TrimSpace(getenv(name))
+				if v == "" {
+					continue
+				}
+				if err := f.set(c, v); err != nil {
+					problem("%s: %v", name, err)
+				}
+				c.sources[f.Key] = "$" + name
+				break
+			}
 		}
-	} else {
-		c.YandexMaxMB = 50
 	}
 
+	type tenantValue struct {
+		key   string // полный ключ в файле
+		v     confValue
+		where string
+	}
+	tenantFile := make(map[string][]tenantValue) // имя бота -> его ключи из файла
+	if path, explicit := configFilePath(getenv); path != "" {
+		values, errs, err := readConfigFile(path)
+		switch {
+		case err != nil && !explicit && errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			problems = append(problems, err.Error())
+		default:
+			c.ConfigFile = path
+			problems = append(problems, errs...)
+			for k := range values {
+				if f, ok := byKey[tenantFieldKey(k)]; ok && f.Secret {
+					warnSecretPerm(path)
+					break
+				}
+			}
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool { return values[keys[i]].Line < values[keys[j]].Line })
+			for _, k := range keys {
+				v := values[k]
+				where := fmt.Sprintf("%s:%d", path, v.Line)
+				if name, _, ok := splitTenantKey(k); ok {
+					tenantFile[name] = append(tenantFile[name], tenantValue{k, v, where})
+					continue
+				}
+				f, ok := byKey[k]
+				if !ok {
+					problem("%s: неизвестный ключ %s", where, k)
+					continue
+				}
+				fileValue(c, f, k, v, where)
+			}
+		}
+	}
+	envValues(c, func(name string) string { return name })
+
+	// Дополнительные боты: [tenants.<имя>.<раздел>] в файле и TENANTS в окружении.
+	names := make(map[string]bool)
+	for name := range tenantFile {
+		names[name] = true
+	}
+	for _, name := range strings.FieldsFunc(getenv("TENANTS"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		names[name] = true
+	}
+	for name := range names {
+		if !reTenantName.MatchString(name) {
+			problem("бот %q: имя — строчные латинские буквы, цифры, _ и -", name)
+			continue
+		}
+		t := c.clone()
+		t.Tenant = name
+		for _, f := range configFields {
+			if f.Own {
+				_ = f.set(t, f.Default)
+				t.sources[f.Key] = sourceDefault
+			}
+		}
+		if c.BackupDir != "" {
+			t.BackupDir = filepath.Join(c.BackupDir, name)
+		}
+		for _, tv := range tenantFile[name] {
+			_, k, _ := splitTenantKey(tv.key)
+			f, ok := byKey[k]
+			switch {
+			case !ok:
+				problem("%s: неизвестный ключ %s", tv.where, tv.key)
+			case f.Shared:
+				problem("%s: %s задаётся для всех ботов сразу — перенесите в [%s]", tv.where, tv.key, strings.SplitN(k, ".", 2)[0])
+			default:
+				fileValue(t, f, tv.key, tv.v, tv.where)
+			}
+		}
+		envValues(t, func(env string) string { return tenantEnv(name, env) })
+		c.Tenants = append(c.Tenants, t)
+	}
+	sort.Slice(c.Tenants, func(i, j int) bool { return c.Tenants[i].Tenant < c.Tenants[j].Tenant })
+	if len(c.Tenants) > 0 {
+		tokens := map[string]string{c.BotToken: "основного бота"}
+		sheetIDs := map[string]string{c.SpreadsheetID: "основного бота"}
+		for _, t := range c.Tenants {
+			switch {
+			case t.BotToken == "":
+				problem("бот %s: нужен токен (tenants.%s.telegram.bot_token или $%s)", t.Tenant, t.Tenant, tenantEnv(t.Tenant, "BOT_TOKEN"))
+			case tokens[t.BotToken] != "":
+				problem("бот %s: токен совпадает с токеном %s", t.Tenant, tokens[t.BotToken])
+			default:
+				tokens[t.BotToken] = "бота " + t.Tenant
+			}
+			switch {
+			case t.SpreadsheetID == "":
+				problem("бот %s: нужна своя таблица (tenants.%s.sheets.spreadsheet_id или $%s)", t.Tenant, t.Tenant, tenantEnv(t.Tenant, "SPREADSHEET_ID"))
+			case sheetIDs[t.SpreadsheetID] != "":
+				problem("бот %s: таблица совпадает с таблицей %s", t.Tenant, sheetIDs[t.SpreadsheetID])
+			default:
+				sheetIDs[t.SpreadsheetID] = "бота " + t.Tenant
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return c, fmt.Errorf("неверная конфигурация:\n  - %s", strings.Join(problems, "\n  - "))
+	}
 	return c, nil
 }
+
+var reTenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// splitTenantKey разбирает «tenants.<имя>.<раздел>.<ключ>» на имя бота и ключ настройки.
+func splitTenantKey(k string) (name, key string, ok bool) {
+	rest, found := strings.CutPrefix(k, "tenants.")
+	if !found {
+		return "", "", false
+	}
+	name, key, _ = strings.Cut(rest, ".")
+	return name, key, true
+}
+
+// tenantFieldKey — ключ настройки без «tenants.<имя>.».
+func tenantFieldKey(k string) string {
+	if _, key, ok := splitTenantKey(k); ok {
+		return key
+	}
+	return k
+}
+
+// tenantEnv — переменная окружения настройки бота name: TENANT_<ИМЯ>_<ПЕРЕМЕННАЯ>.
+func tenantEnv(name, env string) string {
+	return "TENANT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_" + env
+}
+
+// clone — копия конфигурации без списка ботов.
+func (c *Config) clone() *Config {
+	n := *c
+	n.Tenants = nil
+	n.sources = make(map[string]string, len(c.sources))
+	for k, v := range c.sources {
+		n.sources[k] = v
+	}
+	return &n
+}
+
+// TenantConfig — конфигурация бота name ("" — основного).
+func (c *Config) TenantConfig(name string) (*Config, bool) {
+	if name == "" {
+		return c, true
+	}
+	for _, t := range c.Tenants {
+		if t.Tenant == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// TenantNames — имена дополнительных ботов.
+func (c *Config) TenantNames() []string {
+	out := make([]string, 0, len(c.Tenants))
+	for _, t := range c.Tenants {
+		out = append(out, t.Tenant)
+	}
+	return out
+}
+
+// configEntry — настройка для config print.
+type configEntry struct {
+	Key     string `json:"key"`
+	Env     string `json:"env"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+	Secret  bool   `json:"secret,omitempty"`
+	Restart bool   `json:"restart,omitempty"`
+	Doc     string `json:"doc"`
+}
+
+// Entries — действующие значения по порядку configFields; секреты замаскированы.
+func (c *Config) Entries() []configEntry {
+	out := make([]configEntry, 0, len(configFields))
+	for _, f := range configFields {
+		v := f.get(c)
+		if f.Secret && v != "" {
+			v = maskSecret(v)
+		}
+		env := f.Env[0]
+		if c.Tenant != "" && !f.Shared {
+			env = tenantEnv(c.Tenant, env)
+		}
+		out = append(out, configEntry{Key: f.Key, Env: env, Value: v, Source: c.sources[f.Key], Secret: f.Secret, Restart: f.Restart, Doc: f.Doc})
+	}
+	return out
+}
+
+// maskSecret оставляет только длину значения.
+func maskSecret(s string) string {
+	return fmt.Sprintf("*** (%d симв.)", len([]rune(s)))
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Чтение bugchat.toml и .env без внешних библиотек.
+//
+// Из TOML поддерживается то, что нужно конфигурации: таблицы [раздел], ключи «имя = значение»,
+// строки "…" (с \n, \t, \", \\, \uXXXX) и '…', целые числа (с _), true/false и комментарии #.
+// Массивы, вложенные таблицы и многострочные строки — ошибка с номером строки.
+
+// Виды значений в файле.
+const (
+	confString = iota
+	confInt
+	confBool
+)
+
+// confValue — значение из файла: текст, вид и строка файла.
+type confValue struct {
+	Value string
+	Kind  int
+	Line  int
+}
+
+var (
+	reConfKey = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+	reConfInt = regexp.MustCompile(`^[+-]?[0-9](_?[0-9])*$`)
+	reEnvKey  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// readConfigFile читает файл конфигурации. errs — синтаксические ошибки (все, с номерами строк);
+// err — файл не прочитан.
+func readConfigFile(path string) (values map[string]confValue, errs []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("файл конфигурации: %w", err)
+	}
+	values, errs = parseConfigTOML(data)
+	for i := range errs {
+		errs[i] = path + ":" + errs[i]
+	}
+	return values, errs, nil
+}
+
+// parseConfigTOML разбирает TOML; ключи возвращаются полными («раздел.имя»).
+func parseConfigTOML(data []byte) (map[string]confValue, []string) {
+	values := make(map[string]confValue)
+	var errs []string
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%d: ", line)+fmt.Sprintf(format, args...))
+	}
+	if !utf8.Valid(data) {
+		return nil, []string{"0: файл не в UTF-8"}
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	section := ""
+	tables := make(map[string]bool)
+	for i, raw := range strings.Split(text, "\n") {
+		n := i + 1
+		line := strings.TrimSpace(strings.TrimSuffix(raw, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if strings.HasPrefix(line, "[[") || end < 0 || !isConfComment(line[end+1:]) {
+				fail(n, "неверный заголовок раздела %s", line)
+				continue
+			}
+			name := strings.TrimSpace(line[1:end])
+			if !reConfKey.MatchString(name) {
+				fail(n, "неверное имя раздела %q", name)
+				continue
+			}
+			if tables[name] {
+				fail(n, "раздел [%s] уже был", name)
+			}
+			tables[name] = true
+			section = name
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			fail(n, "ожидается «ключ = значение»")
+			continue
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !reConfKey.MatchString(key) {
+			fail(n, "неверный ключ %q", key)
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		v, err := parseConfigValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			fail(n, "%s: %v", key, err)
+			continue
+		}
+		if prev, dup := values[key]; dup {
+			fail(n, "%s уже задан в строке %d", key, prev.Line)
+			continue
+		}
+		v.Line = n
+		values[key] = v
+	}
+	return values, errs
+}
+
+// parseConfigValue разбирает значение до конца строки (вместе с комментарием).
+func parseConfigValue(s string) (confValue, error) {
+	switch {
+	case s == "" || strings.HasPrefix(s, "#"):
+		return confValue{}, fmt.Errorf("нет значения")
+	case strings.HasPrefix(s, `"""`), strings.HasPrefix(s, "'''"):
+		return confValue{}, fmt.Errorf("многострочные строки не поддерживаются")
+	case s[0] == '"' || s[0] == '\'':
+		v, rest, err := unquote(s, false)
+		if err != nil {
+			return confValue{}, err
+		}
+		if !isConfComment(rest) {
+			return confValue{}, fmt.Errorf("лишнее после строки: %s", strings.TrimSpace(rest))
+		}
+		return confValue{Value: v, Kind: confString}, nil
+	case s[0] == '[' || s[0] == '{':
+		return confValue{}, fmt.Errorf("массивы и вложенные таблицы не поддерживаются")
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch {
+	case s == "true" || s == "false":
+		return confValue{Value: s, Kind: confBool}, nil
+	case reConfInt.MatchString(s):
+		return confValue{Value: strings.ReplaceAll(s, "_", ""), Kind: confInt}, nil
+	}
+	return confValue{}, fmt.Errorf("неверное значение %s (строки — в кавычках)", s)
+}
+
+// isConfComment — после значения только пробелы или комментарий.
+func isConfComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// errUnclosed — нет закрывающей кавычки.
+var errUnclosed = errors.New("строка не закрыта")
+
+// unquote читает строку в кавычках в начале s: "…" с escape-последовательностями или '…' как есть.
+// rest — остаток после закрывающей кавычки. multiline — строка может содержать переводы строк (.env).
+func unquote(s string, multiline bool) (v, rest string, err error) {
+	q := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == q:
+			return b.String(), s[i+1:], nil
+		case c == '\n' && !multiline:
+			return "", "", errUnclosed
+		case c == '\\' && q == '"':
+			if i+1 >= len(s) {
+				return "", "", errUnclosed
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '\'', '$':
+				b.WriteByte(s[i])
+			case 'u':
+				if i+4 >= len(s) {
+					return "", "", fmt.Errorf("неверная последовательность \\u")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", "", fmt.Errorf("неверная последовательность \\u%s", s[i+1:i+5])
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return "", "", fmt.Errorf("неизвестная последовательность \\%c", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errUnclosed
+}
+
+// envPair — переменная из .env.
+type envPair struct {
+	Key, Value string
+	Line       int
+}
+
+// parseDotEnv разбирает .env: «KEY=value», «export KEY=value», комментарии # (в начале строки или
+// после пробела у значения без кавычек), "…" с escape-последовательностями и '…' как есть — обе
+// могут занимать несколько строк, # внутри кавычек — часть значения. Ошибки — все, с номерами строк.
+func parseDotEnv(data []byte) ([]envPair, []string) {
+	lines := strings.Split(strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n"), "\n")
+	var pairs []envPair
+	var errs []string
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		s := strings.TrimSpace(lines[i])
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		s = strings.TrimSpace(strings.TrimPrefix(s, "export "))
+		eq := strings.Index(s, "=")
+		if eq <= 0 {
+			errs = append(errs, fmt.Sprintf("строка %d: ожидается KEY=value", n))
+			continue
+		}
+		key := strings.TrimSpace(s[:eq])
+		if !reEnvKey.MatchString(key) {
+			errs = append(errs, fmt.Sprintf("строка %d: неверное имя переменной %q", n, key))
+			continue
+		}
+		val := strings.TrimLeft(s[eq+1:], " \t")
+		if val == "" || (val[0] != '"' && val[0] != '\'') {
+			for j := 1; j < len(val); j++ {
+				if val[j] == '#' && (val[j-1] == ' ' || val[j-1] == '\t') {
+					val = val[:j]
+					break
+				}
+			}
+			pairs = append(pairs, envPair{Key: key, Value: strings.TrimSpace(val), Line: n})
+			continue
+		}
+		// Значение в кавычках может продолжаться на следующих строках.
+		v, rest, err := unquote(val, true)
+		for errors.Is(err, errUnclosed) && i+1 < len(lines) {
+			i++
+			val += "\n" + strings.TrimSuffix(lines[i], "\r")
+			v, rest, err = unquote(val, true)
+		}
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("строка %d: %s: %v", n, key, err))
+		case !isConfComment(rest):
+			errs = append(errs, fmt.Sprintf("строка %d: %s: лишнее после закрывающей кавычки", n, key))
+		default:
+			pairs = append(pairs, envPair{Key: key, Value: v, Line: n})
+		}
+	}
+	return pairs, errs
+}
+
+// dotEnvKeys — переменные, взятые из .env, в том числе совпадающие с ним на старте (systemd передаёт
+// .env через EnvironmentFile). При перезагрузке конфигурации их значения читаются из .env заново.
+var dotEnvKeys = make(map[string]bool)
+
+// readDotEnv читает .env из рабочего каталога. Нет файла — nil без ошибки; синтаксические ошибки
+// возвращаются все сразу. .env с секретом, доступный на чтение всем, — ошибка.
+func readDotEnv() ([]envPair, error) {
+	data, err := os.ReadFile(".env")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pairs, errs := parseDotEnv(data)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("ошибки в .env:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	for _, p := range pairs {
+		if isSecretEnv(p.Key) && p.Value != "" {
+			warnSecretPerm(".env")
+			break
+		}
+	}
+	return pairs, nil
+}
+
+// loadEnv загружает .env в окружение. Уже заданные переменные окружения не перезаписываются.
+func loadEnv() error {
+	pairs, err := readDotEnv()
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		switch os.Getenv(p.Key) {
+		case "":
+			_ = os.Setenv(p.Key, p.Value)
+			dotEnvKeys[p.Key] = true
+		case p.Value:
+			dotEnvKeys[p.Key] = true
+		}
+	}
+	return nil
+}
+
+// reloadDotEnv перечитывает .env для перезагрузки конфигурации. getenv — окружение процесса, в котором
+// взятые из .env переменные заменены новым содержимым файла (удалённые из файла — пусты); commit
+// переносит его в окружение процесса — после того как новая конфигурация прошла проверку.
+func reloadDotEnv() (getenv func(string) string, commit func(), err error) {
+	pairs, err := readDotEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	fresh := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		if dotEnvKeys[p.Key] || os.Getenv(p.Key) == "" {
+			fresh[p.Key] = p.Value
+		}
+	}
+	getenv = func(k string) string {
+		if v, ok := fresh[k]; ok {
+			return v
+		}
+		if dotEnvKeys[k] {
+			return ""
+		}
+		return os.Getenv(k)
+	}
+	commit = func() {
+		for k := range dotEnvKeys {
+			if _, ok := fresh[k]; !ok {
+				_ = os.Unsetenv(k)
+				delete(dotEnvKeys, k)
+			}
+		}
+		for k, v := range fresh {
+			_ = os.Setenv(k, v)
+			dotEnvKeys[k] = true
+		}
+	}
+	return getenv, commit, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Перезагрузка конфигурации без перезапуска (SIGHUP, /reloadconfig): .env и файл конфигурации
+// читаются заново, и если всё верно — новая конфигурация подменяет старую целиком. Лимиты, таймауты,
+// TTL кэша, бюджет Sheets и уровни логов применяются сразу; настройки с Restart (токен, таблица,
+// HTTP-адрес, файл лога, копии, очистка) остаются прежними до перезапуска — о них сообщается отдельно.
+
+// reloadMu — одна перезагрузка за раз: .env и окружение общие для всех ботов процесса.
+var reloadMu sync.Mutex
+
+// liveConfig — действующая конфигурация работающего бота (основного или из [tenants.<имя>]).
+type liveConfig struct {
+	cur     atomic.Pointer[Config]
+	tenants []string      // дополнительные боты при запуске: их добавление и удаление — перезапуском
+	apply   func(*Config) // передаёт новые значения работающим компонентам (кэш, загрузчик, квота, логи)
+}
+
+func newLiveConfig(cfg *Config, tenants []string, apply func(*Config)) *liveConfig {
+	l := &liveConfig{tenants: tenants, apply: apply}
+	l.cur.Store(cfg)
+	return l
+}
+
+// Get — действующая конфигурация. Её нельзя изменять: при перезагрузке подменяется указатель.
+func (l *liveConfig) Get() *Config { return l.cur.Load() }
+
+// configChange — изменённая при перезагрузке настройка; у секретов значения замаскированы.
+type configChange struct {
+	Key      string
+	Old, New string
+	Restart  bool // вступит в силу после перезапуска
+}
+
+// Reload перечитывает .env и файл конфигурации и берёт из них настройки своего бота. При ошибке
+// ничего не меняется.
+func (l *liveConfig) Reload() ([]configChange, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	getenv, commit, err := reloadDotEnv()
+	if err != nil {
+		return nil, err
+	}
+	root, err := loadConfig(getenv)
+	if err != nil {
+		return nil, err
+	}
+	old := l.cur.Load()
+	next, ok := root.TenantConfig(old.Tenant)
+	if !ok {
+		return nil, fmt.Errorf("бота %s больше нет в конфигурации — он остановится при перезапуске", old.Tenant)
+	}
+	var changes []configChange
+	if was, now := strings.Join(l.tenants, ", "), strings.Join(root.TenantNames(), ", "); was != now {
+		changes = append(changes, configChange{Key: "tenants", Old: was, New: now, Restart: true})
+	}
+	for _, f := range configFields {
+		ov, nv := f.get(old), f.get(next)
+		if ov == nv {
+			continue
+		}
+		if f.Restart {
+			// До перезапуска работает прежнее значение — так config в памяти совпадает с поведением.
+			_ = f.set(next, ov)
+			next.sources[f.Key] = old.sources[f.Key]
+		}
+		if f.Secret {
+			ov, nv = maskSet(ov), maskSet(nv)
+		}
+		changes = append(changes, configChange{Key: f.Key, Old: ov, New: nv, Restart: f.Restart})
+	}
+	commit()
+	l.cur.Store(next)
+	if l.apply != nil {
+		l.apply(next)
+	}
+	return changes, nil
+}
+
+// formatConfigChanges — отчёт о перезагрузке для администратора на языке t.
+func formatConfigChanges(t tr, changes []configChange) string {
+	quoteEmpty := func(s string) string {
+		if s == "" {
+			return t.T(keyКонфигПусто)
+		}
+		return s
+	}
+	var applied, pending []string
+	for _, c := range changes {
+		line := fmt.Sprintf("• %s: %s → %s", c.Key, quoteEmpty(c.Old), quoteEmpty(c.New))
+		if c.Restart {
+			pending = append(pending, line)
+		} else {
+			applied = append(applied, line)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(t.T(keyКонфигПеречитана))
+	if len(changes) == 0 {
+		b.WriteString("\n" + t.T(keyКонфигБезИзменений))
+	}
+	if len(applied) > 0 {
+		b.WriteString("\n\n" + t.T(keyКонфигПрименено) + "\n" + strings.Join(applied, "\n"))
+	}
+	if len(pending) > 0 {
+		b.WriteString("\n\n" + t.T(keyКонфигНуженПерезапуск) + "\n" + strings.Join(pending, "\n"))
+	}
+	return b.String()
+}
+
+// changedKeys — ключи изменённых настроек для журнала: применённые и ждущие перезапуска.
+func changedKeys(changes []configChange) (applied, pending []string) {
+	for _, c := range changes {
+		if c.Restart {
+			pending = append(pending, c.Key)
+		} else {
+			applied = append(applied, c.Key)
+		}
+	}
+	return applied, pending
+}
+
+// maskSet маскирует непустой секрет; пустой остаётся пустым.
+func maskSet(s string) string {
+	if s == "" {
+		return ""
+	}
+	return maskSecret(s)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Режимы доставки одиночного документа: колонка «Доставка» в «Документы» или DELIVERY_MODE в .env.
+const (
+	deliveryZip      = "zip"      // архив ZIP (как раньше)
+	deliveryOriginal = "original" // исходный файл с исходным именем
+	deliveryAuto     = "auto"     // исходный файл для PDF, офисных документов и картинок, иначе ZIP
+)
+
+// deliveryAliases — допустимые значения «Доставка» / DELIVERY_MODE (без учёта регистра).
+var deliveryAliases = map[string]string{
+	"zip":      deliveryZip,
+	"архив":    deliveryZip,
+	"original": deliveryOriginal,
+	"оригинал": deliveryOriginal,
+	"файл":     deliveryOriginal,
+	"auto":     deliveryAuto,
+	"авто":     deliveryAuto,
+}
+
+// parseDeliveryMode возвращает режим доставки или "", если значение пустое или неизвестное.
+func parseDeliveryMode(s string) string {
+	return deliveryAliases[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// deliveryModeFor — режим доставки документа: из колонки «Доставка», иначе глобальный, иначе zip.
+func deliveryModeFor(d *Document, cfg *Config) string {
+	if m := parseDeliveryMode(d.Доставка); m != "" {
+		return m
+	}
+	if cfg != nil && cfg.DeliveryMode != "" {
+		return cfg.DeliveryMode
+	}
+	return deliveryZip
+}
+
+// officeMIME — MIME-типы офисных форматов, которых может не быть в системной таблице mime.
+var officeMIME = map[string]string{
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".rtf":  "application/rtf",
+}
+
+// originalMIMEPrefixes — типы, которые в режиме auto отправляются без архива.
+var originalMIMEPrefixes = []string{
+	"application/pdf",
+	"image/",
+	"text/plain",
+	"application/rtf",
+	"application/msword",
+	"application/vnd.ms-excel",
+	"application/vnd.ms-powerpoint",
+	"application/vnd.openxmlformats-officedocument.",
+	"application/vnd.oasis.opendocument.",
+}
+
+// detectMIME определяет MIME-тип по расширению имени файла, а без расширения — по содержимому.
+func detectMIME(filename string, data []byte) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if t, ok := officeMIME[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); ext != "" && t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// sendsOriginal — отправлять ли файл без архива в режиме mode.
+func sendsOriginal(mode, filename string, data []byte) bool {
+	switch mode {
+	case deliveryOriginal:
+		return true
+	case deliveryAuto:
+		return originalMIME(detectMIME(filename, data))
+	}
+	return false
+}
+
+// sourceSendsOriginal — как sendsOriginal, но до скачивания: по имени и Content-Type источника
+// (YandexDownloader.GetFileInfo). Без расширения в имени решает Content-Type; тип неизвестен — ZIP.
+func sourceSendsOriginal(mode string, info YandexFileInfo) bool {
+	switch mode {
+	case deliveryOriginal:
+		return true
+	case deliveryAuto:
+		if filepath.Ext(info.Name) == "" {
+			return info.MIME != "" && originalMIME(info.MIME)
+		}
+		return originalMIME(detectMIME(info.Name, nil))
+	}
+	return false
+}
+
+// originalMIME — тип из originalMIMEPrefixes.
+func originalMIME(t string) bool {
+	for _, p := range originalMIMEPrefixes {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// originalFileName — имя исходного файла для отправки: имя с Яндекса, а если его нет — название документа
+// с расширением из ссылки.
+func originalFileName(yandexName, docName, link string) string {
+	if n := sanitizeBulkFilename(filepath.Base(yandexName)); n != "" && n != "document" && n != "." {
+		return n
+	}
+	name := sanitizeZipName(docName)
+	if filepath.Ext(name) == "" {
+		name += filepath.Ext(strings.SplitN(link, "?", 2)[0])
+	}
+	return name
+}
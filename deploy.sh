@@ -1,11 +1,19 @@
 #!/bin/bash
 # deploy.sh — автообновление и перезапуск. Запускать на сервере из папки проекта.
 # Использование: ./deploy.sh
+#
+# Если задан http.addr (HTTP_ADDR в .env или в bugchat.toml), после запуска ждём /readyz
+# (до READY_TIMEOUT секунд, по умолчанию 90). Адрес берётся из ./app config print --json.
+# Не дождались — откат: прежний бинарник (app.prev) и прежний коммит, перезапуск, выход с кодом 1.
+# Коммит, который не собрался или не прошёл /readyz, записывается в .deploy_failed и больше не
+# разворачивается, пока в origin/main не появится новый коммит.
 
 set -e
 PROJECT_DIR="$(cd "$(dirname "$0")" && pwd)"
 cd "$PROJECT_DIR"
 
+READY_TIMEOUT="${READY_TIMEOUT:-90}"
+
 git fetch origin
 LOCAL=$(git rev-parse HEAD 2>/dev/null || true)
 REMOTE=$(git rev-parse origin/main 2>/dev/null || true)
@@ -20,22 +28,80 @@ if [ "$LOCAL" = "$REMOTE" ]; then
   exit 0
 fi
 
-echo "Обнаружены изменения. Останавливаю file_manager..."
-systemctl stop file_manager || true
+FAILED_FILE=.deploy_failed
+if [ -f "$FAILED_FILE" ] && [ "$(cat "$FAILED_FILE")" = "$REMOTE" ]; then
+  echo "Версия $(git rev-parse --short "$REMOTE") уже не прошла развёртывание — жду нового коммита. Выход."
+  exit 0
+fi
 
 git pull origin main
 
 echo "Сборка..."
 export PATH="$PATH:/usr/local/go/bin"
-go build -o app .
+if ! go build -o app.new .; then
+  echo "Сборка не удалась. Возврат к $LOCAL, сервис не трогаю."
+  echo "$REMOTE" > "$FAILED_FILE"
+  git reset --hard "$LOCAL"
+  exit 1
+fi
+
+# Бот не запускается, если файлы с секретами доступны на чтение всем (secrets.go).
+chmod 600 .env credentials.json bugchat.toml 2>/dev/null || true
 
-echo "Запуск file_manager..."
+echo "Перезапуск file_manager..."
+systemctl stop file_manager || true
+if [ -f app ]; then cp -f app app.prev; fi
+mv -f app.new app
 systemctl start file_manager
 
+# http_addr печатает действующий http.addr (переменные, .env и bugchat.toml — как у самого бота).
+http_addr() {
+  local out
+  out=$(./app config print --json 2>/dev/null) || return 0
+  if command -v jq >/dev/null 2>&1; then
+    printf '%s' "$out" | jq -r '.settings[] | select(.key == "http.addr") | .value'
+  else
+    printf '%s\n' "$out" | grep -A2 '"key": "http.addr"' | sed -n 's/.*"value": "\(.*\)",*$/\1/p'
+  fi
+}
+
+# wait_ready ждёт 200 от /readyz; без http.addr проверка пропускается.
+wait_ready() {
+  local addr
+  addr=$(http_addr)
+  if [ -z "$addr" ]; then
+    echo "http.addr не задан — проверка /readyz пропущена."
+    return 0
+  fi
+  local url="http://${addr/#:/127.0.0.1:}/readyz"
+  local deadline=$((SECONDS + READY_TIMEOUT))
+  while [ $SECONDS -lt $deadline ]; do
+    if curl -fsS -m 10 "$url" >/dev/null 2>&1; then
+      return 0
+    fi
+    sleep 3
+  done
+  curl -sS -m 10 "$url" || true
+  return 1
+}
+
 HASH=$(git rev-parse --short HEAD)
+if ! wait_ready; then
+  OLD=$(git rev-parse --short "$LOCAL")
+  echo "Бот не готов за ${READY_TIMEOUT} с. Откат на $OLD..."
+  echo "$REMOTE" > "$FAILED_FILE"
+  systemctl stop file_manager || true
+  if [ -f app.prev ]; then mv -f app.prev app; fi
+  git reset --hard "$LOCAL"
+  systemctl start file_manager
+  # Прежний бинарник может не знать подкоманд — флаг -log понимают обе версии
+  ./app -log "Откат: версия $HASH не прошла /readyz, возврат на $OLD" 2>/dev/null || true
+  exit 1
+fi
+
+rm -f "$FAILED_FILE"
 echo "Запись в Логи_Сервера: Обновление до версии $HASH"
-# Вызов приложения в режиме -log для записи в Google Sheets
-if [ -f .env ]; then set -a; . ./.env; set +a; fi
-./app -log "Обновление до версии $HASH" 2>/dev/null || true
+# Запись в Google Sheets командой log
+./app log "Обновление до версии $HASH" 2>/dev/null || true
 
 echo "Готово. Версия: $HASH"
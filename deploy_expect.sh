@@ -1,9 +1,13 @@
 #!/usr/bin/expect -f
-# Деплой с автоматической подстановкой пароля. Запуск: ./deploy_expect.sh
-# Пароль: 12345678 (при смене — поменять в переменной pass)
+# Деплой с автоматической подстановкой пароля. Запуск: DEPLOY_PASSWORD=... ./deploy_expect.sh
+# Пароль в репозитории не хранится. Лучше ключ SSH (ssh-copy-id) и finish_deploy.sh — без пароля.
 
 set timeout 120
-set pass "12345678"
+if {![info exists env(DEPLOY_PASSWORD)] || $env(DEPLOY_PASSWORD) eq ""} {
+    puts "Задайте пароль в DEPLOY_PASSWORD или настройте вход по ключу SSH и запустите ./finish_deploy.sh"
+    exit 1
+}
+set pass $env(DEPLOY_PASSWORD)
 set host "root@45.8.145.249"
 set dir "/opt/bugchat"
 set script_dir [file dirname [info script]]
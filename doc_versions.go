@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	whatsNewDays  = 30 // «Что нового»: документы, обновлённые за последние N дней
+	whatsNewLimit = 15 // не больше стольких документов в списке
+)
+
+// docDownloadLink — deep-link на скачивание документа по ID_Документа (пусто без BOT_USERNAME или ID).
+// ID не меняется при удалении и переносе документов, поэтому выданные ссылки остаются верными.
+func docDownloadLink(app *App, docID string) string {
+	botUsername := strings.TrimSpace(strings.TrimPrefix(app.GetConfig().BotUsername, "@"))
+	if botUsername == "" || docID == "" {
+		return ""
+	}
+	return "https://t.me/" + botUsername + "?start=" + deepLinkDoc + docID
+}
+
+// onWhatsNew — кнопка «Что нового»: документы, добавленные или обновлённые за whatsNewDays дней
+// (по колонке «Обновлён»), доступные пользователю. Свежие — сверху.
+func onWhatsNew(c tele.Context, app *App) error {
+	t := trFor(c, app)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+	docs, err := app.Sheets.GetDocuments(ctx)
+	if err != nil {
+		logFor(c, app).Error("GetDocuments whats new", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаДокументов))
+	}
+	cats, _ := app.GetCategories()
+	catNames := make(map[string]string)
+	for _, cat := range cats {
+		catNames[cat.ID] = cat.Name
+	}
+	v := viewerOf(c, app)
+	since := time.Now().AddDate(0, 0, -whatsNewDays)
+
+	type entry struct {
+		d    Document
+		at   time.Time
+		link string
+	}
+	var list []entry
+	for _, d := range docs {
+		at := parseSheetTime(d.Обновлён)
+		if at.IsZero() || at.Before(since) || !docHasSource(d) {
+			continue
+		}
+		if !categoryVisible(app, d.IDКатегории, v) || !accessAllows(d.Доступ, v) {
+			continue
+		}
+		list = append(list, entry{d: d, at: at, link: docDownloadLink(app, d.ID)})
+	}
+	if len(list) == 0 {
+		return c.Send(t.T(keyНовогоНет, "{дней}", strconv.Itoa(whatsNewDays)))
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].at.After(list[j].at) })
+	if len(list) > whatsNewLimit {
+		list = list[:whatsNewLimit]
+	}
+	var blocks []string
+	for _, e := range list {
+		block := "<b>" + html.EscapeString(e.d.Название) + "</b>"
+		if name := catNames[e.d.IDКатегории]; name != "" {
+			block += " — " + html.EscapeString(name)
+		}
+		block += "\n" + html.EscapeString(t.T(keyВерсияОт, "{версия}", strconv.Itoa(e.d.Версия), "{дата}", e.at.Format("02.01.2006")))
+		if e.link != "" {
+			block += "\n<a href=\"" + html.EscapeString(e.link) + "\">" + html.EscapeString(t.T(keyСсылкаСкачать)) + "</a>"
+		}
+		blocks = append(blocks, block)
+	}
+	return c.Send(t.T(keyЧтоНового)+"\n\n"+strings.Join(blocks, "\n\n"), tele.ModeHTML, tele.NoPreview)
+}
+
+// admNotifyDownloaders сообщает о текущей версии документа d тем, кто успешно скачивал его (лист
+// «Скачивания»), но только более раннюю версию. Пользователи, потерявшие доступ к документу, пропускаются.
+func admNotifyDownloaders(ctx context.Context, c tele.Context, app *App, d *Document) error {
+	t := trFor(c, app)
+	latest, err := app.Sheets.GetDocumentDownloaders(ctx, d.ID)
+	if err != nil {
+		logFor(c, app).Error("GetDocumentDownloaders", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаСкачавших))
+	}
+	if len(latest) == 0 {
+		return c.Send(t.T(keyНиктоНеСкачивал, "{название}", d.Название))
+	}
+	var ids []int64
+	for id, v := range latest {
+		if v < d.Версия {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return c.Send(t.T(keyВсеСТекущейВерсией, "{название}", d.Название, "{версия}", strconv.Itoa(d.Версия)))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	link := docDownloadLink(app, d.ID)
+	// Сообщение — на языке получателя.
+	msgFor := func(ut tr) string {
+		msg := ut.T(keyУведомлениеОбновлён, "{название}", html.EscapeString(d.Название), "{версия}", strconv.Itoa(d.Версия))
+		if link != "" {
+			msg += "\n<a href=\"" + html.EscapeString(link) + "\">" + html.EscapeString(ut.T(keyСсылкаНоваяВерсия)) + "</a>"
+		}
+		return msg
+	}
+	sent := 0
+	for _, id := range ids {
+		v := viewer{ID: id}
+		if app.GetRole != nil {
+			v.Role = app.GetRole(id, "")
+		}
+		if app.GetUserTags != nil {
+			v.Tags = app.GetUserTags(id)
+		}
+		if !categoryVisible(app, d.IDКатегории, v) || !accessAllows(d.Доступ, v) {
+			continue
+		}
+		if _, err := c.Bot().Send(&tele.Chat{ID: id}, msgFor(trUser(app, id)), tele.ModeHTML, tele.NoPreview); err != nil {
+			logFor(c, app).Error("notify doc update", "err", err, "chat_id", id)
+			continue
+		}
+		sent++
+	}
+	return c.Send(t.T(keyУведомленияОтправлены, "{название}", d.Название, "{отправлено}", strconv.Itoa(sent), "{всего}", strconv.Itoa(len(ids))))
+}
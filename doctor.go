@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Проверка таблицы (-validate и /doctor): листы и колонки против sheetHeaders, ссылки между листами,
+// повторы ID, пустые названия, неверные ссылки и file_id. Только чтение — таблица не меняется.
+
+// Уровни замечаний.
+const (
+	issueError = "ошибка"         // бот работает неправильно: пустые списки, битые кнопки
+	issueWarn  = "предупреждение" // бот работает, но стоит поправить
+)
+
+// doctorIssue — одно замечание. Row — строка листа (1 — заголовок, 0 — весь лист).
+type doctorIssue struct {
+	Level string `json:"level"`
+	Sheet string `json:"sheet"`
+	Row   int    `json:"row"`
+	Text  string `json:"text"`
+}
+
+// doctorReport — итог проверки.
+type doctorReport struct {
+	Issues  []doctorIssue  `json:"issues"`
+	Checked map[string]int `json:"checked"` // лист -> проверено строк данных
+}
+
+func (r *doctorReport) add(level, sheet string, row int, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, doctorIssue{Level: level, Sheet: sheet, Row: row, Text: fmt.Sprintf(format, args...)})
+}
+
+// Errors — число замечаний уровня «ошибка».
+func (r *doctorReport) Errors() int {
+	n := 0
+	for _, is := range r.Issues {
+		if is.Level == issueError {
+			n++
+		}
+	}
+	return n
+}
+
+// reFileID — допустимый вид Telegram file_id (base64url без выравнивания).
+var reFileID = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+
+// fileChecker проверяет file_id в Telegram; nil — только проверка по таблице.
+type fileChecker func(fileID string) error
+
+// botFileChecker — проверка file_id через getFile. Ошибкой считается только «неверный file_id»:
+// «файл слишком большой» означает, что файл есть.
+func botFileChecker(b *tele.Bot) fileChecker {
+	return func(fileID string) error {
+		_, err := b.FileByID(fileID)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "file_id") {
+			return err
+		}
+		return nil
+	}
+}
+
+// runDoctor проверяет таблицу. Ошибка — только если таблицу не удалось прочитать вовсе.
+func runDoctor(ctx context.Context, api *SheetsAPI, files fileChecker) (*doctorReport, error) {
+	rep := &doctorReport{Checked: map[string]int{}}
+	sp, err := api.getSpreadsheet(ctx, "sheets.properties.title")
+	if err != nil {
+		return nil, fmt.Errorf("Spreadsheets.Get: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, sh := range sp.Sheets {
+		if sh.Properties != nil {
+			existing[sh.Properties.Title] = true
+		}
+	}
+	for title := range existing {
+		if _, ok := sheetHeaders[title]; !ok && title != sheetSchema {
+			rep.add(issueWarn, title, 0, "лист не из схемы (переименован?) — бот его не читает")
+		}
+	}
+	if !existing[sheetSchema] {
+		rep.add(issueWarn, sheetSchema, 0, "нет листа версий схемы — миграции ещё не применялись, запустите бота")
+	} else if v, err := api.SchemaVersion(ctx); err == nil && v < latestSchemaVersion() {
+		rep.add(issueWarn, sheetSchema, 0, "версия схемы %d, эта сборка ожидает %d — миграции применятся при старте бота", v, latestSchemaVersion())
+	}
+
+	tables := make(map[string]*table)
+	for _, sheet := range sortedSheets() {
+		if !existing[sheet] {
+			rep.add(issueError, sheet, 0, "листа нет — данные из него не читаются (создаётся при старте бота)")
+			continue
+		}
+		t, err := api.readTable(ctx, sheet)
+		if err != nil {
+			return nil, err
+		}
+		hdr, err := api.headerRow(ctx, sheet)
+		if err != nil {
+			return nil, err
+		}
+		checkColumns(rep, sheet, hdr)
+		tables[sheet] = t
+		rep.Checked[sheet] = len(t.rows)
+	}
+
+	catIDs := checkCategories(rep, tables[sheetКатегории])
+	history := historyFileIDs(tables[sheetИсторияДок])
+	checkDocuments(rep, tables[sheetДокументы], catIDs, history, files)
+	checkUniqueColumn(rep, tables[sheetЗаявкиIMO], "ID_Заявки")
+	checkUniqueColumn(rep, tables[sheetДоступы], "ID")
+	checkUniqueColumn(rep, tables[sheetПользователи], "ID_Пользователя")
+	checkAdmins(rep, tables[sheetАдмины])
+
+	sort.SliceStable(rep.Issues, func(i, j int) bool {
+		a, b := rep.Issues[i], rep.Issues[j]
+		if a.Level != b.Level {
+			return a.Level == issueError
+		}
+		if a.Sheet != b.Sheet {
+			return a.Sheet < b.Sheet
+		}
+		return a.Row < b.Row
+	})
+	return rep, nil
+}
+
+// checkColumns сравнивает заголовок листа со схемой: недостающие, лишние, повторённые,
+// устаревшие названия и порядок колонок.
+func checkColumns(rep *doctorReport, sheet string, hdr []string) {
+	want := sheetHeaders[sheet]
+	known := make(map[string]bool, len(want))
+	for _, h := range want {
+		known[h] = true
+	}
+	seen := make(map[string]int)
+	var order []string
+	for i, h := range hdr {
+		if h == "" {
+			continue
+		}
+		c := canonicalHeader(h)
+		col := colToLetter(i + 1)
+		if c != h {
+			rep.add(issueWarn, sheet, 1, "колонка %s: устаревшее название «%s» (сейчас «%s») — переименует миграция", col, h, c)
+		}
+		if prev, dup := seen[c]; dup {
+			rep.add(issueError, sheet, 1, "колонка %s: «%s» повторяется (первая — %s), вторая не читается", col, c, colToLetter(prev+1))
+			continue
+		}
+		seen[c] = i
+		if !known[c] {
+			rep.add(issueWarn, sheet, 1, "колонка %s: «%s» не из схемы — бот её не использует", col, h)
+			continue
+		}
+		order = append(order, c)
+	}
+	for _, h := range want {
+		if _, ok := seen[h]; !ok {
+			rep.add(issueError, sheet, 1, "нет колонки «%s»", h)
+		}
+	}
+	// Порядок известных колонок: бот ищет их по названию, но люди и импорт — часто по букве.
+	pos := make(map[string]int, len(want))
+	for i, h := range want {
+		pos[h] = i
+	}
+	for i := 1; i < len(order); i++ {
+		if pos[order[i]] < pos[order[i-1]] {
+			rep.add(issueWarn, sheet, 1, "порядок колонок не по схеме: «%s» стоит после «%s» (ожидается: %s)",
+				order[i], order[i-1], strings.Join(want, ", "))
+			break
+		}
+	}
+}
+
+// checkCategories — пустые названия и повторы ID. Возвращает множество ID категорий.
+func checkCategories(rep *doctorReport, t *table) map[string]bool {
+	ids := make(map[string]bool)
+	if t == nil {
+		return ids
+	}
+	first := make(map[string]int)
+	for i, row := range t.rows {
+		line := i + 2
+		name, id := t.get(row, "Название"), t.get(row, "ID")
+		if name == "" && id == "" {
+			continue
+		}
+		if name == "" {
+			rep.add(issueError, t.sheet, line, "пустое «Название» у категории %s — категория не показывается", id)
+		}
+		if id == "" {
+			continue
+		}
+		if prev, dup := first[id]; dup {
+			rep.add(issueError, t.sheet, line, "ID %s повторяется (первая — строка %d): документы попадут не в ту категорию", id, prev)
+			continue
+		}
+		first[id] = line
+		ids[id] = true
+	}
+	return ids
+}
+
+// historyFileIDs — file_id прежних версий по документам из «История_Документов».
+func historyFileIDs(t *table) map[string]map[string]string {
+	out := make(map[string]map[string]string)
+	if t == nil {
+		return out
+	}
+	for _, row := range t.rows {
+		docID := t.get(row, "ID_Документа")
+		if docID == "" {
+			continue
+		}
+		for _, col := range []string{"Telegram_File_ID", "Telegram_File_ID_Оригинал"} {
+			if f := t.get(row, col); f != "" {
+				if out[docID] == nil {
+					out[docID] = make(map[string]string)
+				}
+				out[docID][f] = t.get(row, "Версия")
+			}
+		}
+	}
+	return out
+}
+
+// checkDocuments — категории, названия, повторы ID, ссылки, режим доставки и file_id.
+func checkDocuments(rep *doctorReport, t *table, catIDs map[string]bool, history map[string]map[string]string, files fileChecker) {
+	if t == nil {
+		return
+	}
+	first := make(map[string]int)
+	for i, row := range t.rows {
+		line := i + 2
+		cat, name, link := t.get(row, docColКатегория), t.get(row, docColНазвание), t.get(row, docColСсылка)
+		id := t.get(row, docColID)
+		if cat == "" && name == "" {
+			continue
+		}
+		switch {
+		case cat == "":
+			rep.add(issueError, t.sheet, line, "пустой «ID_Категории» — документ не виден ни в одной категории")
+		case !catIDs[cat]:
+			rep.add(issueError, t.sheet, line, "категории %s нет в «Категории» — документ не виден", cat)
+		}
+		if name == "" {
+			rep.add(issueError, t.sheet, line, "пустое «Название» — кнопка документа будет без подписи")
+		}
+		if id != "" {
+			if prev, dup := first[id]; dup {
+				rep.add(issueError, t.sheet, line, "ID_Документа %s повторяется (первая — строка %d)", id, prev)
+			} else {
+				first[id] = line
+			}
+		}
+		if link != "" && !isHTTPURL(link) {
+			rep.add(issueError, t.sheet, line, "«Ссылка» не http(s)-адрес: %s", truncateRunes(link, 60))
+		}
+		fileID, orig := t.get(row, docColFileID), t.get(row, docColFileIDOrig)
+		if link == "" && fileID == "" {
+			rep.add(issueError, t.sheet, line, "нет ни «Ссылка», ни «Telegram_File_ID» — скачать нечего")
+		}
+		if m := t.get(row, docColДоставка); m != "" && parseDeliveryMode(m) == "" {
+			rep.add(issueWarn, t.sheet, line, "неизвестная «Доставка» «%s» — используется DELIVERY_MODE", m)
+		}
+		for _, f := range []struct{ col, val string }{{docColFileID, fileID}, {docColFileIDOrig, orig}} {
+			if f.val == "" {
+				continue
+			}
+			if !reFileID.MatchString(f.val) {
+				rep.add(issueError, t.sheet, line, "«%s» не похож на file_id Telegram", f.col)
+				continue
+			}
+			if v, old := history[id][f.val]; old && id != "" {
+				rep.add(issueError, t.sheet, line, "«%s» — файл прежней версии %s: пользователи получат старый документ", f.col, v)
+				continue
+			}
+			if files != nil {
+				if err := files(f.val); err != nil {
+					rep.add(issueError, t.sheet, line, "«%s» не найден в Telegram (%v) — очистите ячейку, файл скачается заново", f.col, err)
+				}
+			}
+		}
+	}
+}
+
+// checkUniqueColumn — повторы значений колонки col (пустые не считаются).
+func checkUniqueColumn(rep *doctorReport, t *table, col string) {
+	if t == nil {
+		return
+	}
+	first := make(map[string]int)
+	for i, row := range t.rows {
+		v := t.get(row, col)
+		if v == "" {
+			continue
+		}
+		if prev, dup := first[v]; dup {
+			rep.add(issueError, t.sheet, i+2, "«%s» %s повторяется (первая — строка %d)", col, v, prev)
+			continue
+		}
+		first[v] = i + 2
+	}
+}
+
+// checkAdmins — строки без юзернейма и ID_Чата и неизвестные роли.
+func checkAdmins(rep *doctorReport, t *table) {
+	if t == nil {
+		return
+	}
+	for i, row := range t.rows {
+		user, chat, role := t.get(row, "Юзернейм"), t.get(row, "ID_Чата"), t.get(row, "Роль")
+		if user == "" && chat == "" {
+			if role != "" {
+				rep.add(issueError, t.sheet, i+2, "нет ни «Юзернейм», ни «ID_Чата»")
+			}
+			continue
+		}
+		if role != "" && parseRole(role) == "" {
+			rep.add(issueError, t.sheet, i+2, "неизвестная роль «%s» — строка игнорируется", role)
+		}
+	}
+}
+
+// formatDoctorText — отчёт для консоли (-validate).
+func formatDoctorText(rep *doctorReport) string {
+	var b strings.Builder
+	for _, is := range rep.Issues {
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", is.Level, issuePlace(is), is.Text)
+	}
+	fmt.Fprintf(&b, "Итого: ошибок %d, предупреждений %d.\n", rep.Errors(), len(rep.Issues)-rep.Errors())
+	return b.String()
+}
+
+// doctorMaxIssues — сколько замечаний показывать в /doctor (лимит сообщения Telegram — 4096 символов).
+const doctorMaxIssues = 30
+
+// formatDoctorHTML — отчёт для /doctor на языке t.
+func formatDoctorHTML(t tr, rep *doctorReport) string {
+	errs := rep.Errors()
+	if len(rep.Issues) == 0 {
+		total := 0
+		for _, n := range rep.Checked {
+			total += n
+		}
+		return t.T(keyПроверкаВПорядке, "{листов}", strconv.Itoa(len(rep.Checked)), "{строк}", strconv.Itoa(total))
+	}
+	var b strings.Builder
+	b.WriteString(t.T(keyПроверкаИтог, "{ошибок}", strconv.Itoa(errs), "{предупреждений}", strconv.Itoa(len(rep.Issues)-errs)) + "\n")
+	for i, is := range rep.Issues {
+		if i == doctorMaxIssues {
+			b.WriteString("\n" + t.T(keyПроверкаЕщё, "{число}", strconv.Itoa(len(rep.Issues)-i)))
+			break
+		}
+		mark := "⚠️"
+		if is.Level == issueError {
+			mark = "❌"
+		}
+		place := is.Sheet
+		switch {
+		case is.Row == 1:
+			place = t.T(keyПроверкаЗаголовок, "{лист}", is.Sheet)
+		case is.Row > 1:
+			place = t.T(keyПроверкаСтрока, "{лист}", is.Sheet, "{строка}", strconv.Itoa(is.Row))
+		}
+		fmt.Fprintf(&b, "\n%s %s: %s", mark, html.EscapeString(place), html.EscapeString(is.Text))
+	}
+	return b.String()
+}
+
+// issuePlace — «Лист, строка N» или «Лист, заголовок» (для консоли).
+func issuePlace(is doctorIssue) string {
+	switch is.Row {
+	case 0:
+		return is.Sheet
+	case 1:
+		return is.Sheet + ", заголовок"
+	}
+	return fmt.Sprintf("%s, строка %d", is.Sheet, is.Row)
+}
+
+// onDoctor — /doctor [files]: проверка таблицы; с files — ещё и file_id через Telegram (медленно).
+func onDoctor(c tele.Context, app *App) error {
+	t := trFor(c, app)
+	arg := strings.TrimSpace(strings.TrimPrefix(c.Text(), "/doctor"))
+	var files fileChecker
+	if arg == "files" {
+		files = botFileChecker(c.Bot())
+	} else if arg != "" {
+		return c.Send(t.T(keyПроверкаИспользование))
+	}
+	_ = c.Send(t.T(keyПроверкаИдёт))
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Doctor)
+	defer cancel()
+	rep, err := runDoctor(ctx, app.Sheets, files)
+	if err != nil {
+		logFor(c, app).Error("runDoctor", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаПроверки))
+	}
+	return c.Send(formatDoctorHTML(t, rep), tele.ModeHTML)
+}
+
+// truncateRunes обрезает s до n символов с «…».
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -10,15 +10,42 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	tele "gopkg.in/telebot.v3"
 )
 
-var ErrArchiveTooLarge = errors.New("archive exceeds 50 MB")
+var (
+	ErrArchiveTooLarge = errors.New("archive exceeds 50 MB")
+	ErrNoBulkFiles     = errors.New("no files downloaded for archive")
+)
+
+// downloadPool — общая для всех ботов процесса очередь подготовки файлов: одновременно выполняется
+// не больше workers задач, остальные ждут. Таймаут задачи отсчитывается с её начала, не с постановки.
+type downloadPool struct {
+	slots chan struct{}
+}
+
+func newDownloadPool(workers int) *downloadPool {
+	return &downloadPool{slots: make(chan struct{}, workers)}
+}
 
-// BulkItem — URL и имя файла для bulk-архива.
+// Go ставит task в очередь; kind — метка bugchat_download_queue_depth (single, bulk).
+func (p *downloadPool) Go(kind string, task func()) {
+	mDownloadQueue.Add(kind, 1)
+	go func() {
+		defer mDownloadQueue.Add(kind, -1)
+		p.slots <- struct{}{}
+		defer func() { <-p.slots }()
+		task()
+	}()
+}
+
+// BulkItem — URL (или Telegram file_id) и имя файла для bulk-архива.
 type BulkItem struct {
 	URL      string
+	FileID   string // если задан — файл скачивается из Telegram (bot.File), URL не используется
 	Filename string
 }
 
@@ -52,21 +79,23 @@ func sanitizeBulkFilename(s string) string {
 }
 
 // BulkDownloadAndZip последовательно скачивает файлы в /tmp/bulk_{uuid}/, упаковывает в ZIP.
-// maxArchiveBytes — лимит суммы размеров (50 МБ); при превышении — ErrArchiveTooLarge.
+// Элементы с FileID скачиваются из Telegram через bot (лимит Bot API на getFile — 20 МБ): если getFile
+// отказал, элемент пропускается, его индекс попадает в skipped, а архив собирается из остальных.
+// maxArchiveBytes — лимит суммы размеров (TELEGRAM_MAX_MB); при превышении — ErrArchiveTooLarge.
 // minFreeBytes — минимум свободного места для старта.
-// Возвращает (zipPath, bulkDir, nil). bulkDir нужно удалить (os.RemoveAll) после отправки.
-// При любой ошибке bulkDir очищается внутри и возвращается ("", "", err).
-func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, items []BulkItem, categoryName string, maxArchiveBytes, minFreeBytes int64) (zipPath, bulkDir string, err error) {
-	if yandex == nil || len(items) == 0 {
-		return "", "", fmt.Errorf("yandex or items empty")
+// Возвращает (zipPath, bulkDir, skipped, nil). bulkDir нужно удалить (os.RemoveAll) после отправки.
+// Пропущены все элементы — ErrNoBulkFiles (skipped заполнен). При любой ошибке bulkDir очищается внутри.
+func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, bot *tele.Bot, items []BulkItem, categoryName string, maxArchiveBytes, minFreeBytes int64) (zipPath, bulkDir string, skipped []int, err error) {
+	if len(items) == 0 {
+		return "", "", nil, fmt.Errorf("items empty")
 	}
 	tmp := os.TempDir()
 	if free, _ := getFreeSpaceBytes(tmp); free < uint64(minFreeBytes) {
-		return "", "", fmt.Errorf("not enough disk space")
+		return "", "", nil, fmt.Errorf("not enough disk space")
 	}
 	baseDir := filepath.Join(tmp, "bulk_"+uuid.New().String())
 	if err := os.MkdirAll(baseDir, 0700); err != nil {
-		return "", "", err
+		return "", "", nil, err
 	}
 	cleanup := func() { _ = os.RemoveAll(baseDir) }
 
@@ -79,6 +108,26 @@ func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, items []B
 		if base == "" {
 			base = "file_" + strconv.Itoa(i)
 		}
+		var tgFile *tele.File
+		if it.FileID != "" {
+			if bot == nil {
+				cleanup()
+				return "", "", nil, fmt.Errorf("bot is nil for file_id item")
+			}
+			f, err := bot.FileByID(it.FileID)
+			if err != nil {
+				// Обычно файл больше 20 МБ: его отдаст одиночная отправка по file_id.
+				skipped = append(skipped, i)
+				continue
+			}
+			tgFile = &f
+			if filepath.Ext(base) == "" {
+				base += filepath.Ext(f.FilePath)
+			}
+		} else if yandex == nil {
+			cleanup()
+			return "", "", nil, fmt.Errorf("yandex downloader is nil")
+		}
 		ext := filepath.Ext(base)
 		baseNoExt := strings.TrimSuffix(base, ext)
 		finalName := base
@@ -94,28 +143,38 @@ func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, items []B
 		used[finalName] = true
 		destPath := filepath.Join(baseDir, finalName)
 
-		n, err := yandex.DownloadToFile(ctx, it.URL, destPath)
+		var n int64
+		if tgFile != nil {
+			n, err = downloadTelegramFile(bot, tgFile, destPath, maxArchiveBytes)
+		} else {
+			n, err = yandex.DownloadToFile(ctx, it.URL, destPath)
+		}
 		if err != nil {
 			cleanup()
-			return "", "", err
+			return "", "", nil, err
 		}
 		total += n
 		if total > maxArchiveBytes {
 			cleanup()
-			return "", "", ErrArchiveTooLarge
+			return "", "", nil, ErrArchiveTooLarge
 		}
 		writtenPaths = append(writtenPaths, destPath)
 	}
+	if len(writtenPaths) == 0 {
+		cleanup()
+		return "", "", skipped, ErrNoBulkFiles
+	}
 
 	zipName := sanitizeCategoryForZip(categoryName) + ".zip"
 	if zipName == ".zip" {
 		zipName = "archive.zip"
 	}
 	zipPath = filepath.Join(baseDir, zipName)
+	defer mZipDuration.Since("bulk", time.Now())
 	zf, err := os.Create(zipPath)
 	if err != nil {
 		cleanup()
-		return "", "", err
+		return "", "", nil, err
 	}
 	zw := zip.NewWriter(zf)
 	for _, p := range writtenPaths {
@@ -126,14 +185,14 @@ func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, items []B
 			_ = zw.Close()
 			_ = zf.Close()
 			cleanup()
-			return "", "", err
+			return "", "", nil, err
 		}
 		f, err := os.Open(p)
 		if err != nil {
 			_ = zw.Close()
 			_ = zf.Close()
 			cleanup()
-			return "", "", err
+			return "", "", nil, err
 		}
 		_, _ = io.Copy(w, f)
 		_ = f.Close()
@@ -141,13 +200,54 @@ func BulkDownloadAndZip(ctx context.Context, yandex *YandexDownloader, items []B
 	if err := zw.Close(); err != nil {
 		_ = zf.Close()
 		cleanup()
-		return "", "", err
+		return "", "", nil, err
 	}
 	if err := zf.Close(); err != nil {
 		cleanup()
+		return "", "", nil, err
+	}
+	return zipPath, baseDir, skipped, nil
+}
+
+// downloadTelegramFile сохраняет файл из Telegram в destPath. Больше maxBytes — ErrArchiveTooLarge.
+func downloadTelegramFile(bot *tele.Bot, f *tele.File, destPath string, maxBytes int64) (int64, error) {
+	rc, err := bot.File(f)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	out, err := os.Create(destPath)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	n, err := io.Copy(out, io.LimitReader(rc, maxBytes+1))
+	if err != nil {
+		return 0, err
+	}
+	if n > maxBytes {
+		return 0, ErrArchiveTooLarge
+	}
+	return n, nil
+}
+
+// BytesToTemp сохраняет data во временную папку /tmp/single_{uuid}/ под именем filename (без архивации).
+// Возвращает (путь к файлу, путь к папке для RemoveAll).
+func BytesToTemp(data []byte, filename string) (path, dir string, err error) {
+	filename = filepath.Base(filename)
+	if filename == "" || filename == "." {
+		filename = "document"
+	}
+	dir = filepath.Join(os.TempDir(), "single_"+uuid.New().String())
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	path = filepath.Join(dir, filename)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		_ = os.RemoveAll(dir)
 		return "", "", err
 	}
-	return zipPath, baseDir, nil
+	return path, dir, nil
 }
 
 // ZipBytesToTemp создаёт во временной папке /tmp/single_{uuid}/ файл из data, упаковывает его в ZIP.
@@ -172,6 +272,7 @@ func ZipBytesToTemp(data []byte, innerFilename, zipFilename string) (zipPath, di
 		return "", "", err
 	}
 	zipPath = filepath.Join(dir, zipFilename)
+	defer mZipDuration.Since("single", time.Now())
 	zf, err := os.Create(zipPath)
 	if err != nil {
 		cleanup()
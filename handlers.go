@@ -5,13 +5,12 @@ import (
 	"encoding/base64"
 	"fmt"
 	"html"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	tele "gopkg.in/telebot.v3"
 )
@@ -22,97 +21,89 @@ const telegramMaxBytes = 50 * 1024 * 1024 // 50 МБ — лимит Telegram д
 type App struct {
 	Sheets        *SheetsAPI
 	Yandex        *YandexDownloader
-	Cfg           *Config
-	GetText       func(string) string
+	Downloads     *downloadPool  // общая для всех ботов очередь скачиваний
+	GetConfig     func() *Config // действующая конфигурация (меняется при перезагрузке — не запоминать)
+	Texts         func() textSet // тексты по языкам; для ответа пользователю — trFor / trUser
 	GetCategories func() ([]Category, error)
-	IsAdmin       func(chatID int64, username string) bool
+	GetRole       func(chatID int64, username string) Role // "" — не админ
+	GetUserTags   func(userID int64) map[string]bool
 	GetState      func(int64) string
 	SetState      func(int64, string)
 	ResetState    func(int64)
-	LogError      func(err, ctx string)
+	GetData       func(uid int64, key string) string // данные диалога (сбрасываются с ResetState)
+	SetData       func(uid int64, key, val string)
+	Log           *slog.Logger // общий логгер; в обработчиках — logFor(c, app) с полями апдейта
+	Users         *userIndex   // пользователи бота (users.go); рассылка /send — по нему
 	OnReload      func()
+	// ReloadConfig перечитывает .env и файл конфигурации (/reloadconfig, SIGHUP).
+	ReloadConfig func() ([]configChange, error)
+	// OnGrantsChanged перечитывает «Доступы» после одобрения или отзыва доступа.
+	OnGrantsChanged func()
 }
 
 // RegisterHandlers регистрирует все обработчики и middleware.
 func RegisterHandlers(b *tele.Bot, app *App) {
-	// Middleware: админские команды только для админов.
-	b.Use(func(next tele.HandlerFunc) tele.HandlerFunc {
-		return func(c tele.Context) error {
-			text := c.Text()
-			if text == "/send" || strings.HasPrefix(text, "/send ") || text == "/reload" {
-				u := ""
-				if c.Sender() != nil {
-					u = c.Sender().Username
-				}
-				if !app.IsAdmin(c.Chat().ID, u) {
-					return nil
-				}
-			}
-			return next(c)
-		}
-	})
+	// Middleware: логгер апдейта, метрики, регистрация пользователя, права на команды и inline-кнопки
+	// по таблице ролей (roles.go).
+	b.Use(loggingMiddleware(app), metricsMiddleware, usersMiddleware(app), commandGuard(app))
 
-	// /start — deep-link dl_XXX для скачивания или приветствие.
-	// Удаляем сообщение /start из чата, чтобы в истории не оставалось /start dl_UUID.
+	// /start — deep-link скачивания (doc_<ID_Документа> или прежний dl_…, см. handleDeepLink) или приветствие.
+	// Удаляем сообщение /start из чата, чтобы в истории не оставалось /start с ID документа.
 	b.Handle("/start", func(c tele.Context) error {
 		payload := strings.TrimSpace(strings.TrimPrefix(c.Text(), "/start"))
 		if c.Message() != nil {
 			_ = c.Bot().Delete(c.Message())
 		}
-		if strings.HasPrefix(payload, "dl_") {
+		if strings.HasPrefix(payload, deepLinkDoc) || strings.HasPrefix(payload, deepLinkLegacy) {
 			handleDeepLink(c, app)
 			return nil
 		}
 
-		log.Printf("[ /start] chat=%d", c.Chat().ID)
-		msg := app.GetText(keyПриветствие)
-		if msg == "" {
-			msg = "Добрый день!"
-		}
-		if err := c.Send(msg, mainMenuReply(app)); err != nil {
-			log.Printf("[ /start] Send failed: %v", err)
+		logFor(c, app).Info("/start", "chat_id", c.Chat().ID)
+		t := trFor(c, app)
+		if err := c.Send(t.T(keyПриветствие), mainMenuReply(t)); err != nil {
 			return err
 		}
 		if c.Sender() == nil {
 			return nil
 		}
 		app.ResetState(c.Sender().ID)
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
 		defer cancel()
-		if err := app.Sheets.EnsureUser(ctx, fmt.Sprintf("%d", c.Sender().ID), c.Sender().Username); err != nil {
-			app.LogError(err.Error(), "EnsureUser /start")
-		}
 		u := c.Sender().Username
-		if app.IsAdmin(c.Chat().ID, u) {
+		role := app.GetRole(c.Chat().ID, u)
+		if role != "" {
 			if err := app.Sheets.SetAdminChatID(ctx, u, c.Chat().ID); err != nil {
-				app.LogError(err.Error(), "SetAdminChatID")
+				logFor(c, app).Error("SetAdminChatID", "err", err)
 			}
-			setCommandsForChat(c.Bot(), c.Chat().ID, true)
-		} else {
-			setCommandsForChat(c.Bot(), c.Chat().ID, false)
 		}
+		setCommandsForChat(c.Bot(), c.Chat().ID, role, t)
 		return nil
 	})
 
 	// Текстовые кнопки главного меню и /send (сбрасывают FSM при смене раздела).
+	// Кнопка узнаётся по ключу текста (menuAction), а не по надписи на одном языке.
 	b.Handle(tele.OnText, func(c tele.Context) error {
 		txt := strings.TrimSpace(c.Text())
 		if txt == "/send" {
-			return c.Send("Использование: /send <текст рассылки>")
+			return c.Send(trFor(c, app).T(keyРассылкаИспользование))
 		}
 		if strings.HasPrefix(txt, "/send ") {
 			return onSend(c, app, strings.TrimSpace(strings.TrimPrefix(txt, "/send ")))
 		}
-		switch txt {
-		case "Список документов":
+		switch menuAction(app, txt) {
+		case "docs":
 			app.ResetState(c.Sender().ID)
 			return onListDocs(c, app, nil)
-		case "Пожелания":
+		case "wish":
 			app.ResetState(c.Sender().ID)
 			return onWishStart(c, app)
-		case "Запросить доступ в IMO":
+		case "imo":
 			app.ResetState(c.Sender().ID)
 			return onIMOStart(c, app)
+		case "new":
+			app.ResetState(c.Sender().ID)
+			return onWhatsNew(c, app)
 		}
 
 		// FSM: ожидание пожелания или IMO.
@@ -123,6 +114,9 @@ func RegisterHandlers(b *tele.Bot, app *App) {
 		case "imo":
 			return onIMOSubmit(c, app, txt)
 		}
+		if st := app.GetState(c.Sender().ID); strings.HasPrefix(st, "adm_") {
+			return onAdmText(c, app, st, txt)
+		}
 
 		return nil
 	})
@@ -149,6 +143,21 @@ func RegisterHandlers(b *tele.Bot, app *App) {
 			handleDlAll(c, app, strings.TrimPrefix(data, "dl_all|"))
 			return nil
 		}
+		if strings.HasPrefix(data, "imo_st|") {
+			return onIMOStatusCallback(c, app, strings.TrimPrefix(data, "imo_st|"))
+		}
+		if strings.HasPrefix(data, "acc_req|") {
+			return onAccessRequest(c, app, strings.TrimPrefix(data, "acc_req|"))
+		}
+		if strings.HasPrefix(data, "acc|") {
+			return onAccessDecision(c, app, strings.TrimPrefix(data, "acc|"))
+		}
+		if strings.HasPrefix(data, "adm|") {
+			return onAdmCallback(c, app, strings.TrimPrefix(data, "adm|"))
+		}
+		if strings.HasPrefix(data, "lang|") {
+			return onLangCallback(c, app, strings.TrimPrefix(data, "lang|"))
+		}
 		return nil
 	})
 
@@ -156,47 +165,93 @@ func RegisterHandlers(b *tele.Bot, app *App) {
 	b.Handle("/reload", func(c tele.Context) error {
 		return onReload(c, app)
 	})
-}
 
-func setCommandsForChat(b *tele.Bot, chatID int64, admin bool) {
-	cmds := []tele.Command{{Text: "start", Description: "Начать"}}
-	if admin {
-		cmds = append(cmds, tele.Command{Text: "send", Description: "Рассылка"}, tele.Command{Text: "reload", Description: "Сброс кэша"})
+	// /reloadconfig — перечитать .env и файл конфигурации (только owner), как SIGHUP.
+	b.Handle("/reloadconfig", func(c tele.Context) error {
+		return onReloadConfig(c, app)
+	})
+
+	// /stats — статистика скачиваний.
+	b.Handle("/stats", func(c tele.Context) error {
+		return onStats(c, app)
+	})
+
+	// /doctor — проверка таблицы (doctor.go).
+	b.Handle("/doctor", func(c tele.Context) error {
+		return onDoctor(c, app)
+	})
+
+	// /revoke — отзыв доступа к группе.
+	b.Handle("/revoke", func(c tele.Context) error {
+		return onRevoke(c, app)
+	})
+
+	// Управление категориями и документами (диалоги в admin_docs.go).
+	for _, op := range []string{"addcat", admOpAddDoc, admOpEditDoc, admOpDelDoc, admOpMoveDoc, admOpNotify} {
+		b.Handle("/"+op, func(c tele.Context) error {
+			return onAdmCommand(c, app, op)
+		})
 	}
-	scope := tele.CommandScope{Type: tele.CommandScopeChat, ChatID: chatID}
-	_ = b.SetCommands(cmds, scope)
+	// Файл от админа: источник документа в диалоге или начало /adddoc.
+	b.Handle(tele.OnDocument, func(c tele.Context) error {
+		return onAdmDocument(c, app)
+	})
+
+	// /cancel — выход из любого диалога.
+	b.Handle("/cancel", func(c tele.Context) error {
+		if c.Sender() == nil {
+			return nil
+		}
+		app.ResetState(c.Sender().ID)
+		t := trFor(c, app)
+		return c.Send(t.T(keyОтменено), mainMenuReply(t))
+	})
+
+	// /mystatus — статусы заявок IMO пользователя.
+	b.Handle("/mystatus", func(c tele.Context) error {
+		return onMyStatus(c, app)
+	})
+
+	// /lang — язык бота (i18n.go).
+	b.Handle("/lang", func(c tele.Context) error {
+		return onLang(c, app)
+	})
 }
 
-func mainMenuReply(app *App) *tele.ReplyMarkup {
+// mainMenuReply — клавиатура главного меню на языке пользователя.
+func mainMenuReply(t tr) *tele.ReplyMarkup {
 	m := &tele.ReplyMarkup{ResizeKeyboard: true}
 	m.Reply(
-		m.Row(m.Text("Список документов"), m.Text("Пожелания")),
-		m.Row(m.Text("Запросить доступ в IMO")),
+		m.Row(m.Text(t.T(keyКнопкаДокументы)), m.Text(t.T(keyКнопкаПожелания))),
+		m.Row(m.Text(t.T(keyКнопкаЧтоНового)), m.Text(t.T(keyКнопкаIMO))),
 	)
 	return m
 }
 
 func onListDocs(c tele.Context, app *App, editMsg *tele.Message) error {
+	t := trFor(c, app)
 	cats, err := app.GetCategories()
 	if err != nil {
-		app.LogError(err.Error(), "GetCategories")
-		return c.Send("Не удалось загрузить категории.")
-	}
-	desc := app.GetText(keyОписаниеДокументы)
-	if desc == "" {
-		desc = "Выберите категорию:"
+		logFor(c, app).Error("GetCategories", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаКатегорий))
 	}
+	cats = listedCategories(cats, viewerOf(c, app))
+	desc := t.T(keyОписаниеДокументы)
 	if len(cats) == 0 {
 		if editMsg != nil {
-			_, _ = c.Bot().Edit(editMsg, desc+"\n\nКатегории пока не добавлены.", tele.NoPreview)
+			_, _ = c.Bot().Edit(editMsg, desc+"\n\n"+t.T(keyКатегорийНет), tele.NoPreview)
 			return nil
 		}
-		return c.Send(desc+"\n\nКатегории пока не добавлены.", tele.NoPreview)
+		return c.Send(desc+"\n\n"+t.T(keyКатегорийНет), tele.NoPreview)
 	}
 	m := &tele.ReplyMarkup{}
 	var rows []tele.Row
 	for _, cat := range cats {
-		rows = append(rows, m.Row(m.Data(cat.Name, "cat", cat.ID)))
+		name := cat.Name
+		if cat.Locked {
+			name = "🔒 " + name
+		}
+		rows = append(rows, m.Row(m.Data(name, "cat", cat.ID)))
 	}
 	m.Inline(rows...)
 	if editMsg != nil {
@@ -211,59 +266,78 @@ func onListDocs(c tele.Context, app *App, editMsg *tele.Message) error {
 
 func onCategorySelect(c tele.Context, app *App, categoryID string) error {
 	_ = c.Respond(&tele.CallbackResponse{})
-	ctx, cancel := context.WithTimeout(context.Background(), 45*time.Second)
+	t := trFor(c, app)
+	v := viewerOf(c, app)
+	if cat, ok := findCategory(app, categoryID); !ok || !accessAllows(cat.Доступ, v) {
+		m := accessDeniedMarkup(t, cat, ok)
+		if c.Message() != nil {
+			_, _ = c.Bot().Edit(c.Message(), t.T(keyКатегорияНедоступна), m, tele.NoPreview)
+		} else {
+			_, _ = c.Bot().Send(c.Chat(), t.T(keyКатегорияНедоступна), m, tele.NoPreview)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Long)
 	defer cancel()
 	docs, err := app.Sheets.GetDocumentsByCategory(ctx, categoryID)
 	if err != nil {
-		app.LogError(err.Error(), "GetDocumentsByCategory")
+		logFor(c, app).Error("GetDocumentsByCategory", "err", err)
 		if c.Message() != nil {
-			_, _ = c.Bot().Edit(c.Message(), "Ошибка загрузки", tele.NoPreview)
+			_, _ = c.Bot().Edit(c.Message(), sheetsErrText(t, err, keyОшибкаЗагрузки), tele.NoPreview)
 		} else {
-			_, _ = c.Bot().Send(c.Chat(), "Ошибка загрузки", tele.NoPreview)
+			_, _ = c.Bot().Send(c.Chat(), sheetsErrText(t, err, keyОшибкаЗагрузки), tele.NoPreview)
 		}
 		return nil
 	}
-	if len(docs) == 0 {
+	// Индексы документов в ссылках — по полному списку категории (их ждут handleDeepLink и runProxyArchive),
+	// поэтому недоступные документы пропускаем, а не вырезаем из docs.
+	visible := make(map[int]bool)
+	for idx, d := range docs {
+		if accessAllows(d.Доступ, v) {
+			visible[idx] = true
+		}
+	}
+	if len(visible) == 0 {
 		m := &tele.ReplyMarkup{}
-		m.Inline(m.Row(m.Data("« Назад", "back_cats")))
+		m.Inline(m.Row(m.Data(t.T(keyКнопкаНазад), "back_cats")))
 		if c.Message() != nil {
-			_, _ = c.Bot().Edit(c.Message(), "В этой категории пока нет документов.", m, tele.NoPreview)
+			_, _ = c.Bot().Edit(c.Message(), t.T(keyДокументовНет), m, tele.NoPreview)
 		} else {
-			_, _ = c.Bot().Send(c.Chat(), "В этой категории пока нет документов.", m, tele.NoPreview)
+			_, _ = c.Bot().Send(c.Chat(), t.T(keyДокументовНет), m, tele.NoPreview)
 		}
 		return nil
 	}
 
-	desc := app.GetText(keyОписаниеДокументы)
+	// Над документами — только описание из таблицы: встроенное «Выберите категорию:» здесь не к месту.
 	var text string
-	if desc != "" {
+	if desc := t.Custom(keyОписаниеДокументы); desc != "" {
 		text = desc + "\n\n"
 	}
 
-	botUsername := strings.TrimSpace(strings.TrimPrefix(app.Cfg.BotUsername, "@"))
 	var blocks []string
 	for idx, d := range docs {
-		block := "Название: <b>" + html.EscapeString(d.Название) + "</b>\n\n"
-		block += "Описание: <i>" + html.EscapeString(d.Описание) + "</i>"
-		if link := strings.TrimSpace(d.Ссылка); link != "" && botUsername != "" {
-			payload := base64.URLEncoding.EncodeToString([]byte(categoryID + "|" + strconv.Itoa(idx)))
-			block += "\n\n<a href=\"https://t.me/" + html.EscapeString(botUsername) + "?start=dl_" + html.EscapeString(payload) + "\">Скачать файл</a>"
+		if !visible[idx] {
+			continue
+		}
+		block := t.T(keyДокументКарточка, "{название}", html.EscapeString(d.Название), "{описание}", html.EscapeString(d.Описание))
+		if link := docDownloadLink(app, d.ID); docHasSource(d) && link != "" {
+			block += "\n\n<a href=\"" + html.EscapeString(link) + "\">" + html.EscapeString(t.T(keyСсылкаСкачать)) + "</a>"
 		}
 		blocks = append(blocks, block)
 	}
 	text += strings.Join(blocks, "\n\n")
 
 	hasLink := false
-	for _, d := range docs {
-		if strings.TrimSpace(d.Ссылка) != "" {
+	for idx, d := range docs {
+		if visible[idx] && docHasSource(d) {
 			hasLink = true
 			break
 		}
 	}
 	markup := &tele.ReplyMarkup{}
-	btnBack := markup.Data("« Назад", "back_cats")
+	btnBack := markup.Data(t.T(keyКнопкаНазад), "back_cats")
 	if hasLink {
-		markup.Inline(markup.Row(markup.Data("Скачать все", "dl_all|"+categoryID), btnBack))
+		markup.Inline(markup.Row(markup.Data(t.T(keyКнопкаСкачатьВсе), "dl_all|"+categoryID), btnBack))
 	} else {
 		markup.Inline(markup.Row(btnBack))
 	}
@@ -278,80 +352,184 @@ func onCategorySelect(c tele.Context, app *App, categoryID string) error {
 	return c.Send(text, opts...)
 }
 
-// runProxyArchive: при наличии FileID — отправка по FileID; иначе скачивание с Яндекса, ZIP, отправка и сохранение File_ID.
+// docHasSource — есть ли у документа что скачивать: ссылка или файл в Telegram (File_ID без ссылки).
+func docHasSource(d Document) bool {
+	return strings.TrimSpace(d.Ссылка) != "" || strings.TrimSpace(d.FileID) != ""
+}
+
+// runProxyArchive: документ без ссылки с File_ID — отправка оригинального файла из Telegram;
+// при наличии сохранённого File_ID для режима доставки (deliveryModeFor) — отправка по нему; иначе скачивание
+// с Яндекса, отправка исходным файлом или ZIP и сохранение File_ID в колонку этого режима.
+// Каждая попытка (успех, ошибка или отдача ссылкой) записывается в «Скачивания» от имени userID.
 // Удаляет statusMsg и временные файлы. При свободном месте < 100 МБ или ошибках — краткие сообщения без лишних «Ссылка:».
-func runProxyArchive(ctx context.Context, bot *tele.Bot, chat tele.Recipient, app *App, categoryID string, idx int, statusMsg *tele.Message) {
+func runProxyArchive(ctx context.Context, bot *tele.Bot, chat tele.Recipient, app *App, userID int64, docID string, statusMsg *tele.Message) {
 	if statusMsg != nil {
 		defer func() { _ = bot.Delete(statusMsg) }()
 	}
+	t := trUser(app, userID)
 
-	docs, err := app.Sheets.GetDocumentsByCategory(ctx, categoryID)
-	if err != nil || idx < 0 || idx >= len(docs) {
+	d, err := app.Sheets.GetDocument(ctx, docID)
+	if err != nil {
+		app.Log.Error("GetDocument proxy", "err", err, "user_id", userID)
+		_, _ = bot.Send(chat, sheetsErrText(t, err, keyОшибкаФайла))
 		return
 	}
-	d := &docs[idx]
+	categoryID := d.IDКатегории
 	link := strings.TrimSpace(d.Ссылка)
 	docName := strings.TrimSpace(d.Название)
 	if docName == "" {
 		docName = "document"
 	}
+	if link == "" && d.FileID == "" {
+		return
+	}
+	l := app.Log.With("user_id", userID, "doc_id", d.ID, "doc", docName)
+	rec := DownloadRecord{UserID: userID, DocID: d.ID, Версия: d.Версия, CategoryID: categoryID, Тип: dlSingle, Результат: dlError}
+	defer func() { recordDownloads(ctx, app, rec) }()
+	// sent отмечает успешную отправку: размер берётся из ответа Telegram.
+	sent := func(msg *tele.Message, cached bool) {
+		rec.Результат, rec.Кэш = dlOK, cached
+		if msg != nil && msg.Document != nil {
+			rec.Байты = msg.Document.FileSize
+		}
+	}
+
 	if link == "" {
+		// Файл загружен в Telegram (админом через бота или file_id в таблице) — отправляем как есть, без ZIP.
+		doc := &tele.Document{
+			File:    tele.File{FileID: d.FileID},
+			Caption: t.T(keyПодписьФайл, "{название}", docName),
+		}
+		msg, err := bot.Send(chat, doc)
+		if err != nil {
+			l.Error("Send document file_id", "err", err)
+			_, _ = bot.Send(chat, t.T(keyОшибкаОтправкиФайла))
+			return
+		}
+		sent(msg, true)
 		return
 	}
 
-	// Быстрая отправка по сохранённому File_ID
-	if d.FileID != "" {
+	// Быстрая отправка по сохранённому File_ID: у режимов zip и original свой кэш.
+	// В auto тип источника сначала определяется по HEAD, и берётся только кэш этого типа:
+	// ZIP, оставшийся с режима zip, не должен навсегда заменить PDF.
+	cfg := app.GetConfig()
+	mode := deliveryModeFor(d, cfg)
+	var info *YandexFileInfo
+	original := mode == deliveryOriginal
+	if mode == deliveryAuto && (d.FileIDOrig != "" || d.FileID != "") && app.Yandex != nil {
+		fi, err := app.Yandex.GetFileInfo(ctx, link)
+		if err == nil {
+			info, original = &fi, sourceSendsOriginal(mode, fi)
+		} else if err != ErrNotYandexDisk {
+			l.Warn("GetFileInfo: тип источника не определён, кэш не используется", "err", err)
+		}
+	}
+	cachedID, cachedName := "", ""
+	switch {
+	case mode == deliveryAuto && info == nil:
+		// Тип неизвестен — кэш не годится, файл скачивается заново.
+	case original:
+		cachedID = d.FileIDOrig
+	case d.FileID != "":
+		cachedID, cachedName = d.FileID, sanitizeZipName(docName)+".zip"
+	}
+	if cachedID != "" {
 		doc := &tele.Document{
-			File:     tele.File{FileID: d.FileID},
-			FileName: sanitizeZipName(docName) + ".zip",
-			Caption:  "Файл: " + docName,
+			File:     tele.File{FileID: cachedID},
+			FileName: cachedName,
+			Caption:  t.T(keyПодписьФайл, "{название}", docName),
 		}
-		_, _ = bot.Send(chat, doc)
+		msg, err := bot.Send(chat, doc)
+		if err != nil {
+			l.Error("Send document cached", "err", err)
+			_, _ = bot.Send(chat, t.T(keyОшибкаОтправкиФайла))
+			return
+		}
+		sent(msg, true)
 		return
 	}
 
 	// Проверка свободного места
-	if free, err := getFreeSpaceBytes(os.TempDir()); err == nil && free < minFreeBytes {
-		_, _ = bot.Send(chat, "Место на сервере ограничено, скачайте по ссылке: "+link, tele.NoPreview)
+	if free, err := getFreeSpaceBytes(os.TempDir()); err == nil && free < uint64(cfg.MinFreeBytes()) {
+		rec.Результат = dlLink
+		_, _ = bot.Send(chat, t.T(keyМалоМеста, "{ссылка}", link), tele.NoPreview)
 		return
 	}
 
 	if app.Yandex == nil {
-		_, _ = bot.Send(chat, "Скачайте по ссылке: "+link, tele.NoPreview)
+		rec.Результат = dlLink
+		_, _ = bot.Send(chat, t.T(keyСкачайтеПоСсылке, "{ссылка}", link), tele.NoPreview)
 		return
 	}
 
-	size, err := app.Yandex.GetFileSize(ctx, link)
-	if err == ErrNotYandexDisk {
-		_, _ = bot.Send(chat, "Скачайте по ссылке: "+link, tele.NoPreview)
-		return
+	if info == nil {
+		fi, err := app.Yandex.GetFileInfo(ctx, link)
+		if err == ErrNotYandexDisk {
+			rec.Результат = dlLink
+			_, _ = bot.Send(chat, t.T(keyСкачайтеПоСсылке, "{ссылка}", link), tele.NoPreview)
+			return
+		}
+		if err == nil {
+			info = &fi
+		}
 	}
-	if err == nil && size > 0 && size > telegramMaxBytes {
-		_, _ = bot.Send(chat, "Файл слишком велик для отправки архивом (лимит Telegram 50МБ). Пожалуйста, скачайте его напрямую: "+link, tele.NoPreview)
+	if info != nil && info.Size > 0 && info.Size > cfg.TelegramMaxBytes() {
+		rec.Результат = dlLink
+		_, _ = bot.Send(chat, t.T(keyФайлСлишкомВелик, "{лимит}", strconv.FormatInt(cfg.TelegramMaxMB, 10), "{ссылка}", link), tele.NoPreview)
 		return
 	}
 
 	data, filename, err := app.Yandex.GetFile(ctx, link)
 	if err == ErrNotYandexDisk {
-		_, _ = bot.Send(chat, "Скачайте по ссылке: "+link, tele.NoPreview)
+		rec.Результат = dlLink
+		_, _ = bot.Send(chat, t.T(keyСкачайтеПоСсылке, "{ссылка}", link), tele.NoPreview)
 		return
 	}
 	if err == ErrFileTooLarge {
-		_, _ = bot.Send(chat, "Файл слишком велик для отправки архивом (лимит Telegram 50МБ). Пожалуйста, скачайте его напрямую: "+link, tele.NoPreview)
+		rec.Результат = dlLink
+		_, _ = bot.Send(chat, t.T(keyФайлСлишкомВелик, "{лимит}", strconv.FormatInt(cfg.TelegramMaxMB, 10), "{ссылка}", link), tele.NoPreview)
 		return
 	}
 	if err != nil {
-		app.LogError(err.Error(), "GetFile proxy")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки: "+docName)
-		_, _ = bot.Send(chat, "Не удалось подготовить файл.")
+		l.Error("GetFile proxy", "err", err)
+		_, _ = bot.Send(chat, t.T(keyОшибкаФайла))
+		return
+	}
+
+	// Исходный файл (original или auto для PDF/офиса/картинок) или ZIP; File_ID — в свою колонку.
+	if sendsOriginal(mode, filename, data) {
+		origName := originalFileName(filename, docName, link)
+		path, dir, err := BytesToTemp(data, origName)
+		if err != nil {
+			l.Error("BytesToTemp", "err", err)
+			_, _ = bot.Send(chat, t.T(keyОшибкаФайла))
+			return
+		}
+		defer os.RemoveAll(dir)
+		doc := &tele.Document{
+			File:     tele.FromDisk(path),
+			FileName: origName,
+			MIME:     detectMIME(origName, data),
+			Caption:  t.T(keyПодписьФайл, "{название}", docName),
+		}
+		msg, err := bot.Send(chat, doc)
+		if err != nil {
+			l.Error("Send document original", "err", err)
+			_, _ = bot.Send(chat, t.T(keyОшибкаФайла))
+			return
+		}
+		if msg != nil && msg.Document != nil && msg.Document.FileID != "" {
+			_ = app.Sheets.UpdateDocumentCell(ctx, d.SheetRow, docColFileIDOrig, msg.Document.FileID)
+		}
+		sent(msg, false)
 		return
 	}
 
 	zipPath, zipDir, err := ZipBytesToTemp(data, filename, sanitizeZipName(docName)+".zip")
 	if err != nil {
-		app.LogError(err.Error(), "ZipBytesToTemp")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки: "+docName)
-		_, _ = bot.Send(chat, "Не удалось подготовить файл.")
+		l.Error("ZipBytesToTemp", "err", err)
+		_, _ = bot.Send(chat, t.T(keyОшибкаФайла))
 		return
 	}
 	defer os.RemoveAll(zipDir)
@@ -360,89 +538,145 @@ func runProxyArchive(ctx context.Context, bot *tele.Bot, chat tele.Recipient, ap
 	doc := &tele.Document{
 		File:     tele.FromDisk(zipPath),
 		FileName: zipFileName,
-		Caption:  "Файл: " + docName,
+		Caption:  t.T(keyПодписьФайл, "{название}", docName),
 	}
 	msg, err := bot.Send(chat, doc)
 	if err != nil {
-		app.LogError(err.Error(), "Send document zip")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки: "+docName)
-		_, _ = bot.Send(chat, "Не удалось подготовить файл.")
+		l.Error("Send document zip", "err", err)
+		_, _ = bot.Send(chat, t.T(keyОшибкаФайла))
 		return
 	}
 	if msg != nil && msg.Document != nil && msg.Document.FileID != "" {
 		_ = app.Sheets.UpdateDocumentFileID(ctx, d.SheetRow, msg.Document.FileID)
 	}
+	sent(msg, false)
 }
 
+// Deep-link скачивания: doc_<ID_Документа>; прежние ссылки dl_<base64(ID_Категории|индекс)> ещё понимаются.
+const (
+	deepLinkDoc    = "doc_"
+	deepLinkLegacy = "dl_"
+)
+
 func handleDeepLink(c tele.Context, app *App) {
 	payload := strings.TrimSpace(strings.TrimPrefix(c.Text(), "/start"))
-	if !strings.HasPrefix(payload, "dl_") {
+	if !strings.HasPrefix(payload, deepLinkDoc) && !strings.HasPrefix(payload, deepLinkLegacy) {
 		return
 	}
-	b, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(payload, "dl_"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
+	defer cancel()
+	d, err := deepLinkDocument(ctx, app, payload)
 	if err != nil {
+		logFor(c, app).Error("deep link", "err", err, "payload", payload)
+		_, _ = c.Bot().Send(c.Chat(), sheetsErrText(trFor(c, app), err, keyОшибкаДокумента))
 		return
 	}
-	parts := strings.SplitN(string(b), "|", 2)
-	if len(parts) != 2 {
-		return
-	}
-	categoryID := parts[0]
-	idx, err := strconv.Atoi(parts[1])
-	if err != nil || idx < 0 {
+	if d == nil || !docHasSource(*d) {
 		return
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	docs, err := app.Sheets.GetDocumentsByCategory(ctx, categoryID)
-	if err != nil || idx >= len(docs) || strings.TrimSpace(docs[idx].Ссылка) == "" {
+	// Ссылка могла попасть к пользователю без доступа — проверяем категорию и документ заново.
+	v := viewerOf(c, app)
+	if !categoryVisible(app, d.IDКатегории, v) || !accessAllows(d.Доступ, v) {
+		_, _ = c.Bot().Send(c.Chat(), trFor(c, app).T(keyДокументНедоступен))
 		return
 	}
 
-	statusMsg, _ := c.Bot().Send(c.Chat(), "⏳ Подготавливаю файл, это может занять несколько секунд...")
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	statusMsg, _ := c.Bot().Send(c.Chat(), trFor(c, app).T(keyПодготовкаФайла))
+	docID := d.ID
+	app.Downloads.Go("single", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Download)
 		defer cancel()
-		runProxyArchive(ctx, c.Bot(), c.Chat(), app, categoryID, idx, statusMsg)
-	}()
+		runProxyArchive(ctx, c.Bot(), c.Chat(), app, c.Sender().ID, docID, statusMsg)
+	})
+}
+
+// deepLinkDocument находит документ deep-link: по ID_Документа или, для прежних ссылок, по индексу
+// в категории. nil без ошибки — ссылка неверна или документа больше нет.
+func deepLinkDocument(ctx context.Context, app *App, payload string) (*Document, error) {
+	docs, err := app.Sheets.GetDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := strings.CutPrefix(payload, deepLinkDoc); ok {
+		for i := range docs {
+			if docs[i].ID == id {
+				return &docs[i], nil
+			}
+		}
+		return nil, nil
+	}
+	b, err := base64.URLEncoding.DecodeString(strings.TrimPrefix(payload, deepLinkLegacy))
+	if err != nil {
+		return nil, nil
+	}
+	categoryID, idxStr, ok := strings.Cut(string(b), "|")
+	idx, err := strconv.Atoi(idxStr)
+	if !ok || err != nil || idx < 0 {
+		return nil, nil
+	}
+	for i := range docs {
+		if docs[i].IDКатегории != categoryID {
+			continue
+		}
+		if idx == 0 {
+			return &docs[i], nil
+		}
+		idx--
+	}
+	return nil, nil
 }
 
 func handleDlAll(c tele.Context, app *App, categoryID string) {
+	t := trFor(c, app)
+	v := viewerOf(c, app)
+	if !categoryVisible(app, categoryID, v) {
+		_, _ = c.Bot().Send(c.Chat(), t.T(keyКатегорияНедоступна))
+		return
+	}
 	statusMsg := c.Message()
 	if statusMsg != nil {
-		_, _ = c.Bot().Edit(statusMsg, "⏳ Начинаю сборку архива...", tele.NoPreview)
+		_, _ = c.Bot().Edit(statusMsg, t.T(keyСборкаАрхива), tele.NoPreview)
 	}
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	app.Downloads.Go("bulk", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Download)
 		defer cancel()
-		runBulkDownload(ctx, c.Bot(), c.Chat(), app, categoryID, statusMsg)
-	}()
+		runBulkDownload(ctx, c.Bot(), c.Chat(), app, t, categoryID, v, statusMsg)
+	})
 }
 
-func runBulkDownload(ctx context.Context, bot *tele.Bot, chat tele.Recipient, app *App, categoryID string, statusMsg *tele.Message) {
-	editStatus := func(text string) {
+// runBulkDownload собирает в один ZIP документы категории со ссылками, доступные v; сообщения — на языке t.
+func runBulkDownload(ctx context.Context, bot *tele.Bot, chat tele.Recipient, app *App, t tr, categoryID string, v viewer, statusMsg *tele.Message) {
+	l := app.Log.With("user_id", v.ID, "category_id", categoryID)
+	editStatus := func(text string, opts ...interface{}) {
 		if statusMsg != nil {
-			_, _ = bot.Edit(statusMsg, text, tele.NoPreview)
+			_, _ = bot.Edit(statusMsg, text, append(opts, tele.NoPreview)...)
 		}
 	}
 	docs, err := app.Sheets.GetDocumentsByCategory(ctx, categoryID)
 	if err != nil {
-		app.LogError(err.Error(), "GetDocumentsByCategory bulk")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки (bulk): GetDocumentsByCategory")
-		editStatus("Не удалось собрать архив.")
+		l.Error("GetDocumentsByCategory bulk", "err", err)
+		editStatus(sheetsErrText(t, err, keyОшибкаАрхива))
 		return
 	}
 	var items []BulkItem
-	for _, d := range docs {
+	var included []*Document
+	for i := range docs {
+		d := docs[i]
 		link := strings.TrimSpace(d.Ссылка)
-		if link == "" {
+		if !docHasSource(d) || !accessAllows(d.Доступ, v) {
 			continue
 		}
 		name := sanitizeZipName(d.Название)
 		if name == "" {
 			name = "document"
 		}
+		if link == "" {
+			// Файл из Telegram: расширение берём из file_path, имя — из названия документа.
+			items = append(items, BulkItem{FileID: d.FileID, Filename: name})
+			included = append(included, &docs[i])
+			continue
+		}
 		if !strings.Contains(filepath.Base(name), ".") {
 			if u, e := url.Parse(link); e == nil && u != nil {
 				ext := filepath.Ext(u.Path)
@@ -452,9 +686,10 @@ func runBulkDownload(ctx context.Context, bot *tele.Bot, chat tele.Recipient, ap
 			}
 		}
 		items = append(items, BulkItem{URL: link, Filename: name})
+		included = append(included, &docs[i])
 	}
 	if len(items) == 0 {
-		editStatus("В категории нет файлов для скачивания.")
+		editStatus(t.T(keyНетФайлов))
 		return
 	}
 	var categoryName string
@@ -470,16 +705,41 @@ func runBulkDownload(ctx context.Context, bot *tele.Bot, chat tele.Recipient, ap
 		categoryName = "Archive"
 	}
 
-	zipPath, bulkDir, err := BulkDownloadAndZip(ctx, app.Yandex, items, categoryName, telegramMaxBytes, minFreeBytes)
+	// Первая запись — сам архив (размер и результат), за ней при успехе — по строке на каждый документ.
+	recs := []DownloadRecord{{UserID: v.ID, CategoryID: categoryID, Тип: dlArchive, Результат: dlError}}
+	defer func() { recordDownloads(ctx, app, recs...) }()
+
+	cfg := app.GetConfig()
+	zipPath, bulkDir, skipped, err := BulkDownloadAndZip(ctx, app.Yandex, bot, items, categoryName, cfg.TelegramMaxBytes(), cfg.MinFreeBytes())
+	// Не вошедшие в архив (getFile отказал, обычно файл больше 20 МБ) — списком ссылок на одиночную отправку.
+	skippedDoc := make(map[*Document]bool)
+	var skippedLines []string
+	for _, i := range skipped {
+		d := included[i]
+		skippedDoc[d] = true
+		line := "• " + html.EscapeString(d.Название)
+		if link := docDownloadLink(app, d.ID); link != "" {
+			line = "• <a href=\"" + html.EscapeString(link) + "\">" + html.EscapeString(d.Название) + "</a>"
+		}
+		skippedLines = append(skippedLines, line)
+	}
+	if len(skipped) > 0 {
+		l.Warn("Bulk: файлы не вошли в архив (getFile)", "skipped", len(skipped))
+	}
+	skippedText := html.EscapeString(t.T(keyНеВошлиВАрхив)) + "\n" + strings.Join(skippedLines, "\n")
+	if err == ErrNoBulkFiles {
+		recs[0].Результат = dlLink
+		editStatus(skippedText, tele.ModeHTML)
+		return
+	}
 	if err != nil {
 		if err == ErrArchiveTooLarge {
-			_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки (bulk): превышен лимит 50 МБ")
-			editStatus("⚠️ Общий размер файлов превышает 50 МБ. Пожалуйста, скачайте файлы по отдельности.")
+			l.Warn("Ошибка загрузки (bulk): превышен лимит", "limit_mb", cfg.TelegramMaxMB)
+			editStatus(t.T(keyАрхивСлишкомВелик, "{лимит}", strconv.FormatInt(cfg.TelegramMaxMB, 10)))
 			return
 		}
-		app.LogError(err.Error(), "BulkDownloadAndZip")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки (bulk): BulkDownloadAndZip")
-		editStatus("Не удалось собрать архив.")
+		l.Error("BulkDownloadAndZip", "err", err)
+		editStatus(t.T(keyОшибкаАрхива))
 		return
 	}
 	defer os.RemoveAll(bulkDir)
@@ -487,15 +747,29 @@ func runBulkDownload(ctx context.Context, bot *tele.Bot, chat tele.Recipient, ap
 	doc := &tele.Document{
 		File:     tele.FromDisk(zipPath),
 		FileName: filepath.Base(zipPath),
-		Caption:  "Архив: " + categoryName,
+		Caption:  t.T(keyПодписьАрхив, "{категория}", categoryName),
+	}
+	msg, err := bot.Send(chat, doc, tele.NoPreview)
+	if err != nil {
+		l.Error("BulkDownload Send", "err", err)
+		editStatus(t.T(keyОшибкаОтправкиАрхива))
+		return
+	}
+	recs[0].Результат = dlOK
+	if msg != nil && msg.Document != nil {
+		recs[0].Байты = msg.Document.FileSize
+	}
+	for _, d := range included {
+		if skippedDoc[d] {
+			continue
+		}
+		recs = append(recs, DownloadRecord{UserID: v.ID, DocID: d.ID, Версия: d.Версия, CategoryID: categoryID, Тип: dlBulk, Результат: dlOK})
 	}
-	if _, err := bot.Send(chat, doc, tele.NoPreview); err != nil {
-		app.LogError(err.Error(), "BulkDownload Send")
-		_ = app.Sheets.LogToSheets(ctx, "Ошибка", "Ошибка загрузки (bulk): не удалось отправить архив")
-		editStatus("Не удалось отправить архив.")
+	if len(skipped) > 0 {
+		editStatus(html.EscapeString(t.T(keyАрхивОтправлен))+"\n\n"+skippedText, tele.ModeHTML)
 		return
 	}
-	editStatus("📦 Архив собран и отправлен ниже.")
+	editStatus(t.T(keyАрхивОтправлен))
 }
 
 func sanitizeZipName(s string) string {
@@ -513,40 +787,39 @@ func sanitizeZipName(s string) string {
 	return out
 }
 
-// notifyAdmins отправляет сообщение всем админам с заполненным ID_Чата. Вызывать в горутине.
-func notifyAdmins(bot *tele.Bot, app *App, msg string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// notifyAdmins отправляет сообщение админам с заполненным ID_Чата, чья роль получает уведомления
+// типа kind (notifyWish, notifyIMO). Вызывать в горутине. build собирает сообщение на языке админа:
+// текст и опции bot.Send (например, inline-кнопки).
+func notifyAdmins(bot *tele.Bot, app *App, kind string, build func(t tr) (string, []interface{})) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
 	defer cancel()
-	ids, err := app.Sheets.GetAdminChatIDs(ctx)
+	ids, err := app.Sheets.GetAdminChatIDs(ctx, kind)
 	if err != nil {
-		app.LogError(err.Error(), "GetAdminChatIDs notify")
+		app.Log.Error("GetAdminChatIDs notify", "err", err)
 		return
 	}
 	if len(ids) == 0 {
-		app.LogError("notifyAdmins: 0 админов с заполненным ID_Чата (админ должен хотя бы раз нажать /start)", "notify")
+		app.Log.Warn("notifyAdmins: 0 админов с заполненным ID_Чата (админ должен хотя бы раз нажать /start)")
 		return
 	}
 	for _, id := range ids {
-		if _, err := bot.Send(&tele.Chat{ID: id}, msg); err != nil {
-			app.LogError(err.Error(), "notify admin "+fmt.Sprintf("%d", id))
+		msg, opts := build(trUser(app, id))
+		if _, err := bot.Send(&tele.Chat{ID: id}, msg, opts...); err != nil {
+			app.Log.Error("notify admin", "err", err, "chat_id", id)
 		}
 	}
 }
 
 func onWishStart(c tele.Context, app *App) error {
 	app.SetState(c.Sender().ID, "wish")
-	msg := app.GetText(keyОписаниеПожелания)
-	if msg == "" {
-		msg = "Напишите ваше пожелание:"
-	}
-	return c.Send(msg)
+	return c.Send(trFor(c, app).T(keyОписаниеПожелания))
 }
 
 func onWishSubmit(c tele.Context, app *App, text string) error {
 	if text == "" {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
 	defer cancel()
 	username := c.Sender().Username
 	if username == "" {
@@ -554,8 +827,8 @@ func onWishSubmit(c tele.Context, app *App, text string) error {
 	}
 	err := app.Sheets.AppendWish(ctx, username, fmt.Sprintf("%d", c.Sender().ID), text)
 	if err != nil {
-		app.LogError(err.Error(), "AppendWish")
-		return c.Send("Не удалось сохранить. Попробуйте позже.")
+		logFor(c, app).Error("AppendWish", "err", err)
+		return c.Send(sheetsErrText(trFor(c, app), err, keyОшибкаСохранения))
 	}
 	// Уведомление админам в фоне
 	display := username
@@ -563,18 +836,15 @@ func onWishSubmit(c tele.Context, app *App, text string) error {
 		display = "@" + c.Sender().Username
 	}
 	userID := fmt.Sprintf("%d", c.Sender().ID)
-	msg := fmt.Sprintf("📝 Новое пожелание\nОт: %s (id: %s)\n\n%s", display, userID, text)
-	go notifyAdmins(c.Bot(), app, msg)
-	return c.Send("Спасибо! Ваше пожелание сохранено.")
+	go notifyAdmins(c.Bot(), app, notifyWish, func(t tr) (string, []interface{}) {
+		return t.T(keyУведомлениеПожелание, "{от}", display, "{id}", userID, "{текст}", text), nil
+	})
+	return c.Send(trFor(c, app).T(keyПожеланиеСохранено))
 }
 
 func onIMOStart(c tele.Context, app *App) error {
 	app.SetState(c.Sender().ID, "imo")
-	msg := app.GetText(keyОписаниеIMO)
-	if msg == "" {
-		msg = "Введите данные (каждое поле с новой строки):\n1. ФИО\n2. Телефон\n3. Должность\n4. Источник"
-	}
-	return c.Send(msg)
+	return c.Send(trFor(c, app).T(keyОписаниеIMO))
 }
 
 func onIMOSubmit(c tele.Context, app *App, text string) error {
@@ -587,24 +857,20 @@ func onIMOSubmit(c tele.Context, app *App, text string) error {
 		}
 	}
 	if len(parts) < 4 {
-		msg := app.GetText(keyТекстОшибкиАнкеты)
-		if msg == "" {
-			msg = "Нужно минимум 4 строки: ФИО, Телефон, Должность, Источник."
-		}
-		return c.Send(msg)
+		return c.Send(trFor(c, app).T(keyТекстОшибкиАнкеты))
 	}
 	app.ResetState(c.Sender().ID)
 	fio, phone, pos, src := parts[0], parts[1], parts[2], strings.Join(parts[3:], " ")
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
 	defer cancel()
 	username := c.Sender().Username
 	if username == "" {
 		username = c.Sender().FirstName
 	}
-	err := app.Sheets.AppendIMO(ctx, username, fmt.Sprintf("%d", c.Sender().ID), fio, phone, pos, src)
+	id, err := app.Sheets.AppendIMO(ctx, username, fmt.Sprintf("%d", c.Sender().ID), fio, phone, pos, src)
 	if err != nil {
-		app.LogError(err.Error(), "AppendIMO")
-		return c.Send("Не удалось сохранить заявку. Попробуйте позже.")
+		logFor(c, app).Error("AppendIMO", "err", err)
+		return c.Send(sheetsErrText(trFor(c, app), err, keyОшибкаЗаявки))
 	}
 	// Уведомление админам в фоне
 	display := username
@@ -612,36 +878,64 @@ func onIMOSubmit(c tele.Context, app *App, text string) error {
 		display = "@" + c.Sender().Username
 	}
 	userID := fmt.Sprintf("%d", c.Sender().ID)
-	msg := fmt.Sprintf("📋 Новая заявка IMO\nОт: %s (id: %s)\nФИО: %s\nТелефон: %s\nДолжность: %s\nИсточник: %s", display, userID, fio, phone, pos, src)
-	go notifyAdmins(c.Bot(), app, msg)
-	return c.Send("Заявка принята. Спасибо!")
+	go notifyAdmins(c.Bot(), app, notifyIMO, func(t tr) (string, []interface{}) {
+		msg := t.T(keyУведомлениеЗаявкаIMO, "{от}", display, "{id}", userID, "{ФИО}", fio, "{телефон}", phone, "{должность}", pos, "{источник}", src)
+		return msg, []interface{}{imoAdminMarkup(t, id)}
+	})
+	return c.Send(trFor(c, app).T(keyЗаявкаПринята))
 }
 
 func onSend(c tele.Context, app *App, text string) error {
+	t := trFor(c, app)
 	if text == "" {
-		return c.Send("Использование: /send <текст рассылки>")
+		return c.Send(t.T(keyРассылкаИспользование))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-	chatIDs, err := app.Sheets.GetAllUserChatIDs(ctx)
-	if err != nil {
-		app.LogError(err.Error(), "GetAllUserChatIDs")
-		return c.Send("Ошибка загрузки списка пользователей.")
-	}
-	var failed int
+	sent, failed := broadcast(c.Bot(), app.Users.IDs(), text, func(id int64, err error) {
+		logFor(c, app).Error("Send broadcast", "err", err, "chat_id", id)
+	})
+	return c.Send(t.T(keyРассылкаЗавершена, "{отправлено}", strconv.Itoa(sent), "{ошибок}", strconv.Itoa(failed)))
+}
+
+// broadcast отправляет text в личные чаты chatIDs (в приватном чате с ботом chat_id = user_id)
+// и ведёт метрику mBroadcast. onErr вызывается для каждой неудачной отправки. Общая для /send и CLI.
+func broadcast(b *tele.Bot, chatIDs []int64, text string, onErr func(chatID int64, err error)) (sent, failed int) {
+	mBroadcast.Set("recipients", float64(len(chatIDs)))
+	mBroadcast.Set("sent", 0)
+	mBroadcast.Set("failed", 0)
+	mBroadcast.Set("running", 1)
+	defer mBroadcast.Set("running", 0)
 	for _, id := range chatIDs {
-		_, err := c.Bot().Send(&tele.Chat{ID: id}, text)
-		if err != nil {
+		if _, err := b.Send(&tele.Chat{ID: id}, text); err != nil {
 			failed++
-			app.LogError(err.Error(), "Send broadcast to "+fmt.Sprintf("%d", id))
+			mBroadcast.Inc("failed")
+			onErr(id, err)
+			continue
 		}
+		sent++
+		mBroadcast.Inc("sent")
 	}
-	return c.Send(fmt.Sprintf("Рассылка завершена. Отправлено: %d, ошибок: %d", len(chatIDs)-failed, failed))
+	return sent, failed
 }
 
 func onReload(c tele.Context, app *App) error {
 	if app.OnReload != nil {
 		app.OnReload()
 	}
-	return c.Send("Кэш сброшен.")
+	return c.Send(trFor(c, app).T(keyКэшСброшен))
+}
+
+func onReloadConfig(c tele.Context, app *App) error {
+	t := trFor(c, app)
+	if app.ReloadConfig == nil {
+		return c.Send(t.T(keyКонфигНедоступна))
+	}
+	l := logFor(c, app)
+	changes, err := app.ReloadConfig()
+	if err != nil {
+		l.Error("/reloadconfig: конфигурация не перечитана", "err", err)
+		return c.Send(t.T(keyКонфигОшибка, "{ошибка}", err.Error()))
+	}
+	applied, pending := changedKeys(changes)
+	l.Info("/reloadconfig: конфигурация перечитана", "applied", applied, "restart_required", pending)
+	return c.Send(formatConfigChanges(t, changes))
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Проверки /healthz и /readyz (HTTP-сервер из metrics.go, адрес HTTP_ADDR).
+// /healthz — процесс жив (200 всегда); /readyz — все зависимости, 503 при любой ошибке.
+
+const (
+	healthCheckTimeout = 5 * time.Second  // таймаут одной внешней проверки
+	healthMemo         = 15 * time.Second // результат внешней проверки переиспользуется столько времени
+)
+
+// checkResult — результат одной проверки для JSON-ответа.
+type checkResult struct {
+	OK         bool   `json:"ok"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	at         time.Time
+}
+
+// healthChecker хранит состояние для /readyz: бот, таблица, возраст кэша и итог EnsureSchema.
+type healthChecker struct {
+	bot      *tele.Bot
+	sheets   *SheetsAPI
+	cacheAge func() (time.Duration, bool) // время с последней успешной загрузки кэша; false — не загружался
+	cfg      func() *Config               // действующая конфигурация: TTL кэша и минимум свободного места
+	started  time.Time
+
+	mu       sync.Mutex
+	schemaOK bool
+	memo     map[string]checkResult
+	running  map[string]chan struct{} // идущие внешние проверки: закрывается, когда результат в memo
+}
+
+func newHealthChecker(bot *tele.Bot, api *SheetsAPI, cacheAge func() (time.Duration, bool), cfg func() *Config) *healthChecker {
+	return &healthChecker{bot: bot, sheets: api, cacheAge: cacheAge, cfg: cfg, started: time.Now(),
+		memo: make(map[string]checkResult), running: make(map[string]chan struct{})}
+}
+
+// maxCacheAge — сколько кэш может не обновляться до «не готов»: 3 TTL, но не меньше 15 минут.
+func (h *healthChecker) maxCacheAge() time.Duration {
+	maxAge := 3 * time.Duration(h.cfg().CacheTTLMin) * time.Minute
+	if maxAge < 15*time.Minute {
+		maxAge = 15 * time.Minute
+	}
+	return maxAge
+}
+
+// SetSchemaValidated запоминает итог EnsureSchema при старте; при ошибке /readyz повторит проверку сам.
+func (h *healthChecker) SetSchemaValidated(err error) {
+	h.mu.Lock()
+	h.schemaOK = err == nil
+	h.mu.Unlock()
+}
+
+// memoized выполняет внешнюю проверку не чаще раза в healthMemo. Одновременные запросы /readyz
+// не запускают проверку повторно, а ждут уже идущую (не дольше её таймаута).
+func (h *healthChecker) memoized(name string, check func(ctx context.Context) (string, error)) checkResult {
+	h.mu.Lock()
+	if r, ok := h.memo[name]; ok && time.Since(r.at) < healthMemo {
+		h.mu.Unlock()
+		return r
+	}
+	if done, ok := h.running[name]; ok {
+		h.mu.Unlock()
+		<-done
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.memo[name]
+	}
+	done := make(chan struct{})
+	h.running[name] = done
+	h.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	r := runCheck(ctx, check)
+	h.mu.Lock()
+	h.memo[name] = r
+	delete(h.running, name)
+	h.mu.Unlock()
+	close(done)
+	return r
+}
+
+// runCheck выполняет check с учётом таймаута ctx и замеряет время.
+func runCheck(ctx context.Context, check func(ctx context.Context) (string, error)) checkResult {
+	start := time.Now()
+	type out struct {
+		detail string
+		err    error
+	}
+	ch := make(chan out, 1)
+	go func() {
+		d, err := check(ctx)
+		ch <- out{d, err}
+	}()
+	r := checkResult{at: time.Now()}
+	select {
+	case o := <-ch:
+		r.OK, r.Detail = o.err == nil, o.detail
+		if o.err != nil {
+			r.Detail = o.err.Error()
+		}
+	case <-ctx.Done():
+		r.Detail = "timeout"
+	}
+	r.DurationMS = time.Since(start).Milliseconds()
+	return r
+}
+
+// Ready выполняет все проверки: Telegram getMe, доступность таблицы, схема, свободное место, возраст кэша.
+// Внешние проверки идут параллельно — ответ не дольше одного healthCheckTimeout.
+func (h *healthChecker) Ready() (bool, map[string]checkResult) {
+	external := map[string]func(ctx context.Context) (string, error){
+		"telegram": func(context.Context) (string, error) {
+			data, err := h.bot.Raw("getMe", nil)
+			if err != nil {
+				return "", err
+			}
+			var resp struct {
+				Result tele.User `json:"result"`
+			}
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return "", err
+			}
+			return "@" + resp.Result.Username, nil
+		},
+		"sheets": h.sheets.Title,
+		"schema": func(ctx context.Context) (string, error) {
+			h.mu.Lock()
+			ok := h.schemaOK
+			h.mu.Unlock()
+			if ok {
+				return "", nil
+			}
+			err := h.sheets.EnsureSchema(ctx)
+			h.SetSchemaValidated(err)
+			return "", err
+		},
+	}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	checks := make(map[string]checkResult, len(external)+2)
+	for name, check := range external {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := h.memoized(name, check)
+			mu.Lock()
+			checks[name] = r
+			mu.Unlock()
+		}()
+	}
+
+	local := map[string]checkResult{
+		"disk": runCheck(context.Background(), func(context.Context) (string, error) {
+			free, err := getFreeSpaceBytes(os.TempDir())
+			if err != nil {
+				return "", err
+			}
+			minFree := h.cfg().MinFreeBytes()
+			detail := fmt.Sprintf("свободно %d МБ, минимум %d МБ", free/1024/1024, minFree/1024/1024)
+			if free < uint64(minFree) {
+				return "", fmt.Errorf("%s", detail)
+			}
+			return detail, nil
+		}),
+		"cache": runCheck(context.Background(), func(context.Context) (string, error) {
+			age, loaded := h.cacheAge()
+			if !loaded {
+				return "", fmt.Errorf("кэш ни разу не загрузился без ошибок")
+			}
+			maxAge := h.maxCacheAge()
+			detail := fmt.Sprintf("загружен %s назад, предел %s", age.Round(time.Second), maxAge)
+			if age > maxAge {
+				return "", fmt.Errorf("%s", detail)
+			}
+			return detail, nil
+		}),
+	}
+	wg.Wait()
+	for name, r := range local {
+		checks[name] = r
+	}
+	ready := true
+	for _, r := range checks {
+		ready = ready && r.OK
+	}
+	return ready, checks
+}
+
+// buildRevision — коммит, из которого собран бинарник (go build в git-репозитории), или "".
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// healthGroup — проверки всех ботов процесса: первый — основной, у дополнительных к имени проверки
+// добавляется «<бот>.» (hr.telegram, hr.sheets, …).
+type healthGroup []*healthChecker
+
+// Ready — Ready всех ботов параллельно; готов процесс, только если готовы все.
+func (g healthGroup) Ready() (bool, map[string]checkResult) {
+	oks := make([]bool, len(g))
+	results := make([]map[string]checkResult, len(g))
+	var wg sync.WaitGroup
+	for i, h := range g {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			oks[i], results[i] = h.Ready()
+		}()
+	}
+	wg.Wait()
+	ready := true
+	all := make(map[string]checkResult)
+	for i, h := range g {
+		ready = ready && oks[i]
+		for name, r := range results[i] {
+			if t := h.cfg().Tenant; t != "" {
+				name = t + "." + name
+			}
+			all[name] = r
+		}
+	}
+	return ready, all
+}
+
+// handleHealthz — /healthz: процесс жив и отвечает.
+func (g healthGroup) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":   "ok",
+		"uptime":   time.Since(g[0].started).Round(time.Second).String(),
+		"revision": buildRevision(),
+	})
+}
+
+// handleReadyz — /readyz: 200, если все проверки прошли, иначе 503.
+func (g healthGroup) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	ready, checks := g.Ready()
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "fail", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status":   status,
+		"revision": buildRevision(),
+		"checks":   checks,
+	})
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Тексты бота на разных языках. У каждого текста, который видит пользователь, есть ключ (key…):
+// встроенный русский текст (builtinTexts) заменяется строкой «Настройки_Текста» с тем же «Ключом».
+// Колонка «Язык» — код языка Telegram (en, uk, kk, pt-br…): строка с ним — перевод, пустой «Язык» —
+// текст языка по умолчанию. Язык пользователя — выбранный командой /lang, иначе language_code из
+// Telegram; если перевода ключа нет — текст языка по умолчанию. В тексте {имя} заменяется значением.
+// Замечания /doctor о строках таблицы общие с командой validate и не переводятся.
+
+// defaultLang — язык встроенных текстов и строк «Настройки_Текста» без «Языка».
+const defaultLang = "ru"
+
+// Ключи текстов «Настройки_Текста».
+const (
+	keyПриветствие       = "Приветствие"
+	keyОписаниеДокументы = "Описание_Документы"
+	keyОписаниеПожелания = "Описание_Пожелания"
+	keyОписаниеIMO       = "Описание_IMO"
+	keyТекстОшибкиАнкеты = "Текст_Ошибки_Анкеты"
+	keyСтатусВРаботе     = "Текст_Статус_В_Работе"
+	keyСтатусОдобрена    = "Текст_Статус_Одобрена"
+	keyСтатусОтклонена   = "Текст_Статус_Отклонена"
+
+	// Язык (/lang)
+	keyЯзыкНазвание   = "Язык_Название"
+	keyЯзыкВыбор      = "Язык_Выбор"
+	keyЯзыкАвто       = "Язык_Авто"
+	keyЯзыкВыбран     = "Язык_Выбран"
+	keyЯзыкНеизвестен = "Язык_Неизвестен"
+
+	// Кнопки
+	keyКнопкаДокументы       = "Кнопка_Список_Документов"
+	keyКнопкаПожелания       = "Кнопка_Пожелания"
+	keyКнопкаЧтоНового       = "Кнопка_Что_Нового"
+	keyКнопкаIMO             = "Кнопка_IMO"
+	keyКнопкаНазад           = "Кнопка_Назад"
+	keyКнопкаСкачатьВсе      = "Кнопка_Скачать_Все"
+	keyКнопкаЗапроситьДоступ = "Кнопка_Запросить_Доступ"
+	keyКнопкаОтмена          = "Кнопка_Отмена"
+	keyКнопкаВРаботу         = "Кнопка_В_Работу"
+	keyКнопкаОдобрить        = "Кнопка_Одобрить"
+	keyКнопкаОтклонить       = "Кнопка_Отклонить"
+	keyКнопкаБессрочно       = "Кнопка_Бессрочно"
+	keyКнопкаНаДней          = "Кнопка_На_Дней"
+	keyКнопкаУдалить         = "Кнопка_Удалить"
+	keyКнопкаУведомить       = "Кнопка_Уведомить_Скачавших"
+
+	// Общие
+	keyОтменено         = "Отменено"
+	keyНедостаточноПрав = "Недостаточно_Прав"
+	keyСервисНедоступен = "Сервис_Недоступен"
+	keyСрокДо           = "Срок_До"
+
+	// Категории и документы
+	keyКатегорийНет          = "Категорий_Нет"
+	keyКатегорияНедоступна   = "Категория_Недоступна"
+	keyДокументНедоступен    = "Документ_Недоступен"
+	keyДокументовНет         = "Документов_Нет"
+	keyДокументКарточка      = "Документ_Карточка"
+	keyСсылкаСкачать         = "Ссылка_Скачать"
+	keyОшибкаКатегорий       = "Ошибка_Категорий"
+	keyОшибкаЗагрузки        = "Ошибка_Загрузки"
+	keyОшибкаДокумента       = "Ошибка_Документа"
+	keyОшибкаДокументов      = "Ошибка_Документов"
+	keyДокументНеНайден      = "Документ_Не_Найден"
+	keyКатегорияНеНайдена    = "Категория_Не_Найдена"
+	keyНовогоНет             = "Нового_Нет"
+	keyЧтоНового             = "Что_Нового"
+	keyВерсияОт              = "Версия_От"
+	keyУведомлениеОбновлён   = "Уведомление_Документ_Обновлён"
+	keyСсылкаНоваяВерсия     = "Ссылка_Новая_Версия"
+	keyОшибкаСкачавших       = "Ошибка_Скачавших"
+	keyНиктоНеСкачивал       = "Никто_Не_Скачивал"
+	keyВсеСТекущейВерсией    = "Все_С_Текущей_Версией"
+	keyУведомленияОтправлены = "Уведомления_Отправлены"
+
+	// Скачивание
+	keyПодготовкаФайла      = "Подготовка_Файла"
+	keyПодписьФайл          = "Подпись_Файл"
+	keyПодписьАрхив         = "Подпись_Архив"
+	keyОшибкаФайла          = "Ошибка_Файла"
+	keyОшибкаОтправкиФайла  = "Ошибка_Отправки_Файла"
+	keyМалоМеста            = "Мало_Места"
+	keyСкачайтеПоСсылке     = "Скачайте_По_Ссылке"
+	keyФайлСлишкомВелик     = "Файл_Слишком_Велик"
+	keyСборкаАрхива         = "Сборка_Архива"
+	keyОшибкаАрхива         = "Ошибка_Архива"
+	keyНетФайлов            = "Нет_Файлов"
+	keyАрхивСлишкомВелик    = "Архив_Слишком_Велик"
+	keyОшибкаОтправкиАрхива = "Ошибка_Отправки_Архива"
+	keyАрхивОтправлен       = "Архив_Отправлен"
+	keyНеВошлиВАрхив        = "Не_Вошли_В_Архив"
+
+	// Пожелания и заявки IMO
+	keyОшибкаСохранения     = "Ошибка_Сохранения"
+	keyПожеланиеСохранено   = "Пожелание_Сохранено"
+	keyУведомлениеПожелание = "Уведомление_Пожелание"
+	keyОшибкаЗаявки         = "Ошибка_Заявки"
+	keyЗаявкаПринята        = "Заявка_Принята"
+	keyУведомлениеЗаявкаIMO = "Уведомление_Заявка_IMO"
+	keyОшибкаСтатуса        = "Ошибка_Статуса"
+	keyСтатусЗаявки         = "Заявка_Статус"
+	keyОшибкаЗаявок         = "Ошибка_Заявок"
+	keyЗаявокНет            = "Заявок_Нет"
+	keyВашиЗаявки           = "Ваши_Заявки"
+	keyЗаявкаСтрока         = "Заявка_Строка"
+
+	// Доступ к группам
+	keyДоступНеПоЗапросу    = "Доступ_Не_По_Запросу"
+	keyОшибкаЗапросаДоступа = "Ошибка_Запроса_Доступа"
+	keyЗапросУжеЕсть        = "Запрос_Уже_Есть"
+	keyУведомлениеЗапрос    = "Уведомление_Запрос_Доступа"
+	keyЗапросОтправлен      = "Запрос_Доступа_Отправлен"
+	keyОшибкаРешения        = "Ошибка_Решения"
+	keyЗапросРассмотрен     = "Запрос_Уже_Рассмотрен"
+	keyРешение              = "Решение"
+	keyДоступОткрыт         = "Доступ_Открыт"
+	keyДоступОтклонён       = "Доступ_Отклонён"
+	keyОтзывИспользование   = "Отзыв_Использование"
+	keyОшибкаОтзыва         = "Ошибка_Отзыва"
+	keyДоступНеНайден       = "Доступ_Не_Найден"
+	keyДоступОтозван        = "Доступ_Отозван"
+	keyОтозвано             = "Отозвано"
+
+	// Служебные команды
+	keyРассылкаИспользование = "Рассылка_Использование"
+	keyРассылкаЗавершена     = "Рассылка_Завершена"
+	keyКэшСброшен            = "Кэш_Сброшен"
+	keyКонфигНедоступна      = "Конфигурация_Недоступна"
+	keyКонфигОшибка          = "Конфигурация_Ошибка"
+	keyОшибкаСтатистики      = "Ошибка_Статистики"
+	keyОшибкаПроверки        = "Ошибка_Проверки"
+
+	// /stats
+	keyСтатИспользование    = "Статистика_Использование"
+	keyСтатЗаголовок        = "Статистика_Заголовок"
+	keyСтатИтоги            = "Статистика_Итоги"
+	keyСтатТопДокументов    = "Статистика_Топ_Документов"
+	keyСтатТопКатегорий     = "Статистика_Топ_Категорий"
+	keyСтатДокументУдалён   = "Статистика_Документ_Удалён"
+	keyСтатКатегорияУдалена = "Статистика_Категория_Удалена"
+	keyСтатПользователи     = "Статистика_Пользователи"
+	keyЕдиницыРазмера       = "Единицы_Размера"
+
+	// /doctor
+	keyПроверкаИспользование = "Проверка_Использование"
+	keyПроверкаИдёт          = "Проверка_Идёт"
+	keyПроверкаВПорядке      = "Проверка_В_Порядке"
+	keyПроверкаИтог          = "Проверка_Итог"
+	keyПроверкаЕщё           = "Проверка_Ещё"
+	keyПроверкаЗаголовок     = "Проверка_Заголовок"
+	keyПроверкаСтрока        = "Проверка_Строка"
+
+	// /reloadconfig
+	keyКонфигПеречитана      = "Конфигурация_Перечитана"
+	keyКонфигБезИзменений    = "Конфигурация_Без_Изменений"
+	keyКонфигПрименено       = "Конфигурация_Применено"
+	keyКонфигНуженПерезапуск = "Конфигурация_Нужен_Перезапуск"
+	keyКонфигПусто           = "Конфигурация_Пусто"
+
+	// Управление документами (admin_docs.go)
+	keyПодсказкаОтмена           = "Подсказка_Отмена"
+	keyАдмНазваниеКатегории      = "Адм_Название_Категории"
+	keyАдмДоступКатегории        = "Адм_Доступ_Категории"
+	keyАдмВыберитеКатегорию      = "Адм_Выберите_Категорию"
+	keyАдмКатегорийНет           = "Адм_Категорий_Нет"
+	keyАдмВыберитеДокумент       = "Адм_Выберите_Документ"
+	keyАдмДокументовНет          = "Адм_Документов_Нет"
+	keyАдмНазваниеДокумента      = "Адм_Название_Документа"
+	keyАдмИмяФайла               = "Адм_Имя_Файла"
+	keyАдмОписание               = "Адм_Описание"
+	keyАдмИсточник               = "Адм_Источник"
+	keyАдмНужнаСсылкаИлиФайл     = "Адм_Нужна_Ссылка_Или_Файл"
+	keyАдмДобавитьФайл           = "Адм_Добавить_Файл"
+	keyАдмЧтоИзменить            = "Адм_Что_Изменить"
+	keyАдмЗаменаФайла            = "Адм_Замена_Файла"
+	keyАдмЗагрузитеФайл          = "Адм_Загрузите_Файл"
+	keyАдмПравилоДоступа         = "Адм_Правило_Доступа"
+	keyАдмНовоеОписание          = "Адм_Новое_Описание"
+	keyАдмДоставка               = "Адм_Доставка"
+	keyАдмДоставкаОшибка         = "Адм_Доставка_Ошибка"
+	keyАдмНовоеЗначение          = "Адм_Новое_Значение"
+	keyАдмНужнаСсылка            = "Адм_Нужна_Ссылка"
+	keyАдмПустоеНазвание         = "Адм_Пустое_Название"
+	keyАдмУдалить                = "Адм_Удалить"
+	keyАдмКудаПеренести          = "Адм_Куда_Перенести"
+	keyОшибкаДобавленияКатегории = "Ошибка_Добавления_Категории"
+	keyКатегорияДобавлена        = "Категория_Добавлена"
+	keyОшибкаДобавленияДокумента = "Ошибка_Добавления_Документа"
+	keyДокументДобавлен          = "Документ_Добавлен"
+	keyОшибкаИзменения           = "Ошибка_Сохранения_Изменений"
+	keyДокументИзменён           = "Документ_Изменён"
+	keyДокументИзменёнВерсия     = "Документ_Изменён_Версия"
+	keyОшибкаУдаления            = "Ошибка_Удаления"
+	keyДокументУдалён            = "Документ_Удалён"
+	keyОшибкаПереноса            = "Ошибка_Переноса"
+	keyДокументПеренесён         = "Документ_Перенесён"
+)
+
+// Префиксы ключей, которые составляются из данных: подписи полей документа (Поле_<код>),
+// описания команд в меню (Команда_<команда>) и статусы заявок (Статус_<статус>).
+const (
+	keyPrefixПоле    = "Поле_"
+	keyPrefixКоманда = "Команда_"
+	keyPrefixСтатус  = "Статус_"
+)
+
+// builtinTexts — тексты на языке по умолчанию, пока их нет в «Настройки_Текста».
+var builtinTexts = map[string]string{
+	keyПриветствие:       "Добрый день!",
+	keyОписаниеДокументы: "Выберите категорию:",
+	keyОписаниеПожелания: "Напишите ваше пожелание:",
+	keyОписаниеIMO:       "Введите данные (каждое поле с новой строки):\n1. ФИО\n2. Телефон\n3. Должность\n4. Источник",
+	keyТекстОшибкиАнкеты: "Нужно минимум 4 строки: ФИО, Телефон, Должность, Источник.",
+	keyСтатусВРаботе:     "Ваша заявка на доступ в IMO взята в работу.",
+	keyСтатусОдобрена:    "Ваша заявка на доступ в IMO одобрена.",
+	keyСтатусОтклонена:   "К сожалению, ваша заявка на доступ в IMO отклонена.",
+
+	keyЯзыкНазвание:   "Русский",
+	keyЯзыкВыбор:      "Выберите язык:",
+	keyЯзыкАвто:       "Как в Telegram",
+	keyЯзыкВыбран:     "Язык бота: {язык}.",
+	keyЯзыкНеизвестен: "Нет текстов на языке «{язык}». Доступны: {языки}.",
+
+	keyКнопкаДокументы:       "Список документов",
+	keyКнопкаПожелания:       "Пожелания",
+	keyКнопкаЧтоНового:       "Что нового",
+	keyКнопкаIMO:             "Запросить доступ в IMO",
+	keyКнопкаНазад:           "« Назад",
+	keyКнопкаСкачатьВсе:      "Скачать все",
+	keyКнопкаЗапроситьДоступ: "🔑 Запросить доступ",
+	keyКнопкаОтмена:          "Отмена",
+	keyКнопкаВРаботу:         imoСтатусВРаботе,
+	keyКнопкаОдобрить:        "✅ Одобрить",
+	keyКнопкаОтклонить:       "❌ Отклонить",
+	keyКнопкаБессрочно:       "✅ Бессрочно",
+	keyКнопкаНаДней:          "✅ На {дней} дней",
+	keyКнопкаУдалить:         "🗑 Удалить",
+	keyКнопкаУведомить:       "📣 Уведомить скачавших",
+
+	keyОтменено:         "Отменено.",
+	keyНедостаточноПрав: "Недостаточно прав.",
+	keyСервисНедоступен: "⚠️ Сервис временно недоступен: нет связи с таблицей. Попробуйте через минуту.",
+	keyСрокДо:           " до {дата}",
+
+	keyКатегорийНет:          "Категории пока не добавлены.",
+	keyКатегорияНедоступна:   "Категория недоступна.",
+	keyДокументНедоступен:    "Документ недоступен.",
+	keyДокументовНет:         "В этой категории пока нет документов.",
+	keyДокументКарточка:      "Название: <b>{название}</b>\n\nОписание: <i>{описание}</i>",
+	keyСсылкаСкачать:         "Скачать файл",
+	keyОшибкаКатегорий:       "Не удалось загрузить категории.",
+	keyОшибкаЗагрузки:        "Ошибка загрузки",
+	keyОшибкаДокумента:       "Не удалось загрузить документ.",
+	keyОшибкаДокументов:      "Не удалось загрузить документы.",
+	keyДокументНеНайден:      "Документ не найден.",
+	keyКатегорияНеНайдена:    "Категория не найдена.",
+	keyНовогоНет:             "За последние {дней} дней новых документов нет.",
+	keyЧтоНового:             "🆕 Что нового:",
+	keyВерсияОт:              "Версия {версия} от {дата}",
+	keyУведомлениеОбновлён:   "📄 Документ «{название}» обновлён (версия {версия}).",
+	keyСсылкаНоваяВерсия:     "Скачать новую версию",
+	keyОшибкаСкачавших:       "Не удалось загрузить список скачавших.",
+	keyНиктоНеСкачивал:       "Документ «{название}» ещё никто не скачивал.",
+	keyВсеСТекущейВерсией:    "Все, кто скачивал «{название}», уже получили версию {версия}.",
+	keyУведомленияОтправлены: "Уведомления об обновлении «{название}» отправлены: {отправлено} из {всего}.",
+
+	keyПодготовкаФайла:      "⏳ Подготавливаю файл, это может занять несколько секунд...",
+	keyПодписьФайл:          "Файл: {название}",
+	keyПодписьАрхив:         "Архив: {категория}",
+	keyОшибкаФайла:          "Не удалось подготовить файл.",
+	keyОшибкаОтправкиФайла:  "Не удалось отправить файл.",
+	keyМалоМеста:            "Место на сервере ограничено, скачайте по ссылке: {ссылка}",
+	keyСкачайтеПоСсылке:     "Скачайте по ссылке: {ссылка}",
+	keyФайлСлишкомВелик:     "Файл слишком велик для отправки архивом (лимит Telegram {лимит} МБ). Пожалуйста, скачайте его напрямую: {ссылка}",
+	keyСборкаАрхива:         "⏳ Начинаю сборку архива...",
+	keyОшибкаАрхива:         "Не удалось собрать архив.",
+	keyНетФайлов:            "В категории нет файлов для скачивания.",
+	keyАрхивСлишкомВелик:    "⚠️ Общий размер файлов превышает {лимит} МБ. Пожалуйста, скачайте файлы по отдельности.",
+	keyОшибкаОтправкиАрхива: "Не удалось отправить архив.",
+	keyАрхивОтправлен:       "📦 Архив собран и отправлен ниже.",
+	keyНеВошлиВАрхив:        "Не вошли в архив (файл больше 20 МБ или недоступен) — скачайте по отдельности:",
+
+	keyОшибкаСохранения:     "Не удалось сохранить. Попробуйте позже.",
+	keyПожеланиеСохранено:   "Спасибо! Ваше пожелание сохранено.",
+	keyУведомлениеПожелание: "📝 Новое пожелание\nОт: {от} (id: {id})\n\n{текст}",
+	keyОшибкаЗаявки:         "Не удалось сохранить заявку. Попробуйте позже.",
+	keyЗаявкаПринята:        "Заявка принята. Спасибо! Статус заявки можно узнать командой /mystatus.",
+	keyУведомлениеЗаявкаIMO: "📋 Новая заявка IMO\nОт: {от} (id: {id})\nФИО: {ФИО}\nТелефон: {телефон}\nДолжность: {должность}\nИсточник: {источник}",
+	keyОшибкаСтатуса:        "Не удалось изменить статус.",
+	keyСтатусЗаявки:         "Статус: {статус}",
+	keyОшибкаЗаявок:         "Не удалось загрузить заявки. Попробуйте позже.",
+	keyЗаявокНет:            "У вас нет заявок на доступ в IMO.",
+	keyВашиЗаявки:           "Ваши заявки:",
+	keyЗаявкаСтрока:         "<b>{дата}</b> — {статус}\nФИО: {ФИО}",
+
+	keyДоступНеПоЗапросу:    "Доступ к этой категории не выдаётся по запросу.",
+	keyОшибкаЗапросаДоступа: "Не удалось отправить запрос. Попробуйте позже.",
+	keyЗапросУжеЕсть:        "Запрос уже на рассмотрении.",
+	keyУведомлениеЗапрос:    "🔑 Запрос доступа\nОт: {от} (id: {id})\nКатегория: {категория}\nГруппа: #{группа}",
+	keyЗапросОтправлен:      "Запрос доступа отправлен. Мы сообщим, когда его рассмотрят.",
+	keyОшибкаРешения:        "Не удалось сохранить решение.",
+	keyЗапросРассмотрен:     "Запрос уже рассмотрен: {статус}.",
+	keyРешение:              "Решение: {решение}",
+	keyДоступОткрыт:         "Доступ к группе #{группа} открыт{срок}. Откройте «{кнопка}».",
+	keyДоступОтклонён:       "Ваш запрос доступа к группе #{группа} отклонён.",
+	keyОтзывИспользование:   "Использование: /revoke <@username или ID> <группа>",
+	keyОшибкаОтзыва:         "Не удалось отозвать доступ.",
+	keyДоступНеНайден:       "Активный доступ не найден.",
+	keyДоступОтозван:        "Доступ к группе #{группа} отозван.",
+	keyОтозвано:             "Отозвано записей: {число}.",
+
+	keyРассылкаИспользование: "Использование: /send <текст рассылки>",
+	keyРассылкаЗавершена:     "Рассылка завершена. Отправлено: {отправлено}, ошибок: {ошибок}",
+	keyКэшСброшен:            "Кэш сброшен.",
+	keyКонфигНедоступна:      "Перезагрузка конфигурации недоступна.",
+	keyКонфигОшибка:          "Конфигурация не перечитана, действует прежняя.\n\n{ошибка}",
+	keyОшибкаСтатистики:      "Не удалось загрузить статистику.",
+	keyОшибкаПроверки:        "Не удалось проверить таблицу.",
+
+	keyСтатИспользование:    "Использование: /stats [число дней]",
+	keyСтатЗаголовок:        "📊 <b>Скачивания за {дней} дн.</b>",
+	keyСтатИтоги:            "Документов: {документов} (из кэша {кэш})\nАрхивов «Скачать все»: {архивов}\nОтправлено: {объём}\nОшибки: документы {ошибки_документов}, архивы {ошибки_архивов}; отдано ссылкой: {ссылкой}",
+	keyСтатТопДокументов:    "<b>Топ документов</b>",
+	keyСтатТопКатегорий:     "<b>Топ категорий</b>",
+	keyСтатДокументУдалён:   "(удалён) {id}",
+	keyСтатКатегорияУдалена: "(удалена) {id}",
+	keyСтатПользователи:     "<b>Активные пользователи</b>\nЗа период: {период}, за 7 дней: {неделя}",
+	keyЕдиницыРазмера:       "Б КБ МБ ГБ ТБ",
+
+	keyПроверкаИспользование: "Использование: /doctor [files]",
+	keyПроверкаИдёт:          "⏳ Проверяю таблицу...",
+	keyПроверкаВПорядке:      "✅ Таблица в порядке: проверено листов {листов}, строк {строк}.",
+	keyПроверкаИтог:          "<b>Проверка таблицы</b>: ошибок {ошибок}, предупреждений {предупреждений}.",
+	keyПроверкаЕщё:           "…и ещё {число}. Полный отчёт: <code>./app -validate</code>",
+	keyПроверкаЗаголовок:     "{лист}, заголовок",
+	keyПроверкаСтрока:        "{лист}, строка {строка}",
+
+	keyКонфигПеречитана:      "Конфигурация перечитана, тексты и кэш обновлены.",
+	keyКонфигБезИзменений:    "Изменений в настройках нет.",
+	keyКонфигПрименено:       "Применено:",
+	keyКонфигНуженПерезапуск: "Нужен перезапуск (пока действует прежнее значение):",
+	keyКонфигПусто:           "(пусто)",
+
+	keyПодсказкаОтмена:           "Отмена — /cancel.",
+	keyАдмНазваниеКатегории:      "Введите название новой категории:",
+	keyАдмДоступКатегории:        "Правило доступа (роли, @username, ID, #группа) или «-» — категория видна всем:",
+	keyАдмВыберитеКатегорию:      "Выберите категорию:",
+	keyАдмКатегорийНет:           "Категорий нет. Добавьте категорию командой /addcat.",
+	keyАдмВыберитеДокумент:       "Выберите документ:",
+	keyАдмДокументовНет:          "В этой категории нет документов.",
+	keyАдмНазваниеДокумента:      "Введите название документа:",
+	keyАдмИмяФайла:               "«-» — взять имя файла.",
+	keyАдмОписание:               "Введите описание или «-» — без описания:",
+	keyАдмИсточник:               "Отправьте ссылку на файл (Яндекс.Диск или другая https-ссылка) или загрузите файл документом:",
+	keyАдмНужнаСсылкаИлиФайл:     "Нужна ссылка http(s):// или файл документом.",
+	keyАдмДобавитьФайл:           "Добавить файл «{файл}» как документ. Выберите категорию:",
+	keyАдмЧтоИзменить:            "«{название}»: что изменить?",
+	keyАдмЗаменаФайла:            "Загрузите файл документом. Ссылка будет очищена, документ будет отдаваться этим файлом.",
+	keyАдмЗагрузитеФайл:          "Загрузите файл документом.",
+	keyАдмПравилоДоступа:         "Введите правило доступа (роли, @username, ID, #группа) или «-» — виден всем:",
+	keyАдмНовоеОписание:          "Введите новое описание или «-» — без описания:",
+	keyАдмДоставка:               "Режим доставки: zip, original или auto; «-» — по умолчанию (DELIVERY_MODE):",
+	keyАдмДоставкаОшибка:         "Допустимо: zip, original, auto или «-».",
+	keyАдмНовоеЗначение:          "Введите новое значение:",
+	keyАдмНужнаСсылка:            "Нужна ссылка http(s)://.",
+	keyАдмПустоеНазвание:         "Название не может быть пустым.",
+	keyАдмУдалить:                "Удалить документ «{название}»?",
+	keyАдмКудаПеренести:          "Куда перенести «{название}»?",
+	keyОшибкаДобавленияКатегории: "Не удалось добавить категорию.",
+	keyКатегорияДобавлена:        "Категория «{название}» добавлена.",
+	keyОшибкаДобавленияДокумента: "Не удалось добавить документ.",
+	keyДокументДобавлен:          "Документ «{название}» добавлен.",
+	keyОшибкаИзменения:           "Не удалось сохранить изменения.",
+	keyДокументИзменён:           "Документ «{название}» обновлён.",
+	keyДокументИзменёнВерсия:     "Документ «{название}» обновлён, версия {версия}.",
+	keyОшибкаУдаления:            "Не удалось удалить документ.",
+	keyДокументУдалён:            "Документ «{название}» удалён.",
+	keyОшибкаПереноса:            "Не удалось перенести документ.",
+	keyДокументПеренесён:         "Документ «{название}» перенесён в «{категория}».",
+}
+
+// menuButtons — кнопки главного меню (ключ текста -> действие). Нажатие узнаётся по тексту кнопки
+// на любом языке: у пользователя может остаться клавиатура на прежнем языке.
+var menuButtons = []struct{ Key, Action string }{
+	{keyКнопкаДокументы, "docs"},
+	{keyКнопкаПожелания, "wish"},
+	{keyКнопкаЧтоНового, "new"},
+	{keyКнопкаIMO, "imo"},
+}
+
+// textSet — тексты «Настройки_Текста»: язык -> ключ -> текст. Строки без «Языка» — под defaultLang.
+// После загрузки не изменяется: кэш подменяет набор целиком.
+type textSet map[string]map[string]string
+
+// normalizeLang приводит код языка к виду «Настройки_Текста» и /lang: нижний регистр, «_» → «-».
+func normalizeLang(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), "_", "-")
+}
+
+// custom — текст из таблицы: на языке lang, на основном языке региона (pt-br → pt), на языке по
+// умолчанию. "" — в таблице текста нет.
+func (ts textSet) custom(lang, key string) string {
+	lang = normalizeLang(lang)
+	for _, l := range []string{lang, strings.SplitN(lang, "-", 2)[0], defaultLang} {
+		if s, ok := ts[l][key]; ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// text — текст из таблицы или встроенный; ключ без текста возвращается как есть, чтобы пропуск был виден.
+func (ts textSet) text(lang, key string) string {
+	if s := ts.custom(lang, key); s != "" {
+		return s
+	}
+	if s, ok := builtinTexts[key]; ok {
+		return s
+	}
+	return key
+}
+
+// languages — языки, на которых есть тексты (язык по умолчанию есть всегда), по алфавиту.
+func (ts textSet) languages() []string {
+	out := []string{defaultLang}
+	for l := range ts {
+		if l != defaultLang {
+			out = append(out, l)
+		}
+	}
+	sort.Strings(out[1:])
+	return out
+}
+
+// size — число текстов на всех языках.
+func (ts textSet) size() int {
+	n := 0
+	for _, m := range ts {
+		n += len(m)
+	}
+	return n
+}
+
+// tr — тексты на языке одного пользователя.
+type tr struct {
+	texts textSet
+	lang  string
+}
+
+// T — текст по ключу; repl — пары «{имя}», значение: t.T(keyФайлСлишкомВелик, "{лимит}", "50", "{ссылка}", link).
+func (t tr) T(key string, repl ...string) string {
+	s := t.texts.text(t.lang, key)
+	if len(repl) > 0 {
+		s = strings.NewReplacer(repl...).Replace(s)
+	}
+	return s
+}
+
+// Custom — текст из таблицы без встроенного ("" — не задан).
+func (t tr) Custom(key string) string { return t.texts.custom(t.lang, key) }
+
+// statusLabel — статус из таблицы («В работе», «Активен»…) на языке t: текст «Статус_<статус>»
+// (пробелы — «_»), иначе сам статус.
+func statusLabel(t tr, status string) string {
+	if s := t.Custom(keyPrefixСтатус + strings.ReplaceAll(status, " ", "_")); s != "" {
+		return s
+	}
+	return status
+}
+
+// userLang — язык пользователя id: выбранный /lang, иначе language_code из Telegram (tgLang; пустой —
+// последний известный по «Пользователи»).
+func userLang(app *App, id int64, tgLang string) string {
+	if app.Users != nil {
+		if bot, tg, ok := app.Users.Lang(id); ok {
+			if bot != "" {
+				return bot
+			}
+			if tgLang == "" {
+				tgLang = tg
+			}
+		}
+	}
+	return normalizeLang(tgLang)
+}
+
+// trFor — тексты для автора апдейта.
+func trFor(c tele.Context, app *App) tr {
+	if u := c.Sender(); u != nil {
+		return tr{texts: app.Texts(), lang: userLang(app, u.ID, u.LanguageCode)}
+	}
+	return tr{texts: app.Texts(), lang: defaultLang}
+}
+
+// trUser — тексты для получателя уведомления (в личном чате с ботом chat_id = user_id).
+func trUser(app *App, userID int64) tr {
+	return tr{texts: app.Texts(), lang: userLang(app, userID, "")}
+}
+
+// menuAction — действие кнопки главного меню по её тексту на любом языке; "" — не кнопка меню.
+func menuAction(app *App, txt string) string {
+	ts := app.Texts()
+	for _, b := range menuButtons {
+		if txt == builtinTexts[b.Key] {
+			return b.Action
+		}
+		for _, m := range ts {
+			if m[b.Key] != "" && txt == m[b.Key] {
+				return b.Action
+			}
+		}
+	}
+	return ""
+}
+
+// effectiveLang — язык, на котором пользователь с языком lang видит тексты: lang, основной язык региона
+// или язык по умолчанию.
+func effectiveLang(ts textSet, lang string) string {
+	lang = normalizeLang(lang)
+	for _, l := range []string{lang, strings.SplitN(lang, "-", 2)[0]} {
+		if _, ok := ts[l]; ok {
+			return l
+		}
+	}
+	return defaultLang
+}
+
+// langName — название языка для /lang (Язык_Название на нём самом) или его код.
+func langName(ts textSet, lang string) string {
+	if s := ts[lang][keyЯзыкНазвание]; s != "" {
+		return s
+	}
+	if lang == defaultLang {
+		return builtinTexts[keyЯзыкНазвание]
+	}
+	return lang
+}
+
+// onLang — /lang [код|auto]: выбор языка бота. Без аргумента — кнопки языков, на которых есть тексты.
+func onLang(c tele.Context, app *App) error {
+	if args := strings.Fields(c.Text()); len(args) > 1 {
+		return setUserLang(c, app, args[1])
+	}
+	t := trFor(c, app)
+	ts := app.Texts()
+	m := &tele.ReplyMarkup{}
+	var rows []tele.Row
+	for _, l := range ts.languages() {
+		rows = append(rows, m.Row(m.Data(langName(ts, l), "lang", l)))
+	}
+	rows = append(rows, m.Row(m.Data(t.T(keyЯзыкАвто), "lang", "auto")))
+	m.Inline(rows...)
+	return c.Send(t.T(keyЯзыкВыбор), m)
+}
+
+// onLangCallback — кнопка языка (callback lang|код).
+func onLangCallback(c tele.Context, app *App, lang string) error {
+	_ = c.Respond(&tele.CallbackResponse{})
+	if c.Message() != nil {
+		_, _ = c.Bot().EditReplyMarkup(c.Message(), nil)
+	}
+	return setUserLang(c, app, lang)
+}
+
+// setUserLang запоминает язык автора апдейта ("auto" — как в Telegram) и обновляет клавиатуру и меню команд.
+func setUserLang(c tele.Context, app *App, lang string) error {
+	if c.Sender() == nil || app.Users == nil {
+		return nil
+	}
+	lang = normalizeLang(lang)
+	ts := app.Texts()
+	if lang == "auto" {
+		lang = ""
+	} else if _, ok := ts[lang]; !ok && lang != defaultLang {
+		t := trFor(c, app)
+		return c.Send(t.T(keyЯзыкНеизвестен, "{язык}", lang, "{языки}", strings.Join(ts.languages(), ", ")))
+	}
+	app.Users.SetBotLang(c.Sender().ID, lang)
+	t := trFor(c, app)
+	setCommandsForChat(c.Bot(), c.Chat().ID, senderRole(c, app), t)
+	return c.Send(t.T(keyЯзыкВыбран, "{язык}", langName(ts, effectiveLang(ts, t.lang))), mainMenuReply(t))
+}
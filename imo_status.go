@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const imoPollInterval = 1 * time.Minute // как часто проверять смену статусов в «Заявки_IMO»
+
+// imoStatusCodes — короткие коды статусов для callback_data (лимит Telegram 64 байта).
+var imoStatusCodes = map[string]string{
+	"new":  imoСтатусНовая,
+	"work": imoСтатусВРаботе,
+	"ok":   imoСтатусОдобрена,
+	"rej":  imoСтатусОтклонена,
+}
+
+// imoNotifyMu не даёт поллеру и кнопке админа одновременно уведомить пользователя об одном статусе.
+var imoNotifyMu sync.Mutex
+
+// imoAdminMarkup — кнопки смены статуса под уведомлением админам о заявке.
+func imoAdminMarkup(t tr, id string) *tele.ReplyMarkup {
+	m := &tele.ReplyMarkup{}
+	m.Inline(
+		m.Row(m.Data(t.T(keyКнопкаВРаботу), "imo_st", id, "work")),
+		m.Row(m.Data(t.T(keyКнопкаОдобрить), "imo_st", id, "ok"), m.Data(t.T(keyКнопкаОтклонить), "imo_st", id, "rej")),
+	)
+	return m
+}
+
+// imoStatusText возвращает текст уведомления пользователю на языке t. В тексте можно использовать
+// {ФИО} и {Статус}. Для «Новая» уведомление не отправляется — возвращает "".
+func imoStatusText(t tr, r *IMORequest) string {
+	var key string
+	switch r.Статус {
+	case imoСтатусВРаботе:
+		key = keyСтатусВРаботе
+	case imoСтатусОдобрена:
+		key = keyСтатусОдобрена
+	case imoСтатусОтклонена:
+		key = keyСтатусОтклонена
+	default:
+		return ""
+	}
+	return t.T(key, "{ФИО}", r.ФИО, "{Статус}", statusLabel(t, r.Статус))
+}
+
+// notifyIMOStatus уведомляет заявителя о текущем статусе, если он ещё не уведомлён о нём,
+// и записывает статус в «Статус_Уведомления». Заявка перечитывается под imoNotifyMu: поллер и кнопка
+// админа работают со снимками, и без этого оба отправили бы один и тот же статус.
+// Если заявитель недоступен (заблокировал бота, чата нет), статус тоже записывается — иначе поллер
+// повторял бы отправку каждую минуту.
+func notifyIMOStatus(ctx context.Context, bot *tele.Bot, app *App, r *IMORequest) {
+	imoNotifyMu.Lock()
+	defer imoNotifyMu.Unlock()
+	fresh, err := app.Sheets.GetIMORequest(ctx, r.ID)
+	if err != nil {
+		app.Log.Error("GetIMORequest notify", "err", err, "imo_id", r.ID)
+		return
+	}
+	*r = *fresh
+	if r.Статус == r.Уведомлено {
+		return
+	}
+	if msg := imoStatusText(trUser(app, r.UserID), r); msg != "" {
+		if _, err := bot.Send(&tele.Chat{ID: r.UserID}, msg); err != nil {
+			app.Log.Error("notify IMO status", "err", err, "imo_id", r.ID, "chat_id", r.UserID)
+			if !tgUnreachable(err) {
+				return
+			}
+		}
+	}
+	if err := app.Sheets.SetIMONotifiedStatus(ctx, r.SheetRow, r.Статус); err != nil {
+		app.Log.Error("SetIMONotifiedStatus", "err", err)
+		return
+	}
+	r.Уведомлено = r.Статус
+}
+
+// tgUnreachable — ошибка Telegram, после которой повтор отправки не поможет: бот заблокирован,
+// пользователь удалён или не начинал диалог (403), чат не найден.
+func tgUnreachable(err error) bool {
+	var te *tele.Error
+	if errors.As(err, &te) && te.Code == 403 {
+		return true
+	}
+	return errors.Is(err, tele.ErrChatNotFound)
+}
+
+// StartIMOStatusPoller раз в imoPollInterval читает «Заявки_IMO» и уведомляет заявителей,
+// если статус заявки изменили прямо в таблице. Строкам, вписанным вручную без ID_Заявки, он
+// присваивает ID — без него заявку не перечитать под imoNotifyMu.
+func StartIMOStatusPoller(bot *tele.Bot, app *App) {
+	ticker := time.NewTicker(imoPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Long)
+		list, err := app.Sheets.GetIMORequests(ctx)
+		if err != nil {
+			app.Log.Error("GetIMORequests poller", "err", err)
+			cancel()
+			continue
+		}
+		for i := range list {
+			if list[i].ID == "" {
+				id, err := app.Sheets.AssignIMORequestID(ctx, list[i].SheetRow)
+				if err != nil {
+					app.Log.Error("AssignIMORequestID", "err", err, "row", list[i].SheetRow)
+					continue
+				}
+				list[i].ID = id
+			}
+			if list[i].Статус != list[i].Уведомлено {
+				notifyIMOStatus(ctx, bot, app, &list[i])
+			}
+		}
+		cancel()
+	}
+}
+
+// onIMOStatusCallback обрабатывает кнопку смены статуса заявки (callback imo_st|ID|код).
+// Права проверяет commandGuard по callbackTable.
+func onIMOStatusCallback(c tele.Context, app *App, payload string) error {
+	u := ""
+	if c.Sender() != nil {
+		u = c.Sender().Username
+	}
+	parts := strings.SplitN(payload, "|", 2)
+	if len(parts) != 2 {
+		return c.Respond(&tele.CallbackResponse{})
+	}
+	status, ok := imoStatusCodes[parts[1]]
+	if !ok {
+		return c.Respond(&tele.CallbackResponse{})
+	}
+	t := trFor(c, app)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Action)
+	defer cancel()
+	r, err := app.Sheets.SetIMOStatus(ctx, parts[0], status)
+	if err != nil {
+		logFor(c, app).Error("SetIMOStatus", "err", err)
+		return c.Respond(&tele.CallbackResponse{Text: sheetsErrText(t, err, keyОшибкаСтатуса)})
+	}
+	line := t.T(keyСтатусЗаявки, "{статус}", statusLabel(t, status))
+	_ = c.Respond(&tele.CallbackResponse{Text: line})
+
+	if msg := c.Message(); msg != nil {
+		// Прежний статус — строка, начинающаяся как keyСтатусЗаявки до {статус}.
+		text := msg.Text
+		if prefix, _, _ := strings.Cut(t.T(keyСтатусЗаявки), "{статус}"); prefix != "" {
+			if i := strings.Index(text, "\n\n"+prefix); i >= 0 {
+				text = text[:i]
+			}
+		}
+		if u != "" {
+			line += " (@" + u + ")"
+		}
+		text += "\n\n" + line
+		var opts []interface{}
+		if status != imoСтатусОдобрена && status != imoСтатусОтклонена {
+			opts = append(opts, imoAdminMarkup(t, r.ID))
+		}
+		_, _ = c.Bot().Edit(msg, text, opts...)
+	}
+	notifyIMOStatus(ctx, c.Bot(), app, r)
+	return nil
+}
+
+// onMyStatus — /mystatus: список заявок пользователя со статусами.
+func onMyStatus(c tele.Context, app *App) error {
+	if c.Sender() == nil {
+		return nil
+	}
+	t := trFor(c, app)
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Request)
+	defer cancel()
+	list, err := app.Sheets.GetIMORequests(ctx)
+	if err != nil {
+		logFor(c, app).Error("GetIMORequests /mystatus", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаЗаявок))
+	}
+	var blocks []string
+	for _, r := range list {
+		if r.UserID != c.Sender().ID {
+			continue
+		}
+		blocks = append(blocks, t.T(keyЗаявкаСтрока, "{дата}", html.EscapeString(r.Дата), "{статус}", html.EscapeString(statusLabel(t, r.Статус)), "{ФИО}", html.EscapeString(r.ФИО)))
+	}
+	if len(blocks) == 0 {
+		return c.Send(t.T(keyЗаявокНет))
+	}
+	return c.Send(t.T(keyВашиЗаявки)+"\n\n"+strings.Join(blocks, "\n\n"), tele.ModeHTML)
+}
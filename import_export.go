@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Импорт и экспорт любого листа схемы (-import / -export): CSV, TSV, JSON, XLSX — по расширению файла.
+// Импорт сверяет заголовок файла со sheetHeaders и работает в одном из режимов:
+//   - merge (по умолчанию): строки с известным ключом обновляются (только изменившиеся ячейки колонок
+//     из файла), остальные дописываются в конец; для листов без ключа — только дописываются;
+//   - replace: лист целиком заменяется содержимым файла (заголовок листа сохраняется).
+
+const (
+	importMerge   = "merge"
+	importReplace = "replace"
+)
+
+// sheetKeys — колонка-ключ листа для merge. Листы журналов (логи, пожелания, скачивания) ключа не имеют.
+var sheetKeys = map[string]string{
+	sheetНастройкиТекста: "Ключ",
+	sheetКатегории:       "ID",
+	sheetДокументы:       docColID,
+	sheetЗаявкиIMO:       "ID_Заявки",
+	sheetПользователи:    "ID_Пользователя",
+	sheetАдмины:          "Юзернейм",
+	sheetДоступы:         "ID",
+}
+
+// sheetKeyQualifiers — колонка, уточняющая ключ merge: переводы одного «Ключа» различаются «Языком».
+var sheetKeyQualifiers = map[string]string{
+	sheetНастройкиТекста: "Язык",
+}
+
+// readGridFile читает файл (формат — по расширению) как строки; первая строка — заголовок.
+func readGridFile(file, sheet string) ([][]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM из Excel
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return readDelimited(data, ',')
+	case ".tsv", ".tab":
+		return readDelimited(data, '\t')
+	case ".json":
+		return readGridJSON(data, sheet)
+	case ".xlsx":
+		return readXLSX(data, sheet)
+	}
+	return nil, fmt.Errorf("%s: неизвестный формат (нужен .csv, .tsv, .json или .xlsx)", file)
+}
+
+func readDelimited(data []byte, comma rune) ([][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = comma == '\t'
+	return r.ReadAll()
+}
+
+// readGridJSON понимает формат -export и -backup ({"header": [...], "rows": [{...}]}) и простой массив
+// объектов [{"Колонка": "значение"}] — тогда колонки идут в порядке схемы листа.
+func readGridJSON(data []byte, sheet string) ([][]string, error) {
+	var objs []map[string]interface{}
+	var header []string
+	var wrapped struct {
+		Header []string                 `json:"header"`
+		Rows   []map[string]interface{} `json:"rows"`
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &objs); err != nil {
+			return nil, fmt.Errorf("JSON: %w", err)
+		}
+		seen := make(map[string]bool)
+		for _, h := range sheetHeaders[sheet] {
+			seen[h] = true
+		}
+		var known, extra []string
+		used := make(map[string]bool)
+		for _, o := range objs {
+			for k := range o {
+				used[k] = true
+			}
+		}
+		for _, h := range sheetHeaders[sheet] {
+			if used[h] {
+				known = append(known, h)
+			}
+		}
+		for k := range used {
+			if !seen[k] {
+				extra = append(extra, k)
+			}
+		}
+		sort.Strings(extra)
+		header = append(known, extra...)
+	} else {
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, fmt.Errorf("JSON: %w", err)
+		}
+		header, objs = wrapped.Header, wrapped.Rows
+	}
+	grid := [][]string{header}
+	for _, o := range objs {
+		row := make([]string, len(header))
+		for j, h := range header {
+			if v, ok := o[h]; ok && v != nil {
+				row[j] = strCell(v)
+			}
+		}
+		grid = append(grid, row)
+	}
+	return grid, nil
+}
+
+// writeGridFile пишет grid (первая строка — заголовок) в файл; формат — по расширению.
+func writeGridFile(file, sheet string, grid [][]string) error {
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv", ".tsv", ".tab":
+		w := csv.NewWriter(&buf)
+		if ext := strings.ToLower(filepath.Ext(file)); ext != ".csv" {
+			w.Comma = '\t'
+		}
+		if err := w.WriteAll(grid); err != nil {
+			return err
+		}
+	case ".json":
+		data, err := json.MarshalIndent(gridToJSON(sheet, grid), "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	case ".xlsx":
+		if err := writeXLSX(&buf, sheet, grid); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: неизвестный формат (нужен .csv, .tsv, .json или .xlsx)", file)
+	}
+	return os.WriteFile(file, buf.Bytes(), 0o640)
+}
+
+// exportSheet выгружает лист целиком в файл и возвращает число строк данных.
+func exportSheet(ctx context.Context, api *SheetsAPI, sheet, file string) (int, error) {
+	if _, ok := sheetHeaders[sheet]; !ok {
+		return 0, fmt.Errorf("листа %q нет в схеме (%s)", sheet, strings.Join(sortedSheets(), ", "))
+	}
+	grid, err := readSheetGrid(ctx, api, sheet)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeGridFile(file, sheet, grid); err != nil {
+		return 0, err
+	}
+	return max(len(grid)-1, 0), nil
+}
+
+// importHeader сверяет заголовок файла со схемой листа и возвращает названия колонок по схеме.
+// Колонка без заголовка допустима, только если в ней нет значений (проверяет importSheet).
+// Все ошибки (неизвестные и повторённые колонки) собираются в одну.
+func importHeader(sheet string, header []string) ([]string, error) {
+	known := make(map[string]bool)
+	for _, h := range sheetHeaders[sheet] {
+		known[h] = true
+	}
+	cols := make([]string, len(header))
+	seen := make(map[string]int)
+	var errs []string
+	for i, h := range header {
+		c := canonicalHeader(h)
+		col := colToLetter(i + 1)
+		switch {
+		case c == "":
+		case !known[c]:
+			errs = append(errs, fmt.Sprintf("колонка %s: «%s» нет в схеме листа", col, h))
+		default:
+			if prev, dup := seen[c]; dup {
+				errs = append(errs, fmt.Sprintf("колонка %s: «%s» уже есть в колонке %s", col, c, colToLetter(prev+1)))
+			}
+			seen[c] = i
+		}
+		cols[i] = c
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("заголовок файла не совпадает со схемой листа %s (%s):\n  %s",
+			sheet, strings.Join(sheetHeaders[sheet], ", "), strings.Join(errs, "\n  "))
+	}
+	return cols, nil
+}
+
+// importRow — строка файла: номер строки в файле и значения по колонкам схемы.
+type importRow struct {
+	Line   int
+	Values map[string]string
+}
+
+// importSheet загружает файл в лист в режиме mode (importMerge / importReplace). План изменений
+// печатается в w; при dryRun таблица не меняется.
+func importSheet(ctx context.Context, api *SheetsAPI, sheet, file, mode string, dryRun bool, w io.Writer) error {
+	if _, ok := sheetHeaders[sheet]; !ok {
+		return fmt.Errorf("листа %q нет в схеме (%s)", sheet, strings.Join(sortedSheets(), ", "))
+	}
+	if mode != importMerge && mode != importReplace {
+		return fmt.Errorf("режим %q: нужен %s или %s", mode, importMerge, importReplace)
+	}
+	grid, err := readGridFile(file, sheet)
+	if err != nil {
+		return err
+	}
+	if len(grid) == 0 {
+		return fmt.Errorf("%s: файл пуст", file)
+	}
+	cols, err := importHeader(sheet, grid[0])
+	if err != nil {
+		return err
+	}
+	var rows []importRow
+	for i, rec := range grid[1:] {
+		r := importRow{Line: i + 2, Values: make(map[string]string, len(cols))}
+		empty := true
+		for j, c := range cols {
+			if j >= len(rec) {
+				continue
+			}
+			v := strings.TrimSpace(rec[j])
+			if c == "" {
+				if v != "" {
+					return fmt.Errorf("строка %d файла: значение в колонке %s без заголовка", i+2, colToLetter(j+1))
+				}
+				continue
+			}
+			r.Values[c] = v
+			empty = empty && v == ""
+		}
+		if !empty {
+			rows = append(rows, r)
+		}
+	}
+	if !dryRun {
+		if err := api.EnsureSheets(ctx); err != nil {
+			return err
+		}
+	}
+	t, err := api.readTable(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		if _, ok := t.cols[c]; !ok && c != "" {
+			return fmt.Errorf("в листе %s нет колонки %s — запустите бота (миграции) или -validate", sheet, c)
+		}
+	}
+	fmt.Fprintf(w, "%s ← %s: строк в файле %d, режим %s\n", sheet, file, len(rows), mode)
+	if mode == importReplace {
+		err = importReplaceRows(ctx, api, t, rows, dryRun, w)
+	} else {
+		err = importMergeRows(ctx, api, t, cols, rows, dryRun, w)
+	}
+	if err == nil && dryRun {
+		fmt.Fprintln(w, "Пробный запуск (-dry-run): таблица не изменена.")
+	}
+	return err
+}
+
+// importReplaceRows заменяет строки данных листа строками файла.
+func importReplaceRows(ctx context.Context, api *SheetsAPI, t *table, rows []importRow, dryRun bool, w io.Writer) error {
+	current, err := readSheetGrid(ctx, api, t.sheet)
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, i := range t.cols {
+		width = max(width, i+1)
+	}
+	grid := [][]string{{}}
+	if len(current) > 0 {
+		grid[0] = current[0]
+	}
+	for _, r := range rows {
+		line := make([]string, width)
+		for c, v := range r.Values {
+			line[t.cols[c]] = v
+		}
+		grid = append(grid, line)
+	}
+	if printGridDiff(w, t.sheet, current, grid) == 0 || dryRun {
+		return nil
+	}
+	return writeSheetGrid(ctx, api, t.sheet, current, grid)
+}
+
+// importMergeRows обновляет строки по ключу и дописывает новые.
+func importMergeRows(ctx context.Context, api *SheetsAPI, t *table, cols []string, rows []importRow, dryRun bool, w io.Writer) error {
+	key := sheetKeys[t.sheet]
+	hasKey := false
+	for _, c := range cols {
+		hasKey = hasKey || (c == key && key != "")
+	}
+	if key != "" && !hasKey {
+		return fmt.Errorf("для %s нужна колонка-ключ «%s» (пустой ключ — новая строка) или режим %s", importMerge, key, importReplace)
+	}
+	qual := sheetKeyQualifiers[t.sheet]
+	// mergeKey — ключ строки с уточнением (язык приводится к виду normalizeLang); "" — ключа нет.
+	mergeKey := func(get func(col string) string) string {
+		k := normalizeImportKey(key, get(key))
+		if k == "" || qual == "" {
+			return k
+		}
+		return k + "\x00" + normalizeLang(get(qual))
+	}
+	existing := make(map[string]int) // ключ -> индекс в t.rows
+	for i, row := range t.rows {
+		if k := mergeKey(func(col string) string { return t.get(row, col) }); k != "" {
+			if _, dup := existing[k]; !dup {
+				existing[k] = i
+			}
+		}
+	}
+	inFile := make(map[string]int)
+	var data []*sheets.ValueRange
+	var appends [][]interface{}
+	var lines []string
+	changedRows := 0
+	note := func(format string, args ...interface{}) {
+		if len(lines) < backupDiffLines {
+			lines = append(lines, fmt.Sprintf(format, args...))
+		}
+	}
+	for _, r := range rows {
+		k := ""
+		if hasKey {
+			k = mergeKey(func(col string) string { return r.Values[col] })
+		}
+		if k != "" {
+			if prev, dup := inFile[k]; dup {
+				return fmt.Errorf("строка %d файла: ключ %s уже был в строке %d", r.Line, r.Values[key], prev)
+			}
+			inFile[k] = r.Line
+		}
+		idx, found := existing[k]
+		if k == "" || !found {
+			row := make([]interface{}, len(sheetHeaders[t.sheet]))
+			for i, h := range sheetHeaders[t.sheet] {
+				row[i] = r.Values[h]
+			}
+			appends = append(appends, row)
+			note("  + строка %d файла: %s", r.Line, diffText(importRowText(cols, r)))
+			continue
+		}
+		sheetRow := idx + 2
+		changed := false
+		for _, c := range cols {
+			old := t.get(t.rows[idx], c)
+			if c == "" || c == key || (c == qual && normalizeLang(r.Values[c]) == normalizeLang(old)) || r.Values[c] == old {
+				continue
+			}
+			changed = true
+			data = append(data, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!%s%d", t.sheet, colToLetter(t.cols[c]+1), sheetRow),
+				Values: [][]interface{}{{r.Values[c]}},
+			})
+			note("  строка %d (%s): %s: %s → %s", sheetRow, r.Values[key], c, diffText(old), diffText(r.Values[c]))
+		}
+		if changed {
+			changedRows++
+		}
+	}
+	fmt.Fprintf(w, "== %s: обновится строк %d (ячеек %d), добавится %d\n", t.sheet, changedRows, len(data), len(appends))
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+	if total := len(data) + len(appends); total > len(lines) {
+		fmt.Fprintf(w, "  …и ещё %d\n", total-len(lines))
+	}
+	if dryRun {
+		return nil
+	}
+	if len(data) > 0 {
+		if err := api.batchUpdateValues(ctx, data); err != nil {
+			return err
+		}
+	}
+	if len(appends) > 0 {
+		if err := api.appendRows(ctx, t.sheet, appends, "RAW"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeImportKey — ключ для сравнения: юзернеймы админов без @ и регистра.
+func normalizeImportKey(key, v string) string {
+	v = strings.TrimSpace(v)
+	if key == "Юзернейм" {
+		return strings.ToLower(strings.TrimPrefix(v, "@"))
+	}
+	return v
+}
+
+// importRowText — значения строки файла в порядке колонок файла.
+func importRowText(cols []string, r importRow) string {
+	vals := make([]string, len(cols))
+	for i, c := range cols {
+		vals[i] = r.Values[c]
+	}
+	return joinRow(vals)
+}
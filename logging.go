@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Логирование: slog с несколькими приёмниками — stderr (JSON или текст), файл с ротацией по размеру
+// и листы «Логи_Ошибок» / «Логи_Сервера» (пачками, с ограничением числа запросов к Sheets).
+
+const (
+	sheetsLogFlushInterval = 5 * time.Second // как часто сбрасывать накопленные записи в таблицу
+	sheetsLogBatch         = 200             // строк в одном запросе Append
+	sheetsLogQueue         = 1000            // очередь записей; при переполнении лишние отбрасываются
+)
+
+// lookupLogLevel — уровень по имени (debug, info, warn / warning, error); false — имя неизвестно.
+func lookupLogLevel(s string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return 0, false
+}
+
+// logControl — общие для всех ботов процесса приёмники (stderr и LOG_FILE) и их уровень, который
+// меняется без перезапуска. Листы логов у каждого бота свои — см. withSheets.
+type logControl struct {
+	level    slog.LevelVar
+	handlers []slog.Handler
+	closers  []func()
+}
+
+// newLogger собирает логгер stderr и LOG_FILE по настройкам cfg (без записи в таблицу).
+func newLogger(cfg *Config) (*slog.Logger, *logControl) {
+	lc := &logControl{}
+	lc.level.Set(cfg.LogLevel)
+	opts := &slog.HandlerOptions{Level: &lc.level}
+	if cfg.LogFormat == "text" {
+		lc.handlers = append(lc.handlers, slog.NewTextHandler(os.Stderr, opts))
+	} else {
+		lc.handlers = append(lc.handlers, slog.NewJSONHandler(os.Stderr, opts))
+	}
+	if cfg.LogFile != "" {
+		rf, err := newRotatingFile(cfg.LogFile, cfg.LogFileMaxMB*1024*1024, cfg.LogFileBackups)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "LOG_FILE %s: %v\n", cfg.LogFile, err)
+		} else {
+			lc.handlers = append(lc.handlers, slog.NewJSONHandler(rf, opts))
+			lc.closers = append(lc.closers, func() { _ = rf.Close() })
+		}
+	}
+	return slog.New(fanoutHandler(lc.handlers)), lc
+}
+
+// apply применяет log.level; формат и файл — только при запуске.
+func (lc *logControl) apply(cfg *Config) {
+	lc.level.Set(cfg.LogLevel)
+}
+
+// Close закрывает файл лога. Вызывать после Close всех sheetsLog.
+func (lc *logControl) Close() {
+	for _, c := range lc.closers {
+		c()
+	}
+}
+
+// sheetsLog — запись логов бота в листы его таблицы; уровень и лимит меняются без перезапуска.
+type sheetsLog struct {
+	level slog.LevelVar
+	sink  *sheetsSink
+}
+
+// withSheets — логгер бота cfg: общие приёмники (у дополнительных ботов — с атрибутом tenant) и листы
+// логов таблицы api.
+func (lc *logControl) withSheets(cfg *Config, api *SheetsAPI) (*slog.Logger, *sheetsLog) {
+	sl := &sheetsLog{sink: newSheetsSink(api, cfg.LogSheetsPerMin)}
+	sl.level.Set(cfg.LogSheetsLevel)
+	handlers := make([]slog.Handler, 0, len(lc.handlers)+1)
+	for _, h := range lc.handlers {
+		if cfg.Tenant != "" {
+			h = h.WithAttrs([]slog.Attr{slog.String("tenant", cfg.Tenant)})
+		}
+		handlers = append(handlers, h)
+	}
+	handlers = append(handlers, &sheetsHandler{sink: sl.sink, level: &sl.level})
+	return slog.New(fanoutHandler(handlers)), sl
+}
+
+// apply применяет log.sheets_level и log.sheets_per_min.
+func (sl *sheetsLog) apply(cfg *Config) {
+	sl.level.Set(cfg.LogSheetsLevel)
+	sl.sink.perMin.Store(int64(cfg.LogSheetsPerMin))
+}
+
+// Close дописывает в таблицу накопленные записи.
+func (sl *sheetsLog) Close(ctx context.Context) {
+	sl.sink.Close(ctx)
+}
+
+// fanoutHandler передаёт запись всем приёмникам, которые принимают её уровень.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, x := range h {
+		if x.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, x := range h {
+		if !x.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := x.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, x := range h {
+		out[i] = x.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, x := range h {
+		out[i] = x.WithGroup(name)
+	}
+	return out
+}
+
+// rotatingFile — файл лога, который при превышении maxBytes переименовывается в path.1
+// (старые — в path.2 … path.N, N = backups), а запись продолжается в новый файл.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	f        *os.File
+	size     int64
+}
+
+func newRotatingFile(path string, maxBytes int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxBytes: maxBytes, backups: backups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	rf.f, rf.size = f, st.Size()
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	_ = rf.f.Close()
+	for i := rf.backups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	if rf.backups > 0 {
+		_ = os.Rename(rf.path, rf.path+".1")
+	} else {
+		_ = os.Remove(rf.path)
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.maxBytes > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxBytes {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.f.Close()
+}
+
+var _ io.WriteCloser = (*rotatingFile)(nil)
+
+// sheetsLogRow — строка для листа логов.
+type sheetsLogRow struct {
+	sheet string
+	row   []interface{}
+}
+
+// sheetsSink копит записи и раз в sheetsLogFlushInterval дописывает их в таблицу — по одному запросу
+// на лист, не больше perMin запросов в минуту. Что не влезло в лимит, ждёт следующего сброса;
+// при переполнении очереди записи отбрасываются, а их число пишется в «Логи_Сервера».
+type sheetsSink struct {
+	api     *SheetsAPI
+	perMin  atomic.Int64 // меняется при перезагрузке конфигурации
+	ch      chan sheetsLogRow
+	stop    chan chan struct{}
+	dropped atomic.Int64
+
+	window time.Time // начало текущей минуты лимита
+	used   int       // запросов в текущей минуте
+}
+
+func newSheetsSink(api *SheetsAPI, perMin int) *sheetsSink {
+	s := &sheetsSink{api: api, ch: make(chan sheetsLogRow, sheetsLogQueue), stop: make(chan chan struct{})}
+	s.perMin.Store(int64(perMin))
+	go s.run()
+	return s
+}
+
+func (s *sheetsSink) enqueue(r sheetsLogRow) {
+	select {
+	case s.ch <- r:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *sheetsSink) run() {
+	ticker := time.NewTicker(sheetsLogFlushInterval)
+	defer ticker.Stop()
+	var pending []sheetsLogRow
+	for {
+		select {
+		case r := <-s.ch:
+			pending = append(pending, r)
+			if len(pending) > sheetsLogQueue {
+				s.dropped.Add(int64(len(pending) - sheetsLogQueue))
+				pending = pending[len(pending)-sheetsLogQueue:]
+			}
+		case <-ticker.C:
+			pending = s.flush(context.Background(), pending, false)
+		case done := <-s.stop:
+			for len(s.ch) > 0 {
+				pending = append(pending, <-s.ch)
+			}
+			s.flush(context.Background(), pending, true)
+			close(done)
+			return
+		}
+	}
+}
+
+// allow — можно ли сделать ещё один запрос в этой минуте.
+func (s *sheetsSink) allow(now time.Time) bool {
+	if now.Sub(s.window) >= time.Minute {
+		s.window, s.used = now, 0
+	}
+	if perMin := int(s.perMin.Load()); perMin > 0 && s.used >= perMin {
+		return false
+	}
+	s.used++
+	return true
+}
+
+// flush пишет pending в таблицу и возвращает то, что не удалось отправить из-за лимита или бюджета
+// квоты Sheets (запись логов несрочная, см. lowPriority). final — последний сброс при остановке:
+// ограничения не учитываются.
+func (s *sheetsSink) flush(ctx context.Context, pending []sheetsLogRow, final bool) []sheetsLogRow {
+	if n := s.dropped.Swap(0); n > 0 {
+		pending = append(pending, sheetsLogRow{sheetЛогиСервера, []interface{}{
+			time.Now().Format("2006-01-02 15:04:05"), slog.LevelWarn.String(), fmt.Sprintf("Логи: пропущено %d записей (переполнена очередь)", n),
+		}})
+	}
+	if !final {
+		ctx = lowPriority(ctx)
+	}
+	for len(pending) > 0 {
+		if !final && !s.allow(time.Now()) {
+			return pending
+		}
+		// Одна пачка — подряд идущие строки одного листа.
+		sheet := pending[0].sheet
+		var rows [][]interface{}
+		i := 0
+		for ; i < len(pending) && len(rows) < sheetsLogBatch && pending[i].sheet == sheet; i++ {
+			rows = append(rows, pending[i].row)
+		}
+		batch := pending[:i]
+		pending = pending[i:]
+		wctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := s.api.AppendLogRows(wctx, sheet, rows)
+		cancel()
+		if errors.Is(err, ErrSheetsDeferred) {
+			// Бюджет квоты почти исчерпан — пачка ждёт следующего сброса.
+			mSheetsDeferred.AddTenant(s.api.tenant, "log", float64(len(rows)))
+			return append(batch, pending...)
+		}
+		if err != nil {
+			// Не через slog — иначе ошибка записи логов снова попадёт в очередь.
+			fmt.Fprintf(os.Stderr, "sheets log sink: %s: %v (потеряно строк: %d)\n", sheet, err, len(rows))
+		}
+	}
+	return nil
+}
+
+// Close дописывает накопленные записи; ждёт не дольше, чем позволяет ctx.
+func (s *sheetsSink) Close(ctx context.Context) {
+	done := make(chan struct{})
+	select {
+	case s.stop <- done:
+	case <-ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// sheetsHandler — приёмник slog для таблицы. Error и выше — в «Логи_Ошибок» [Дата | Ошибка | Контекст]
+// (Ошибка — атрибут err, если есть, иначе сообщение), остальное — в «Логи_Сервера» [Дата | Уровень | Сообщение].
+type sheetsHandler struct {
+	sink   *sheetsSink
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // группы WithGroup: "g1.g2."
+}
+
+func (h *sheetsHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *sheetsHandler) Handle(_ context.Context, r slog.Record) error {
+	errText := ""
+	var fields []string
+	add := func(a slog.Attr) {
+		if a.Key == "err" && errText == "" {
+			errText = a.Value.String()
+			return
+		}
+		fields = append(fields, a.Key+"="+a.Value.String())
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		a.Key = h.prefix + a.Key
+		add(a)
+		return true
+	})
+	date := r.Time.Format("2006-01-02 15:04:05")
+	if r.Level >= slog.LevelError {
+		msg, ctxText := r.Message, strings.Join(fields, " ")
+		if errText != "" {
+			msg, ctxText = errText, strings.TrimSpace(r.Message+" "+ctxText)
+		}
+		h.sink.enqueue(sheetsLogRow{sheetЛогиОшибок, []interface{}{date, msg, ctxText}})
+		return nil
+	}
+	msg := r.Message
+	if errText != "" {
+		fields = append([]string{"err=" + errText}, fields...)
+	}
+	if len(fields) > 0 {
+		msg += " " + strings.Join(fields, " ")
+	}
+	h.sink.enqueue(sheetsLogRow{sheetЛогиСервера, []interface{}{date, r.Level.String(), msg}})
+	return nil
+}
+
+func (h *sheetsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := *h
+	out.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		out.attrs = append(out.attrs, a)
+	}
+	return &out
+}
+
+func (h *sheetsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	out := *h
+	out.prefix = h.prefix + name + "."
+	return &out
+}
+
+// logFor возвращает логгер апдейта (с update_id, user_id, handler) или общий логгер приложения.
+func logFor(c tele.Context, app *App) *slog.Logger {
+	if l, ok := c.Get("log").(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return app.Log
+}
+
+// loggingMiddleware кладёт в контекст логгер с полями апдейта и пишет итог обработки:
+// debug — время, error — ошибка, которую вернул обработчик.
+func loggingMiddleware(app *App) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			l := app.Log.With("update_id", c.Update().ID, "handler", handlerLabel(c))
+			if s := c.Sender(); s != nil {
+				l = l.With("user_id", s.ID)
+			}
+			c.Set("log", l)
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				l.Error("обработчик вернул ошибку", "err", err)
+			} else {
+				l.Debug("апдейт обработан", "duration", time.Since(start))
+			}
+			return err
+		}
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 	"os/signal"
@@ -13,118 +13,97 @@ import (
 	"sync"
 	"syscall"
 	"time"
-
-	tele "gopkg.in/telebot.v3"
-)
-
-const (
-	minFreeBytes    = 100 * 1024 * 1024 // 100 МБ — минимум свободного места для скачивания
-	cleanupMaxAge   = 30 * time.Minute  // удалять файлы в /tmp старше 30 минут
-	cleanupInterval = 1 * time.Hour     // проверка раз в час
 )
 
 func main() {
-	_ = loadEnv()
-
-	// -log "сообщение" — запись в Логи_Сервера и выход (для deploy.sh)
-	for i := 1; i < len(os.Args)-1; i++ {
-		if os.Args[i] == "-log" {
-			cfg, err := LoadConfig()
-			if err != nil || cfg.SpreadsheetID == "" {
-				log.Fatal("Для -log нужны SPREADSHEET_ID и CREDENTIALS_PATH в .env")
-			}
-			ctx := context.Background()
-			api, err := NewSheetsAPI(ctx, cfg.SpreadsheetID, cfg.CredentialsPath)
-			if err != nil {
-				log.Fatalf("Sheets API: %v", err)
-			}
-			_ = api.EnsureSchema(ctx)
-			if err := api.LogToSheets(ctx, "Info", os.Args[i+1]); err != nil {
-				log.Fatalf("LogToSheets: %v", err)
-			}
-			os.Exit(0)
-		}
-	}
-
-	for _, a := range os.Args[1:] {
-		if a == "-fill-settings" {
-			fillSettings()
-			os.Exit(0)
-		}
-		if a == "-fill-test-data" {
-			fillTestData()
-			os.Exit(0)
-		}
-	}
-
-	cfg, err := LoadConfig()
-	if err != nil || cfg.BotToken == "" || cfg.SpreadsheetID == "" {
-		log.Fatal("Нужны BOT_TOKEN и SPREADSHEET_ID (и CREDENTIALS_PATH к ключу Service Account). См. env.example.")
+	if err := loadEnv(); err != nil {
+		log.Printf(".env: %v", err)
+		os.Exit(exitError)
 	}
+	os.Exit(runCLI(os.Args[1:]))
+}
 
+// runBot — команда run (и запуск без аргументов): боты работают до SIGINT / SIGTERM.
+// Основной бот и дополнительные из [tenants.<имя>] — в одном процессе; с --tenant — только этот бот.
+func runBot() int {
 	ctx := context.Background()
-	sheetsAPI, err := NewSheetsAPI(ctx, cfg.SpreadsheetID, cfg.CredentialsPath)
-	if err != nil {
-		log.Fatalf("Sheets API: %v", err)
+	cfg, sheetsAPI, ok := bootstrap(ctx, "run", true)
+	if !ok {
+		return exitError
 	}
-
-	// EnsureSchema с retry и таймаутом (сеть может быть нестабильна)
-	ensureCtx, ensureCancel := context.WithTimeout(ctx, 30*time.Second)
-	defer ensureCancel()
-	if err := sheetsAPI.EnsureSchema(ensureCtx); err != nil {
-		log.Printf("WARNING: EnsureSchema failed (будет повтор при следующем запросе): %v", err)
-		// Не падаем, бот может работать без EnsureSchema (если схема уже создана)
+	root := cfg
+	if cliTenant != "" {
+		root, _ = LoadConfig() // уже прочитана в bootstrap; нужен только список ботов
 	}
+	tenantNames := root.TenantNames()
 
-	cache := newCache(sheetsAPI, cfg.CacheTTLMin)
-	cache.reload(ctx)
-
-	yd := NewYandexDownloader(cfg.YandexMaxMB * 1024 * 1024)
-
-	fsm := newFSM()
+	// Логгер: stderr и LOG_FILE общие; slog.SetDefault перенаправляет и стандартный log.
+	logger, logCtl := newLogger(cfg)
+	slog.SetDefault(logger)
+	pool := newDownloadPool(cfg.DownloadWorkers)
 
-	app := &App{
-		Sheets:  sheetsAPI,
-		Yandex:  yd,
-		Cfg:     cfg,
-		GetText: cache.getText,
-		GetCategories: func() ([]Category, error) {
-			return cache.getCategories(ctx)
-		},
-		IsAdmin: func(chatID int64, username string) bool {
-			return cache.isAdmin(chatID, username)
-		},
-		GetState:   fsm.get,
-		SetState:   fsm.set,
-		ResetState: fsm.reset,
-		LogError: func(e, c string) {
-			sheetsAPI.LogError(context.Background(), e, c)
-		},
-		OnReload: func() {
-			cache.reload(ctx)
-		},
-	}
-
-	pref := tele.Settings{Token: cfg.BotToken, Poller: &tele.LongPoller{Timeout: 10 * time.Second}}
-	bot, err := tele.NewBot(pref)
+	primary, err := startTenant(ctx, cfg, sheetsAPI, tenantNames, logCtl, pool)
 	if err != nil {
-		log.Fatalf("telebot: %v", err)
+		logger.Error("Бот не запущен", "err", err)
+		logCtl.Close()
+		return exitError
+	}
+	// Записи без бота (очистка, HTTP-сервер) идут и в листы логов основного бота.
+	slog.SetDefault(primary.log)
+	tenants := []*tenant{primary}
+	stopAll := func() {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), primary.live.Get().Timeouts.Shutdown)
+		defer stopCancel()
+		for _, t := range tenants {
+			t.stop(stopCtx)
+		}
+		logCtl.Close()
+	}
+	if cliTenant == "" {
+		for _, tc := range cfg.Tenants {
+			api, err := newSheetsFor(ctx, tc)
+			if err == nil {
+				var t *tenant
+				if t, err = startTenant(ctx, tc, api, tenantNames, logCtl, pool); err == nil {
+					tenants = append(tenants, t)
+					continue
+				}
+			}
+			logger.Error("Бот не запущен", "tenant", tc.Tenant, "err", err)
+			stopAll()
+			return exitError
+		}
 	}
 
-	RegisterHandlers(bot, app)
-	go StartCleanupWorker()
-	log.Println("Бот запущен.")
-	_ = sheetsAPI.LogToSheets(ctx, "Старт", "Бот запущен")
-
-	// Запуск бота в горутине
-	go bot.Start()
+	go StartCleanupWorker(cfg.CleanupMaxAge, cfg.CleanupInterval)
+	if cfg.HTTPAddr != "" {
+		health := make(healthGroup, 0, len(tenants))
+		for _, t := range tenants {
+			health = append(health, t.health)
+		}
+		go StartHTTPServer(cfg.HTTPAddr, health)
+	}
+	for _, t := range tenants {
+		go t.run()
+		t.log.Info("Бот запущен")
+	}
 
-	// Ожидание сигнала остановки
+	// SIGHUP — перечитать конфигурацию; SIGINT / SIGTERM — остановка.
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-	_ = sheetsAPI.LogToSheets(context.Background(), "Остановка", "Бот остановлен")
-	os.Exit(0)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		for _, t := range tenants {
+			t.reload()
+		}
+	}
+	for _, t := range tenants {
+		t.log.Info("Бот остановлен")
+	}
+	stopAll()
+	return exitOK
 }
 
 // getFreeSpaceBytes возвращает свободное место в байтах для пути (например os.TempDir()).
@@ -140,9 +119,9 @@ func getFreeSpaceBytes(path string) (uint64, error) {
 	return st.Bavail * uint64(st.Bsize), nil
 }
 
-// StartCleanupWorker раз в час удаляет bugchat-*, каталоги bulk_* и single_* старше 30 минут.
-func StartCleanupWorker() {
-	ticker := time.NewTicker(cleanupInterval)
+// StartCleanupWorker раз в interval удаляет bugchat-*, каталоги bulk_* и single_* старше maxAge.
+func StartCleanupWorker(maxAge, interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	dir := os.TempDir()
 	for range ticker.C {
@@ -160,7 +139,7 @@ func StartCleanupWorker() {
 					if err != nil {
 						continue
 					}
-					if now.Sub(info.ModTime()) >= cleanupMaxAge {
+					if now.Sub(info.ModTime()) >= maxAge {
 						_ = os.RemoveAll(path)
 					}
 				}
@@ -173,7 +152,7 @@ func StartCleanupWorker() {
 			if err != nil {
 				continue
 			}
-			if now.Sub(info.ModTime()) < cleanupMaxAge {
+			if now.Sub(info.ModTime()) < maxAge {
 				continue
 			}
 			_ = os.Remove(path)
@@ -181,121 +160,17 @@ func StartCleanupWorker() {
 	}
 }
 
-func loadEnv() error {
-	data, err := os.ReadFile(".env")
-	if err != nil {
-		return err
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		i := strings.Index(line, "=")
-		if i <= 0 {
-			continue
-		}
-		k, v := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
-		v = strings.Trim(v, "\"'")
-		if k != "" && os.Getenv(k) == "" {
-			_ = os.Setenv(k, v)
-		}
-	}
-	return nil
-}
-
-func fillSettings() {
-	cfg, err := LoadConfig()
-	if err != nil || cfg.SpreadsheetID == "" {
-		log.Fatal("Для -fill-settings нужны SPREADSHEET_ID и CREDENTIALS_PATH в .env. BOT_TOKEN не обязателен.")
-	}
-	ctx := context.Background()
-	api, err := NewSheetsAPI(ctx, cfg.SpreadsheetID, cfg.CredentialsPath)
-	if err != nil {
-		log.Fatalf("Sheets API: %v", err)
-	}
-	if err := api.EnsureSchema(ctx); err != nil {
-		log.Fatalf("EnsureSchema: %v", err)
-	}
-	f, err := os.Open("settings_text.example.csv")
-	if err != nil {
-		log.Fatalf("Открой settings_text.example.csv: %v (запускай из корня проекта)", err)
-	}
-	defer f.Close()
-	recs, err := csv.NewReader(f).ReadAll()
-	if err != nil {
-		log.Fatalf("CSV: %v", err)
-	}
-	var rows [][]interface{}
-	for i, r := range recs {
-		if i == 0 && len(r) >= 2 && r[0] == "Ключ" && r[1] == "Текст" {
-			continue
-		}
-		if len(r) >= 2 && strings.TrimSpace(r[0]) != "" {
-			rows = append(rows, []interface{}{strings.TrimSpace(r[0]), strings.TrimSpace(r[1])})
-		}
-	}
-	if len(rows) == 0 {
-		log.Fatal("В CSV нет строк с Ключ/Текст.")
-	}
-	if err := api.UpdateSettingsText(ctx, rows); err != nil {
-		log.Fatalf("UpdateSettingsText: %v", err)
-	}
-	log.Printf("Записано %d строк в лист «Настройки_Текста».", len(rows))
-}
-
-func fillTestData() {
-	cfg, err := LoadConfig()
-	if err != nil || cfg.SpreadsheetID == "" {
-		log.Fatal("Для -fill-test-data нужны SPREADSHEET_ID и CREDENTIALS_PATH в .env. BOT_TOKEN не обязателен.")
-	}
-	ctx := context.Background()
-	api, err := NewSheetsAPI(ctx, cfg.SpreadsheetID, cfg.CredentialsPath)
-	if err != nil {
-		log.Fatalf("Sheets API: %v", err)
-	}
-	if err := api.EnsureSchema(ctx); err != nil {
-		log.Fatalf("EnsureSchema: %v", err)
-	}
-
-	// Категории: Название, ID (фиксированные ID для привязки документов)
-	categories := [][]interface{}{
-		{"Внутренние документы", "test-cat-internal"},
-		{"Полезные ссылки", "test-cat-links"},
-	}
-	if err := api.WriteSheetData(ctx, sheetКатегории, 2, categories); err != nil {
-		log.Fatalf("Категории: %v", err)
-	}
-	log.Printf("Категории: записано %d строк.", len(categories))
-
-	// Документы: ID_Категории, Название, Описание, Ссылка
-	documents := [][]interface{}{
-		{"test-cat-internal", "Регламент", "Внутренний регламент организации.", "https://example.com/reglament.pdf"},
-		{"test-cat-internal", "Инструкция по ОТ", "Инструкция по охране труда.", "https://example.com/ot.pdf"},
-		{"test-cat-links", "Яндекс.Диск (тест)", "При ссылке на disk.yandex.ru бот попытается скачать файл; при ошибке отправит ссылку.", "https://disk.yandex.ru/i/placeholder"},
-		{"test-cat-links", "Памятка", "Памятка для новичков.", "https://example.com/pamyatka.pdf"},
-	}
-	if err := api.WriteSheetData(ctx, sheetДокументы, 2, documents); err != nil {
-		log.Fatalf("Документы: %v", err)
-	}
-	log.Printf("Документы: записано %d строк.", len(documents))
-
-	// Админы: одна строка-подсказка (замените на свой @username или добавьте свою строку)
-	if err := api.appendRow(ctx, sheetАдмины, []interface{}{"ЗАМЕНИТЕ_НА_СВОЙ_ЮЗЕРНЕЙМ", ""}); err != nil {
-		log.Fatalf("Админы: %v", err)
-	}
-	log.Print("Админы: добавлена строка «ЗАМЕНИТЕ_НА_СВОЙ_ЮЗЕРНЕЙМ» — замените на свой @username или допишите себя вручную.")
-
-	log.Print("Тестовые данные записаны. Запустите бота (go run .) и проверьте: /start, Список документов, Пожелания, Запросить доступ в IMO.")
-}
-
 type cache struct {
 	mu        sync.RWMutex
-	texts     map[string]string
+	texts     textSet
 	cats      []Category
-	chatIDs   map[int64]bool
-	usernames map[string]bool
+	chatIDs   map[int64]Role
+	usernames map[string]Role
+	tags      map[int64]map[string]bool
+	grants    map[int64][]AccessGrant // активные записи «Доступы» по ID пользователя
+	catsErr   error                   // ошибка последней загрузки «Категории»
 	expires   time.Time
+	loadedAt  time.Time // последняя загрузка без ошибок
 	ttl       time.Duration
 	sheets    *SheetsAPI
 }
@@ -304,67 +179,163 @@ func newCache(s *SheetsAPI, ttlMin int) *cache {
 	return &cache{sheets: s, ttl: time.Duration(ttlMin) * time.Minute}
 }
 
-func (c *cache) reload(ctx context.Context) {
-	texts, _ := c.sheets.GetTextSettings(ctx)
-	cats, _ := c.sheets.GetCategories(ctx)
-	chatIDs, usernames, _ := c.sheets.GetAdmins(ctx)
-	// Юзернеймы в нижнем регистре для регистронезависимого isAdmin
-	usernamesNorm := make(map[string]bool)
-	for k := range usernames {
-		usernamesNorm[strings.ToLower(k)] = true
+// setTTL меняет TTL (перезагрузка конфигурации); если новый срок короче, кэш истекает раньше.
+func (c *cache) setTTL(ttlMin int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = time.Duration(ttlMin) * time.Minute
+	if exp := time.Now().Add(c.ttl); exp.Before(c.expires) {
+		c.expires = exp
 	}
+}
+
+func (c *cache) reload(ctx context.Context) {
+	texts, errTexts := c.sheets.GetTextSettings(ctx)
+	cats, errCats := c.sheets.GetCategories(ctx)
+	chatIDs, usernames, errAdmins := c.sheets.GetAdmins(ctx)
+	tags, errTags := c.sheets.GetUserTags(ctx)
+	grants := c.loadGrants(ctx)
+	// Юзернеймы в нижнем регистре для регистронезависимого role
+	usernamesNorm := make(map[string]Role)
+	for k, r := range usernames {
+		usernamesNorm[strings.ToLower(k)] = r
+	}
+	// При ошибке листа (таблица недоступна) остаются прежние данные — бот продолжает отвечать из памяти.
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.texts = texts
-	c.cats = cats
-	c.chatIDs = chatIDs
-	c.usernames = usernamesNorm
+	if errTexts == nil {
+		c.texts = texts
+	}
+	if errCats == nil {
+		c.cats = cats
+	}
+	c.catsErr = errCats
+	if errAdmins == nil {
+		c.chatIDs = chatIDs
+		c.usernames = usernamesNorm
+	}
+	if errTags == nil {
+		c.tags = tags
+	}
+	if grants != nil {
+		c.grants = grants
+	}
 	c.expires = time.Now().Add(c.ttl)
+	if errTexts == nil && errCats == nil && errAdmins == nil && errTags == nil {
+		c.loadedAt = time.Now()
+	}
+}
+
+// age — время с последней полностью успешной загрузки кэша (для /readyz); false — успешной загрузки не было.
+func (c *cache) age() (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.loadedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(c.loadedAt), true
 }
 
 func (c *cache) ensure(ctx context.Context) {
 	c.mu.Lock()
 	if time.Now().Before(c.expires) {
 		c.mu.Unlock()
+		mCacheRequests.IncTenant(c.sheets.tenant, "hit")
 		return
 	}
 	c.mu.Unlock()
+	mCacheRequests.IncTenant(c.sheets.tenant, "miss")
 	c.reload(ctx)
 }
 
-func (c *cache) getText(k string) string {
+// getTexts — тексты «Настройки_Текста» по языкам. Набор не изменяется, его можно читать без блокировки.
+func (c *cache) getTexts() textSet {
 	c.ensure(context.Background())
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.texts[k]
+	return c.texts
 }
 
 func (c *cache) getCategories(ctx context.Context) ([]Category, error) {
 	c.ensure(ctx)
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	if c.cats == nil && c.catsErr != nil {
+		return nil, c.catsErr
+	}
 	out := make([]Category, len(c.cats))
 	copy(out, c.cats)
 	return out, nil
 }
 
-func (c *cache) isAdmin(chatID int64, username string) bool {
+// role возвращает роль админа по ID чата или юзернейму; "" — не админ.
+func (c *cache) role(chatID int64, username string) Role {
 	c.ensure(context.Background())
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if c.chatIDs[chatID] {
-		return true
+	if r, ok := c.chatIDs[chatID]; ok {
+		return r
 	}
 	u := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(username, "@")))
-	return u != "" && c.usernames[u]
+	if u == "" {
+		return ""
+	}
+	return c.usernames[u]
+}
+
+// loadGrants читает «Доступы» и оставляет записи со статусом «Активен». При ошибке — nil.
+func (c *cache) loadGrants(ctx context.Context) map[int64][]AccessGrant {
+	list, err := c.sheets.GetAccessGrants(ctx)
+	if err != nil {
+		return nil
+	}
+	out := make(map[int64][]AccessGrant)
+	for _, g := range list {
+		if g.Статус == accessАктивен {
+			out[g.UserID] = append(out[g.UserID], g)
+		}
+	}
+	return out
+}
+
+// reloadGrants перечитывает только «Доступы» — после одобрения или отзыва доступ меняется сразу.
+func (c *cache) reloadGrants(ctx context.Context) {
+	grants := c.loadGrants(ctx)
+	if grants == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.grants = grants
+}
+
+// userTags возвращает теги пользователя: из «Пользователи» и группы из действующих записей «Доступы».
+func (c *cache) userTags(userID int64) map[string]bool {
+	c.ensure(context.Background())
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	out := make(map[string]bool, len(c.tags[userID]))
+	for t := range c.tags[userID] {
+		out[t] = true
+	}
+	for i := range c.grants[userID] {
+		if g := &c.grants[userID][i]; g.Active(now) {
+			out[g.Группа] = true
+		}
+	}
+	return out
 }
 
 type fsm struct {
 	mu    sync.RWMutex
 	state map[int64]string
+	data  map[int64]map[string]string // данные многошаговых диалогов; очищаются вместе с состоянием
 }
 
-func newFSM() *fsm { return &fsm{state: make(map[int64]string)} }
+func newFSM() *fsm {
+	return &fsm{state: make(map[int64]string), data: make(map[int64]map[string]string)}
+}
 
 func (f *fsm) get(uid int64) string {
 	f.mu.RLock()
@@ -377,9 +348,25 @@ func (f *fsm) set(uid int64, s string) {
 	defer f.mu.Unlock()
 	if s == "" {
 		delete(f.state, uid)
+		delete(f.data, uid)
 	} else {
 		f.state[uid] = s
 	}
 }
 
 func (f *fsm) reset(uid int64) { f.set(uid, "") }
+
+func (f *fsm) getData(uid int64, key string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.data[uid][key]
+}
+
+func (f *fsm) setData(uid int64, key, val string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.data[uid] == nil {
+		f.data[uid] = make(map[string]string)
+	}
+	f.data[uid][key] = val
+}
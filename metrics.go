@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Метрики в текстовом формате Prometheus (без внешних зависимостей). HTTP-сервер с /metrics, /healthz
+// и /readyz включается переменной HTTP_ADDR (например, 127.0.0.1:9090); счётчики собираются всегда.
+
+// metric — серия метрик с одной меткой (label пуст — без меток).
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   []metric
+)
+
+func register(m metric) {
+	metricsMu.Lock()
+	metrics = append(metrics, m)
+	metricsMu.Unlock()
+}
+
+// seriesName — имя серии с меткой: name{label="value"}.
+func seriesName(name, label, value, extra string) string {
+	var parts []string
+	if label != "" {
+		parts = append(parts, label+"="+strconv.Quote(value))
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+// valueVec — счётчик (counter) или датчик (gauge) с одной меткой. У метрик бота (tenant) серии ещё
+// и с меткой tenant — имя бота, "" у основного; их меняют только методы …Tenant.
+type valueVec struct {
+	name, help, typ, label string
+	tenant                 bool
+	mu                     sync.Mutex
+	vals                   map[string]float64
+}
+
+func newValueVec(typ, name, help, label string) *valueVec {
+	v := &valueVec{name: name, help: help, typ: typ, label: label, vals: make(map[string]float64)}
+	register(v)
+	return v
+}
+
+func newCounter(name, help, label string) *valueVec { return newValueVec("counter", name, help, label) }
+func newGauge(name, help, label string) *valueVec   { return newValueVec("gauge", name, help, label) }
+
+// newTenantCounter и newTenantGauge — метрики с меткой tenant: у каждого бота своя таблица и свои серии.
+func newTenantCounter(name, help, label string) *valueVec {
+	v := newCounter(name, help, label)
+	v.tenant = true
+	return v
+}
+
+func newTenantGauge(name, help, label string) *valueVec {
+	v := newGauge(name, help, label)
+	v.tenant = true
+	return v
+}
+
+// tenantKey — ключ серии бота tenant: имя бота и значение метки через \x00.
+func tenantKey(tenant, value string) string { return tenant + "\x00" + value }
+
+// Add прибавляет delta к серии с меткой value (для метрик без меток value = "").
+func (v *valueVec) Add(value string, delta float64) {
+	v.mu.Lock()
+	v.vals[value] += delta
+	v.mu.Unlock()
+}
+
+func (v *valueVec) Inc(value string) { v.Add(value, 1) }
+
+// Set задаёт значение датчика.
+func (v *valueVec) Set(value string, x float64) {
+	v.mu.Lock()
+	v.vals[value] = x
+	v.mu.Unlock()
+}
+
+// AddTenant прибавляет delta к серии value бота tenant.
+func (v *valueVec) AddTenant(tenant, value string, delta float64) {
+	v.Add(tenantKey(tenant, value), delta)
+}
+
+func (v *valueVec) IncTenant(tenant, value string) { v.AddTenant(tenant, value, 1) }
+
+// SetTenant задаёт значение датчика бота tenant.
+func (v *valueVec) SetTenant(tenant, value string, x float64) {
+	v.Set(tenantKey(tenant, value), x)
+}
+
+func (v *valueVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+	keys := make([]string, 0, len(v.vals))
+	for k := range v.vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, extra := k, ""
+		if v.tenant {
+			var tenant string
+			tenant, value, _ = strings.Cut(k, "\x00")
+			extra = "tenant=" + strconv.Quote(tenant)
+		}
+		fmt.Fprintf(w, "%s %s\n", seriesName(v.name, v.label, value, extra), formatFloat(v.vals[k]))
+	}
+}
+
+// defaultBuckets — границы гистограмм длительности, секунды.
+var defaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type histSeries struct {
+	counts []uint64 // по границам buckets (не накопительно)
+	sum    float64
+	count  uint64
+}
+
+// histogramVec — гистограмма длительностей с одной меткой.
+type histogramVec struct {
+	name, help, label string
+	buckets           []float64
+	mu                sync.Mutex
+	series            map[string]*histSeries
+}
+
+func newHistogram(name, help, label string) *histogramVec {
+	h := &histogramVec{name: name, help: help, label: label, buckets: defaultBuckets, series: make(map[string]*histSeries)}
+	register(h)
+	return h
+}
+
+// Observe добавляет наблюдение x (секунды) в серию value.
+func (h *histogramVec) Observe(value string, x float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[value]
+	if s == nil {
+		s = &histSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[value] = s
+	}
+	for i, b := range h.buckets {
+		if x <= b {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += x
+	s.count++
+}
+
+// Since — Observe(value, time.Since(start)); удобно в defer.
+func (h *histogramVec) Since(value string, start time.Time) {
+	h.Observe(value, time.Since(start).Seconds())
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s %d\n", seriesName(h.name+"_bucket", h.label, k, `le="`+formatFloat(b)+`"`), cum)
+		}
+		fmt.Fprintf(w, "%s %d\n", seriesName(h.name+"_bucket", h.label, k, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s %s\n", seriesName(h.name+"_sum", h.label, k, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", seriesName(h.name+"_count", h.label, k, ""), s.count)
+	}
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// Метрики бота.
+var (
+	mHandlerDuration = newHistogram("bugchat_handler_duration_seconds", "Время обработки апдейта по обработчику.", "handler")
+	mSheetsRequests  = newCounter("bugchat_sheets_requests_total", "Запросы к Google Sheets API по методу.", "method")
+	mSheetsErrors    = newCounter("bugchat_sheets_errors_total", "Ошибки Google Sheets API по методу.", "method")
+	mSheetsRetries   = newTenantCounter("bugchat_sheets_retries_total", "Повторы запросов к Google Sheets API (429, 5xx, сеть) по методу.", "method")
+	mSheetsCoalesced = newTenantCounter("bugchat_sheets_coalesced_total", "Чтения Sheets API, получившие результат уже идущего такого же запроса.", "method")
+	mSheetsBudget    = newTenantGauge("bugchat_sheets_budget_used", "Запросов к Sheets API за последнюю минуту: read, write.", "kind")
+	mSheetsDeferred  = newTenantCounter("bugchat_sheets_deferred_total", "Несрочные записи, отложенные из-за бюджета квоты: log, user.", "kind")
+	mSheetsBreaker   = newTenantGauge("bugchat_sheets_breaker_open", "Предохранитель Sheets API: 1 — разомкнут, запросы сразу отклоняются.", "")
+	mSheetsDuration  = newHistogram("bugchat_sheets_request_duration_seconds", "Время запроса к Google Sheets API по методу.", "method")
+	mCacheRequests   = newTenantCounter("bugchat_cache_requests_total", "Обращения к кэшу таблицы: hit — из памяти, miss — перечитывание.", "result")
+	mDownloadQueue   = newGauge("bugchat_download_queue_depth", "Скачивания в очереди и в работе: single — документ, bulk — «Скачать все».", "kind")
+	mYandexBytes     = newCounter("bugchat_yandex_bytes_total", "Байт скачано с Яндекс.Диска (и прочих ссылок) для отправки.", "")
+	mZipDuration     = newHistogram("bugchat_zip_build_duration_seconds", "Время упаковки ZIP: single — документ, bulk — «Скачать все».", "kind")
+	mBroadcast       = newGauge("bugchat_broadcast", "Последняя рассылка /send: recipients, sent, failed, running (1 — идёт).", "state")
+	mBackups         = newCounter("bugchat_backups_total", "Резервные копии таблицы по расписанию: ok, error.", "result")
+	mTelegramErrors  = newCounter("bugchat_telegram_errors_total", "Ошибки Telegram Bot API по коду ответа (network — сетевая ошибка).", "code")
+)
+
+// knownCallbacks — префиксы callback_data, которые попадают в метку handler; прочие — callback:other.
+var knownCallbacks = map[string]bool{
+	"back_cats": true, "cat": true, "dl_all": true, "imo_st": true, "acc_req": true, "acc": true, "adm": true,
+}
+
+// handlerLabel — метка обработчика для апдейта: /команда, callback:префикс, text, document или other.
+// Неизвестные команды и префиксы сводятся к одной метке, чтобы число серий не росло.
+func handlerLabel(c tele.Context) string {
+	switch {
+	case c.Callback() != nil:
+		if u := callbackUnique(c.Callback().Data); knownCallbacks[u] {
+			return "callback:" + u
+		}
+		return "callback:other"
+	case c.Message() != nil && c.Message().Document != nil:
+		return "document"
+	case c.Message() != nil:
+		if cmd := commandOf(c.Text()); cmd != "" {
+			if _, ok := findSpec(commandTable, cmd); ok {
+				return "/" + cmd
+			}
+			return "/other"
+		}
+		return "text"
+	}
+	return "other"
+}
+
+// metricsMiddleware замеряет время обработки апдейта.
+func metricsMiddleware(next tele.HandlerFunc) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		defer mHandlerDuration.Since(handlerLabel(c), time.Now())
+		return next(c)
+	}
+}
+
+// sheetsMethod определяет метод Sheets API по запросу REST (values.get, values.append, spreadsheets.batchUpdate…).
+func sheetsMethod(r *http.Request) string {
+	p := r.URL.Path
+	i := strings.Index(p, "/values")
+	if i < 0 {
+		if strings.HasSuffix(p, ":batchUpdate") {
+			return "spreadsheets.batchUpdate"
+		}
+		return "spreadsheets." + strings.ToLower(r.Method)
+	}
+	rest := p[i+len("/values"):]
+	if strings.HasPrefix(rest, ":") {
+		return "values." + rest[1:]
+	}
+	for _, verb := range []string{"append", "clear"} {
+		if strings.HasSuffix(rest, ":"+verb) {
+			return "values." + verb
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return "values.get"
+	case http.MethodPut:
+		return "values.update"
+	}
+	return "values." + strings.ToLower(r.Method)
+}
+
+// sheetsMetricsTransport считает запросы, ошибки и время запросов к Sheets API.
+type sheetsMetricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *sheetsMetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	method := sheetsMethod(r)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	mSheetsDuration.Since(method, start)
+	mSheetsRequests.Inc(method)
+	if err != nil || resp.StatusCode >= 400 {
+		mSheetsErrors.Inc(method)
+	}
+	return resp, err
+}
+
+// telegramMetricsTransport считает ответы Bot API с ошибкой по HTTP-коду (он совпадает с error_code).
+type telegramMetricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *telegramMetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	switch {
+	case err != nil:
+		mTelegramErrors.Inc("network")
+	case resp.StatusCode != http.StatusOK:
+		mTelegramErrors.Inc(strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// writeMetrics выводит все метрики в текстовом формате Prometheus.
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	list := append([]metric(nil), metrics...)
+	metricsMu.Unlock()
+	for _, m := range list {
+		m.write(w)
+	}
+}
+
+// StartHTTPServer поднимает HTTP-сервер на addr: /metrics, /healthz, /readyz. Вызывать в горутине.
+func StartHTTPServer(addr string, health healthGroup) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+	mux.HandleFunc("/healthz", health.handleHealthz)
+	mux.HandleFunc("/readyz", health.handleReadyz)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("HTTP-сервер запущен", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("HTTP-сервер остановлен", "err", err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"strings"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Role — роль админа из колонки «Роль» листа «Админы». Пустая строка — не админ.
+type Role string
+
+const (
+	roleOwner     Role = "owner"     // все права
+	roleEditor    Role = "editor"    // документы, категории, кэш
+	roleModerator Role = "moderator" // заявки и пожелания
+	roleNotifier  Role = "notifier"  // только уведомления
+)
+
+// roleAliases — допустимые значения колонки «Роль» (без учёта регистра).
+// Пустая колонка означает owner: так в старых таблицах все админы сохраняют прежние права.
+var roleAliases = map[string]Role{
+	"":            roleOwner,
+	"owner":       roleOwner,
+	"владелец":    roleOwner,
+	"editor":      roleEditor,
+	"редактор":    roleEditor,
+	"moderator":   roleModerator,
+	"модератор":   roleModerator,
+	"notifier":    roleNotifier,
+	"уведомления": roleNotifier,
+}
+
+// parseRole разбирает значение колонки «Роль». Неизвестная роль — без прав ("").
+func parseRole(s string) Role {
+	return roleAliases[strings.ToLower(strings.TrimSpace(s))]
+}
+
+// commandSpec — команда (или префикс callback_data) и роли, которым она доступна.
+// owner имеет доступ ко всему и в Roles не указывается; Public — доступна всем пользователям.
+type commandSpec struct {
+	Command     string
+	Description string // пустое — не показывать в меню команд
+	Public      bool
+	Roles       []Role
+}
+
+// commandTable — таблица прав: по ней работают commandGuard и меню setCommandsForChat.
+var commandTable = []commandSpec{
+	{Command: "start", Description: "Начать", Public: true},
+	{Command: "mystatus", Description: "Мои заявки", Public: true},
+	{Command: "lang", Description: "Язык", Public: true},
+	{Command: "send", Description: "Рассылка"},
+	{Command: "reload", Description: "Сброс кэша", Roles: []Role{roleEditor}},
+	{Command: "reloadconfig", Description: "Перечитать конфигурацию"},
+	{Command: "stats", Description: "Статистика скачиваний", Roles: []Role{roleEditor}},
+	{Command: "doctor", Description: "Проверка таблицы", Roles: []Role{roleEditor}},
+	{Command: "revoke", Description: "Отозвать доступ", Roles: []Role{roleModerator}},
+	{Command: "addcat", Description: "Добавить категорию", Roles: []Role{roleEditor}},
+	{Command: "adddoc", Description: "Добавить документ", Roles: []Role{roleEditor}},
+	{Command: "editdoc", Description: "Изменить документ", Roles: []Role{roleEditor}},
+	{Command: "deldoc", Description: "Удалить документ", Roles: []Role{roleEditor}},
+	{Command: "movedoc", Description: "Перенести документ", Roles: []Role{roleEditor}},
+	{Command: "notifydoc", Description: "Уведомить об обновлении документа", Roles: []Role{roleEditor}},
+	{Command: "cancel", Public: true},
+}
+
+// callbackTable — права на inline-кнопки по префиксу callback_data (Unique).
+var callbackTable = []commandSpec{
+	{Command: "imo_st", Roles: []Role{roleModerator}},
+	{Command: "acc", Roles: []Role{roleModerator}},
+	{Command: "adm", Roles: []Role{roleEditor}},
+}
+
+// Типы уведомлений админам.
+const (
+	notifyWish   = "wish"
+	notifyIMO    = "imo"
+	notifyAccess = "access"
+)
+
+// notifyRoles — какие роли получают уведомления каждого типа (owner — все).
+var notifyRoles = map[string][]Role{
+	notifyWish:   {roleModerator, roleNotifier},
+	notifyIMO:    {roleModerator, roleNotifier},
+	notifyAccess: {roleModerator, roleNotifier},
+}
+
+// roleAllowed — есть ли у роли доступ к allowed. owner разрешено всё.
+func roleAllowed(role Role, allowed []Role) bool {
+	if role == roleOwner {
+		return true
+	}
+	for _, r := range allowed {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// canUse — доступна ли команда спецификации роли role.
+func (s commandSpec) canUse(role Role) bool {
+	if s.Public {
+		return true
+	}
+	return role != "" && roleAllowed(role, s.Roles)
+}
+
+// canNotify — получает ли роль уведомления типа kind.
+func canNotify(role Role, kind string) bool {
+	return role != "" && roleAllowed(role, notifyRoles[kind])
+}
+
+// commandOf возвращает имя команды без "/" и @botname, если text — команда; иначе "".
+func commandOf(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	cmd := strings.Fields(text)[0][1:]
+	if i := strings.Index(cmd, "@"); i >= 0 {
+		cmd = cmd[:i]
+	}
+	return cmd
+}
+
+// callbackUnique возвращает Unique из callback_data ("\f" + Unique + "|" + Data).
+func callbackUnique(data string) string {
+	data = strings.TrimPrefix(data, "\f")
+	if i := strings.Index(data, "|"); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
+
+func findSpec(table []commandSpec, name string) (commandSpec, bool) {
+	for _, s := range table {
+		if s.Command == name {
+			return s, true
+		}
+	}
+	return commandSpec{}, false
+}
+
+// senderRole возвращает роль автора апдейта.
+func senderRole(c tele.Context, app *App) Role {
+	u := ""
+	if c.Sender() != nil {
+		u = c.Sender().Username
+	}
+	return app.GetRole(c.Chat().ID, u)
+}
+
+// commandGuard — middleware: команды и inline-кнопки из commandTable/callbackTable
+// пропускаются только ролям с доступом. Прочие апдейты проходят без проверки.
+func commandGuard(app *App) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if cb := c.Callback(); cb != nil {
+				if spec, ok := findSpec(callbackTable, callbackUnique(cb.Data)); ok && !spec.canUse(senderRole(c, app)) {
+					return c.Respond(&tele.CallbackResponse{Text: trFor(c, app).T(keyНедостаточноПрав)})
+				}
+				return next(c)
+			}
+			if spec, ok := findSpec(commandTable, commandOf(c.Text())); ok && !spec.canUse(senderRole(c, app)) {
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
+
+// setCommandsForChat выставляет меню команд чата по роли: обычным пользователям — только публичные команды.
+// Описание команды — текст «Команда_<команда>» на языке t, иначе Description.
+func setCommandsForChat(b *tele.Bot, chatID int64, role Role, t tr) {
+	var cmds []tele.Command
+	for _, s := range commandTable {
+		if s.Description != "" && s.canUse(role) {
+			desc := t.Custom(keyPrefixКоманда + s.Command)
+			if desc == "" {
+				desc = s.Description
+			}
+			cmds = append(cmds, tele.Command{Text: s.Command, Description: desc})
+		}
+	}
+	scope := tele.CommandScope{Type: tele.CommandScopeChat, ChatID: chatID}
+	_ = b.SetCommands(cmds, scope)
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Схема таблицы: колонки ищутся по заголовку (первая строка), а не по букве, и версионные миграции
+// со служебным скрытым листом «_Schema» (Версия | Дата | Описание).
+
+const sheetSchema = "_Schema"
+
+// headerAliases — прежние названия колонок: при чтении понимаются как новые, миграция их переименовывает.
+var headerAliases = map[string]string{
+	"File_ID":          "Telegram_File_ID",
+	"File_ID_Оригинал": "Telegram_File_ID_Оригинал",
+}
+
+// canonicalHeader — название колонки по схеме для заголовка из таблицы.
+func canonicalHeader(h string) string {
+	h = strings.TrimSpace(h)
+	if c, ok := headerAliases[h]; ok {
+		return c
+	}
+	return h
+}
+
+// headerIndex — номер колонки (с 0) по названию из схемы. Повтор заголовка — берётся первый.
+func headerIndex(row []interface{}) map[string]int {
+	idx := make(map[string]int, len(row))
+	for i, c := range row {
+		h := canonicalHeader(strCell(c))
+		if _, dup := idx[h]; h != "" && !dup {
+			idx[h] = i
+		}
+	}
+	return idx
+}
+
+// headerCache — последние прочитанные заголовки листов; обновляется при каждом readTable.
+type headerCache struct {
+	mu sync.Mutex
+	m  map[string]map[string]int
+}
+
+func (c *headerCache) get(sheet string) (map[string]int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx, ok := c.m[sheet]
+	return idx, ok
+}
+
+func (c *headerCache) set(sheet string, idx map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]map[string]int)
+	}
+	c.m[sheet] = idx
+}
+
+// reset забывает заголовки всех листов (после миграций и /reload).
+func (c *headerCache) reset() {
+	c.mu.Lock()
+	c.m = nil
+	c.mu.Unlock()
+}
+
+// ResetColumns забывает заголовки листов: следующая запись перечитает их (после ручной правки колонок, /reload).
+func (s *SheetsAPI) ResetColumns() { s.headers.reset() }
+
+// table — содержимое листа с заголовком: строки данных rows[i] лежат в строке листа i+2.
+type table struct {
+	sheet string
+	cols  map[string]int
+	rows  [][]interface{}
+}
+
+// get — значение колонки name в строке row (обрезанное; "" — нет колонки или ячейки).
+func (t *table) get(row []interface{}, name string) string {
+	i, ok := t.cols[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(strCell(row[i]))
+}
+
+// readTable читает лист целиком вместе с заголовком и запоминает заголовок для записи.
+func (s *SheetsAPI) readTable(ctx context.Context, sheet string) (*table, error) {
+	resp, err := s.getValues(ctx, sheet+"!A1:ZZ")
+	if err != nil {
+		return nil, fmt.Errorf("Values.Get %s: %w", sheet, err)
+	}
+	t := &table{sheet: sheet, cols: map[string]int{}}
+	if len(resp.Values) > 0 {
+		t.cols = headerIndex(resp.Values[0])
+		t.rows = resp.Values[1:]
+	}
+	s.headers.set(sheet, t.cols)
+	return t, nil
+}
+
+// columns возвращает заголовок листа: из кэша или прочитав первую строку.
+func (s *SheetsAPI) columns(ctx context.Context, sheet string) (map[string]int, error) {
+	if idx, ok := s.headers.get(sheet); ok {
+		return idx, nil
+	}
+	resp, err := s.getValues(ctx, sheet+"!A1:ZZ1")
+	if err != nil {
+		return nil, fmt.Errorf("Values.Get %s заголовок: %w", sheet, err)
+	}
+	idx := map[string]int{}
+	if len(resp.Values) > 0 {
+		idx = headerIndex(resp.Values[0])
+	}
+	s.headers.set(sheet, idx)
+	return idx, nil
+}
+
+// colLetter — буква колонки name листа sheet.
+func (s *SheetsAPI) colLetter(ctx context.Context, sheet, name string) (string, error) {
+	idx, err := s.columns(ctx, sheet)
+	if err != nil {
+		return "", err
+	}
+	i, ok := idx[name]
+	if !ok {
+		return "", fmt.Errorf("в листе %s нет колонки %s", sheet, name)
+	}
+	return colToLetter(i + 1), nil
+}
+
+// alignRows раскладывает строки, собранные в порядке sheetHeaders[sheet], по фактическим колонкам листа.
+// Пустые значения колонок, которых нет в листе, пропускаются; непустые — ошибка.
+func (s *SheetsAPI) alignRows(ctx context.Context, sheet string, rows [][]interface{}) ([][]interface{}, error) {
+	headers := sheetHeaders[sheet]
+	idx, err := s.columns(ctx, sheet)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]interface{}, len(rows))
+	for r, row := range rows {
+		width := 0
+		for i := range row {
+			if i < len(headers) {
+				if j, ok := idx[headers[i]]; ok && j+1 > width {
+					width = j + 1
+				}
+			}
+		}
+		aligned := make([]interface{}, width)
+		for i := range aligned {
+			aligned[i] = ""
+		}
+		for i, v := range row {
+			if i >= len(headers) {
+				return nil, fmt.Errorf("лист %s: в строке больше значений, чем колонок в схеме", sheet)
+			}
+			j, ok := idx[headers[i]]
+			if !ok {
+				if strCell(v) != "" {
+					return nil, fmt.Errorf("в листе %s нет колонки %s", sheet, headers[i])
+				}
+				continue
+			}
+			aligned[j] = v
+		}
+		out[r] = aligned
+	}
+	return out, nil
+}
+
+// updateCells записывает значения в колонки (по названию) строки sheetRow одним запросом.
+func (s *SheetsAPI) updateCells(ctx context.Context, sheet string, sheetRow int, values map[string]interface{}) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	data := make([]*sheets.ValueRange, 0, len(names))
+	for _, name := range names {
+		col, err := s.colLetter(ctx, sheet, name)
+		if err != nil {
+			return err
+		}
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!%s%d", sheet, col, sheetRow),
+			Values: [][]interface{}{{values[name]}},
+		})
+	}
+	if len(data) == 1 {
+		return s.updateValues(ctx, data[0].Range, data[0])
+	}
+	return s.batchUpdateValues(ctx, data)
+}
+
+// migration — шаг схемы. Up должен быть идемпотентным: на частично мигрированной таблице
+// (например, после сбоя посередине) повторный запуск безопасен.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, s *SheetsAPI) error
+}
+
+// migrations — все миграции по возрастанию версии. Новые — только в конец, с версией на 1 больше.
+var migrations = []migration{
+	{1, "Недостающие колонки во всех листах", func(ctx context.Context, s *SheetsAPI) error {
+		for _, sheet := range sheetNames(schemaV1Headers) {
+			if err := s.addColumns(ctx, sheet, schemaV1Headers[sheet]...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{2, "File_ID → Telegram_File_ID в «Документы»", func(ctx context.Context, s *SheetsAPI) error {
+		for old, name := range headerAliases {
+			if err := s.renameColumn(ctx, sheetДокументы, old, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{3, "Порядок колонок по схеме", func(ctx context.Context, s *SheetsAPI) error {
+		for _, sheet := range sheetNames(schemaV1Headers) {
+			if err := s.reorderColumns(ctx, sheet, schemaV1Headers[sheet]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{4, "Версия = 1 в «Документы», Статус = Новая в «Заявки_IMO»", func(ctx context.Context, s *SheetsAPI) error {
+		if err := s.backfillColumn(ctx, sheetДокументы, docColВерсия, func(t *table, row []interface{}) string {
+			if t.get(row, docColНазвание) == "" {
+				return ""
+			}
+			return "1"
+		}); err != nil {
+			return err
+		}
+		return s.backfillColumn(ctx, sheetЗаявкиIMO, "Статус", func(t *table, row []interface{}) string {
+			if t.get(row, "ID_Юзера") == "" {
+				return ""
+			}
+			return imoСтатусНовая
+		})
+	}},
+	{5, "«Язык» в «Настройки_Текста», «Язык_Бота» в «Пользователи»", func(ctx context.Context, s *SheetsAPI) error {
+		if err := s.addColumns(ctx, sheetНастройкиТекста, "Язык"); err != nil {
+			return err
+		}
+		return s.addColumns(ctx, sheetПользователи, "Язык_Бота")
+	}},
+	{6, "UUID в пустых «ID_Заявки» в «Заявки_IMO»", func(ctx context.Context, s *SheetsAPI) error {
+		return s.backfillColumn(ctx, sheetЗаявкиIMO, "ID_Заявки", func(t *table, row []interface{}) string {
+			if t.get(row, "ID_Юзера") == "" {
+				return ""
+			}
+			return uuid.New().String()
+		})
+	}},
+}
+
+// schemaV1Headers — колонки листов на момент миграций 1 и 3. Заморожены: правка sheetHeaders не должна
+// менять смысл уже применённых миграций; новые колонки добавляют следующие миграции (как 5).
+var schemaV1Headers = map[string][]string{
+	sheetНастройкиТекста: {"Ключ", "Текст"},
+	sheetКатегории:       {"Название", "ID", "Доступ"},
+	sheetДокументы:       {"ID_Категории", "Название", "Описание", "Ссылка", "Telegram_File_ID", "Доступ", "ID_Документа", "Доставка", "Telegram_File_ID_Оригинал", "Версия", "Обновлён"},
+	sheetПожелания:       {"Дата", "Юзернейм", "ID_Юзера", "Текст"},
+	sheetЗаявкиIMO:       {"Дата", "Юзернейм", "ID_Юзера", "ФИО", "Телефон", "Должность", "Источник", "Статус", "ID_Заявки", "Статус_Уведомления"},
+	sheetПользователи:    {"ID_Пользователя", "Юзернейм", "Дата_Регистрации", "Теги", "Имя", "Фамилия", "Язык", "Последний_Визит"},
+	sheetАдмины:          {"Юзернейм", "ID_Чата", "Роль"},
+	sheetЛогиОшибок:      {"Дата", "Ошибка", "Контекст"},
+	sheetЛогиСервера:     {"Дата", "Уровень", "Сообщение"},
+	sheetДоступы:         {"ID", "ID_Пользователя", "Юзернейм", "Группа", "Статус", "Дата_Запроса", "Выдан", "Истекает", "Выдал"},
+	sheetИсторияДок:      {"Дата", "ID_Документа", "Название", "Версия", "Ссылка", "Telegram_File_ID", "Telegram_File_ID_Оригинал", "Изменил"},
+	sheetСкачивания:      {"Дата", "ID_Пользователя", "ID_Документа", "Версия", "ID_Категории", "Тип", "Кэш", "Байты", "Результат"},
+}
+
+// sortedSheets — листы схемы в постоянном порядке.
+func sortedSheets() []string { return sheetNames(sheetHeaders) }
+
+// sheetNames — листы headers в постоянном порядке.
+func sheetNames(headers map[string][]string) []string {
+	list := make([]string, 0, len(headers))
+	for sheet := range headers {
+		list = append(list, sheet)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// headerRow читает первую строку листа как есть (без псевдонимов).
+func (s *SheetsAPI) headerRow(ctx context.Context, sheet string) ([]string, error) {
+	resp, err := s.getValues(ctx, sheet+"!A1:ZZ1")
+	if err != nil {
+		return nil, fmt.Errorf("Values.Get %s заголовок: %w", sheet, err)
+	}
+	var out []string
+	if len(resp.Values) > 0 {
+		for _, c := range resp.Values[0] {
+			out = append(out, strings.TrimSpace(strCell(c)))
+		}
+	}
+	return out, nil
+}
+
+// addColumns дописывает в конец первой строки заголовки из names, которых в листе нет.
+func (s *SheetsAPI) addColumns(ctx context.Context, sheet string, names ...string) error {
+	existing, err := s.headerRow(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	has := make(map[string]bool)
+	for _, h := range existing {
+		has[canonicalHeader(h)] = true
+	}
+	var toAdd []interface{}
+	for _, h := range names {
+		if !has[h] {
+			toAdd = append(toAdd, h)
+			has[h] = true
+		}
+	}
+	if len(toAdd) == 0 {
+		return nil
+	}
+	start := len(existing) + 1
+	rng := fmt.Sprintf("%s!%s1:%s1", sheet, colToLetter(start), colToLetter(start+len(toAdd)-1))
+	return s.updateValues(ctx, rng, &sheets.ValueRange{Values: [][]interface{}{toAdd}})
+}
+
+// renameColumn переименовывает заголовок old в name. Нет old или уже есть name — ничего не делает.
+func (s *SheetsAPI) renameColumn(ctx context.Context, sheet, old, name string) error {
+	existing, err := s.headerRow(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	at := -1
+	for i, h := range existing {
+		if h == name {
+			return nil
+		}
+		if h == old && at < 0 {
+			at = i
+		}
+	}
+	if at < 0 {
+		return nil
+	}
+	rng := fmt.Sprintf("%s!%s1", sheet, colToLetter(at+1))
+	return s.updateValues(ctx, rng, &sheets.ValueRange{Values: [][]interface{}{{name}}})
+}
+
+// reorderColumns переставляет колонки листа (вместе с данными и форматированием) в порядке order;
+// колонки не из order остаются справа в прежнем порядке.
+func (s *SheetsAPI) reorderColumns(ctx context.Context, sheet string, order []string) error {
+	existing, err := s.headerRow(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	cur := make([]string, len(existing))
+	for i, h := range existing {
+		cur[i] = canonicalHeader(h)
+	}
+	sheetID := int64(-1)
+	var reqs []*sheets.Request
+	pos := 0
+	for _, name := range order {
+		j := -1
+		for k := pos; k < len(cur); k++ {
+			if cur[k] == name {
+				j = k
+				break
+			}
+		}
+		if j < 0 {
+			continue
+		}
+		if j != pos {
+			if sheetID < 0 {
+				if sheetID, err = s.sheetID(ctx, sheet); err != nil {
+					return err
+				}
+			}
+			reqs = append(reqs, &sheets.Request{MoveDimension: &sheets.MoveDimensionRequest{
+				Source:           &sheets.DimensionRange{SheetId: sheetID, Dimension: "COLUMNS", StartIndex: int64(j), EndIndex: int64(j + 1)},
+				DestinationIndex: int64(pos),
+			}})
+			moved := cur[j]
+			copy(cur[pos+1:j+1], cur[pos:j])
+			cur[pos] = moved
+		}
+		pos++
+	}
+	if len(reqs) == 0 {
+		return nil
+	}
+	return s.batchUpdate(ctx, reqs)
+}
+
+// backfillColumn заполняет пустые ячейки колонки name значением fill (пустой результат — не трогать)
+// одним запросом. Пишутся только пустые ячейки (подряд идущие — одним диапазоном): пустота проверяется
+// по содержимому (FORMULA), поэтому формулы и прочие значения колонки остаются как есть.
+func (s *SheetsAPI) backfillColumn(ctx context.Context, sheet, name string, fill func(t *table, row []interface{}) string) error {
+	t, err := s.readTable(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	col, ok := t.cols[name]
+	if !ok || len(t.rows) == 0 {
+		return nil
+	}
+	letter := colToLetter(col + 1)
+	raw, err := s.getFormulas(ctx, fmt.Sprintf("%s!%s2:%s%d", sheet, letter, letter, len(t.rows)+1))
+	if err != nil {
+		return fmt.Errorf("Values.Get %s %s: %w", sheet, name, err)
+	}
+	empty := func(i int) bool {
+		return i >= len(raw.Values) || len(raw.Values[i]) == 0 || strings.TrimSpace(strCell(raw.Values[i][0])) == ""
+	}
+	var data []*sheets.ValueRange
+	var run *sheets.ValueRange // текущий диапазон подряд идущих заполняемых строк
+	for i, row := range t.rows {
+		v := ""
+		if empty(i) {
+			v = fill(t, row)
+		}
+		if v == "" {
+			run = nil
+			continue
+		}
+		if run == nil {
+			run = &sheets.ValueRange{Range: fmt.Sprintf("%s!%s%d", sheet, letter, i+2)}
+			data = append(data, run)
+		}
+		run.Values = append(run.Values, []interface{}{v})
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return s.batchUpdateValues(ctx, data)
+}
+
+// SchemaVersion — последняя применённая миграция (0 — листа «_Schema» нет или он пуст).
+func (s *SheetsAPI) SchemaVersion(ctx context.Context) (int, error) {
+	resp, err := s.getValues(ctx, sheetSchema+"!A2:A")
+	if err != nil {
+		if isMissingSheet(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Values.Get %s: %w", sheetSchema, err)
+	}
+	v := 0
+	for _, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(strCell(row[0]))); err == nil && n > v {
+			v = n
+		}
+	}
+	return v, nil
+}
+
+// isMissingSheet — ошибка «лист не найден» (диапазон с несуществующим листом).
+func isMissingSheet(err error) bool {
+	return strings.Contains(err.Error(), "Unable to parse range")
+}
+
+// ensureSchemaSheet создаёт скрытый лист «_Schema» с заголовком, если его нет.
+func (s *SheetsAPI) ensureSchemaSheet(ctx context.Context) error {
+	if _, err := s.sheetID(ctx, sheetSchema); err == nil {
+		return nil
+	}
+	err := s.batchUpdate(ctx, []*sheets.Request{{AddSheet: &sheets.AddSheetRequest{
+		Properties: &sheets.SheetProperties{Title: sheetSchema, Hidden: true},
+	}}})
+	if err != nil {
+		return fmt.Errorf("BatchUpdate AddSheet %s: %w", sheetSchema, err)
+	}
+	return s.updateValues(ctx, sheetSchema+"!A1:C1", &sheets.ValueRange{Values: [][]interface{}{{"Версия", "Дата", "Описание"}}})
+}
+
+// Migrate применяет миграции с версией выше записанной в «_Schema», каждую — с отметкой в листе.
+// Возвращает версии до и после.
+func (s *SheetsAPI) Migrate(ctx context.Context) (from, to int, err error) {
+	if err := s.ensureSchemaSheet(ctx); err != nil {
+		return 0, 0, err
+	}
+	from, err = s.SchemaVersion(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	to = from
+	defer s.headers.reset()
+	for _, m := range migrations {
+		if m.Version <= from {
+			continue
+		}
+		if err := m.Up(ctx, s); err != nil {
+			return from, to, fmt.Errorf("миграция %d (%s): %w", m.Version, m.Name, err)
+		}
+		row := []interface{}{strconv.Itoa(m.Version), time.Now().Format("2006-01-02 15:04:05"), m.Name}
+		if err := s.appendValues(ctx, sheetSchema+"!A:C", &sheets.ValueRange{Values: [][]interface{}{row}}, "RAW"); err != nil {
+			return from, to, fmt.Errorf("запись версии %d в %s: %w", m.Version, sheetSchema, err)
+		}
+		to = m.Version
+		s.logger().Info("Схема: применена миграция", "version", m.Version, "name", m.Name)
+	}
+	return from, to, nil
+}
+
+// latestSchemaVersion — версия схемы, которую ожидает эта сборка.
+func latestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
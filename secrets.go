@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+)
+
+// Секреты (токен бота, ключ Google) можно не держать в .env открытым текстом. Источники, от слабого
+// к сильному: файл конфигурации; файл учётных данных systemd ($CREDENTIALS_DIRECTORY/<имя>,
+// LoadCredential=) или секрет Docker (/run/secrets/<имя>); файл из <ПЕРЕМЕННАЯ>_FILE; сама переменная.
+// <имя> — переменная в нижнем регистре: bot_token, google_credentials_json (у дополнительных ботов —
+// tenant_<бот>_bot_token и т. д.). Каталоги systemd и Docker просматриваются, только если переменная
+// не задана. Файл из _FILE или CREDENTIALS_PATH, который может прочитать любой пользователь системы, —
+// ошибка конфигурации: бот не запускается. Для .env и файла конфигурации — только громкое
+// предупреждение: у существующих установок они обычно 0644. Каталоги systemd и Docker (tmpfs,
+// доступный только процессу или контейнеру) не проверяются: Docker Swarm монтирует секреты с правами 0444.
+
+// dockerSecretsDir — каталог секретов Docker и Docker Swarm.
+const dockerSecretsDir = "/run/secrets"
+
+// credentialsADC — значение CREDENTIALS_PATH для Application Default Credentials.
+const credentialsADC = "adc"
+
+// isSecretEnv — переменная окружения хранит секрет (в том числе TENANT_<ИМЯ>_… дополнительных ботов).
+func isSecretEnv(name string) bool {
+	for _, f := range configFields {
+		if f.Secret {
+			for _, e := range f.Env {
+				if name == e || (strings.HasPrefix(name, "TENANT_") && strings.HasSuffix(name, "_"+e)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// checkSecretPerm отказывает, если файл с секретом доступен на чтение всем. На Windows не проверяется.
+func checkSecretPerm(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := st.Mode().Perm(); perm&0o004 != 0 {
+		return fmt.Errorf("%s доступен на чтение всем пользователям (права %04o) — выполните chmod 600 %s", path, perm, path)
+	}
+	return nil
+}
+
+var (
+	permWarnedMu sync.Mutex
+	permWarned   = make(map[string]bool)
+)
+
+// warnSecretPerm предупреждает (один раз на файл), если .env или файл конфигурации с секретом доступен
+// на чтение всем. Бот при этом запускается.
+func warnSecretPerm(path string) {
+	err := checkSecretPerm(path)
+	if err == nil {
+		return
+	}
+	permWarnedMu.Lock()
+	defer permWarnedMu.Unlock()
+	if permWarned[path] {
+		return
+	}
+	permWarned[path] = true
+	slog.Warn("!!! СЕКРЕТЫ ДОСТУПНЫ ВСЕМ ПОЛЬЗОВАТЕЛЯМ СИСТЕМЫ !!!", "file", path, "err", err)
+}
+
+// readSecretFile читает секрет из файла (без пробелов и перевода строки по краям), проверив права.
+func readSecretFile(path string) (string, error) {
+	if err := checkSecretPerm(path); err != nil {
+		return "", err
+	}
+	return readSecret(path)
+}
+
+// readSecret читает секрет из файла без проверки прав.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// envSet — задана ли одна из переменных names (env переводит имя для бота, getenv читает окружение).
+// Заданная переменная сильнее файлов секретов: их тогда не ищем.
+func envSet(names []string, env, getenv func(string) string) bool {
+	for _, n := range names {
+		if strings.TrimSpace(getenv(env(n))) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupSecretFile ищет секрет переменной env в файлах: <env>_FILE, затем каталоги systemd и Docker.
+// path == "" — файла нет. Файл из _FILE обязан существовать.
+func lookupSecretFile(env string, getenv func(string) string) (value, path string, err error) {
+	if p := strings.TrimSpace(getenv(env + "_FILE")); p != "" {
+		v, err := readSecretFile(p)
+		if err != nil {
+			return "", p, fmt.Errorf("%s_FILE: %w", env, err)
+		}
+		return v, p, nil
+	}
+	name := strings.ToLower(env)
+	var dirs []string
+	if d := strings.TrimSpace(getenv("CREDENTIALS_DIRECTORY")); d != "" {
+		dirs = append(dirs, d)
+	}
+	dirs = append(dirs, dockerSecretsDir)
+	for _, d := range dirs {
+		p := filepath.Join(d, name)
+		v, err := readSecret(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return v, p, err
+	}
+	return "", "", nil
+}
+
+// sheetsCredentials выбирает ключ для Google Sheets: sheets.credentials_json (JSON целиком или
+// в base64), файл sheets.credentials_path или Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS,
+// gcloud, метаданные GCE / GKE Workload Identity). ADC — при CREDENTIALS_PATH=adc и когда файла
+// credentials.json по умолчанию нет. opt == nil — ADC; source — откуда ключ, для сообщений;
+// account — чья квота расходуется (см. credentialsAccount), по нему боты делят бюджет запросов.
+func sheetsCredentials(cfg *Config) (opt option.ClientOption, source, account string, err error) {
+	if cfg.CredentialsJSON != "" {
+		data, err := decodeCredentialsJSON(cfg.CredentialsJSON)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("GOOGLE_CREDENTIALS_JSON: %w", err)
+		}
+		return option.WithCredentialsJSON(data), "GOOGLE_CREDENTIALS_JSON", credentialsAccount(data), nil
+	}
+	if strings.EqualFold(cfg.CredentialsPath, credentialsADC) {
+		return nil, "Application Default Credentials", credentialsADC, nil
+	}
+	s, err := readSecretFile(cfg.CredentialsPath)
+	if errors.Is(err, os.ErrNotExist) && cfg.sources["sheets.credentials_path"] == sourceDefault {
+		return nil, "Application Default Credentials", credentialsADC, nil
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("CREDENTIALS_PATH: %w", err)
+	}
+	data, err := decodeCredentialsJSON(s)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s: %w", cfg.CredentialsPath, err)
+	}
+	return option.WithCredentialsJSON(data), cfg.CredentialsPath, credentialsAccount(data), nil
+}
+
+// credentialsAccount — учётная запись ключа: client_email сервисного аккаунта, у прочих ключей —
+// client_id; без них — хэш ключа. Один и тот же ключ из разных файлов или переменных даёт одно значение.
+func credentialsAccount(data []byte) string {
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		ClientID    string `json:"client_id"`
+	}
+	_ = json.Unmarshal(data, &key)
+	switch {
+	case key.ClientEmail != "":
+		return key.ClientEmail
+	case key.ClientID != "":
+		return key.ClientID
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodeCredentialsJSON принимает JSON-ключ как есть или в base64 (переводы строк допустимы).
+// В ошибках содержимое ключа не показывается.
+func decodeCredentialsJSON(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	data := []byte(s)
+	if !strings.HasPrefix(s, "{") {
+		compact := strings.Join(strings.Fields(s), "")
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(compact); err != nil {
+			if data, err = base64.URLEncoding.DecodeString(compact); err != nil {
+				return nil, errors.New("не JSON и не base64")
+			}
+		}
+	}
+	var key struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, errors.New("ключ не разбирается как JSON")
+	}
+	if key.Type == "" {
+		return nil, errors.New("не JSON-ключ Google (нет поля type)")
+	}
+	return data, nil
+}
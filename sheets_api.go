@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -10,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
+	htransport "google.golang.org/api/transport/http"
 )
 
 const (
@@ -22,48 +26,107 @@ const (
 	sheetАдмины          = "Админы"
 	sheetЛогиОшибок      = "Логи_Ошибок"
 	sheetЛогиСервера     = "Логи_Сервера"
+	sheetДоступы         = "Доступы"
+	sheetИсторияДок      = "История_Документов"
+	sheetСкачивания      = "Скачивания"
 )
 
 // Заголовки листов: имя листа -> первая строка (колонки).
 var sheetHeaders = map[string][]string{
-	sheetНастройкиТекста: {"Ключ", "Текст"},
-	sheetКатегории:       {"Название", "ID"},
-	sheetДокументы:       {"ID_Категории", "Название", "Описание", "Ссылка", "Telegram_File_ID"},
+	sheetНастройкиТекста: {"Ключ", "Текст", "Язык"},
+	sheetКатегории:       {"Название", "ID", "Доступ"},
+	sheetДокументы:       {"ID_Категории", "Название", "Описание", "Ссылка", "Telegram_File_ID", "Доступ", "ID_Документа", "Доставка", "Telegram_File_ID_Оригинал", "Версия", "Обновлён"},
 	sheetПожелания:       {"Дата", "Юзернейм", "ID_Юзера", "Текст"},
-	sheetЗаявкиIMO:       {"Дата", "Юзернейм", "ID_Юзера", "ФИО", "Телефон", "Должность", "Источник"},
-	sheetПользователи:    {"ID_Пользователя", "Юзернейм", "Дата_Регистрации"},
-	sheetАдмины:          {"Юзернейм", "ID_Чата"},
+	sheetЗаявкиIMO:       {"Дата", "Юзернейм", "ID_Юзера", "ФИО", "Телефон", "Должность", "Источник", "Статус", "ID_Заявки", "Статус_Уведомления"},
+	sheetПользователи:    {"ID_Пользователя", "Юзернейм", "Дата_Регистрации", "Теги", "Имя", "Фамилия", "Язык", "Последний_Визит", "Язык_Бота"},
+	sheetАдмины:          {"Юзернейм", "ID_Чата", "Роль"},
 	sheetЛогиОшибок:      {"Дата", "Ошибка", "Контекст"},
 	sheetЛогиСервера:     {"Дата", "Уровень", "Сообщение"},
+	sheetДоступы:         {"ID", "ID_Пользователя", "Юзернейм", "Группа", "Статус", "Дата_Запроса", "Выдан", "Истекает", "Выдал"},
+	sheetИсторияДок:      {"Дата", "ID_Документа", "Название", "Версия", "Ссылка", "Telegram_File_ID", "Telegram_File_ID_Оригинал", "Изменил"},
+	sheetСкачивания:      {"Дата", "ID_Пользователя", "ID_Документа", "Версия", "ID_Категории", "Тип", "Кэш", "Байты", "Результат"},
 }
 
-// Ключи текста из "Настройки_Текста".
+// Статусы заявок IMO (колонка "Статус" в "Заявки_IMO"). Пустой статус считается «Новая».
 const (
-	keyПриветствие       = "Приветствие"
-	keyОписаниеДокументы = "Описание_Документы"
-	keyОписаниеПожелания = "Описание_Пожелания"
-	keyОписаниеIMO       = "Описание_IMO"
-	keyТекстОшибкиАнкеты = "Текст_Ошибки_Анкеты"
+	imoСтатусНовая     = "Новая"
+	imoСтатусВРаботе   = "В работе"
+	imoСтатусОдобрена  = "Одобрена"
+	imoСтатусОтклонена = "Отклонена"
 )
 
+// Статусы записей в "Доступы". Доступ дают только записи «Активен» с неистёкшей датой.
+const (
+	accessЗапрошен = "Запрошен"
+	accessАктивен  = "Активен"
+	accessОтклонён = "Отклонён"
+	accessОтозван  = "Отозван"
+)
+
+// ErrAccessDecided — запрос доступа уже рассмотрен (статус не «Запрошен»): устаревшая кнопка решения.
+var ErrAccessDecided = errors.New("запрос доступа уже рассмотрен")
+
 // SheetsAPI — клиент для работы с Google Sheets.
 type SheetsAPI struct {
 	svc           *sheets.Service
 	spreadsheetID string
+	breaker       breaker       // общий для всех вызовов, см. sheetsCall
+	budget        *sheetsBudget // общий для таблиц с одним ключом Google, см. sharedSheetsBudget
+	flight        flightGroup
+	headers       headerCache  // заголовки листов для поиска колонок по названию, см. schema.go
+	log           *slog.Logger // логгер бота этой таблицы (SetLogger); nil — slog.Default()
+	tenant        string       // метка tenant в метриках таблицы (SetTenant); "" — основной бот
 }
 
-// NewSheetsAPI создаёт клиент Google Sheets.
-func NewSheetsAPI(ctx context.Context, spreadsheetID, credentialsPath string) (*SheetsAPI, error) {
-	svc, err := sheets.NewService(ctx, option.WithCredentialsFile(credentialsPath))
+// NewSheetsAPI создаёт клиент Google Sheets. creds — ключ (см. sheetsCredentials); nil — Application
+// Default Credentials.
+func NewSheetsAPI(ctx context.Context, spreadsheetID string, creds option.ClientOption) (*SheetsAPI, error) {
+	opts := []option.ClientOption{option.WithScopes(sheets.SpreadsheetsScope)}
+	if creds != nil {
+		opts = append(opts, creds)
+	}
+	// Запросы идут через sheetsMetricsTransport — счётчики и время по методам для /metrics.
+	transport, err := htransport.NewTransport(ctx, &sheetsMetricsTransport{next: http.DefaultTransport}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("sheets transport: %w", err)
+	}
+	svc, err := sheets.NewService(ctx, option.WithHTTPClient(&http.Client{Transport: transport}))
 	if err != nil {
 		return nil, fmt.Errorf("sheets.NewService: %w", err)
 	}
-	return &SheetsAPI{svc: svc, spreadsheetID: spreadsheetID}, nil
+	return &SheetsAPI{svc: svc, spreadsheetID: spreadsheetID, budget: &sheetsBudget{perMin: sheetsDefaultPerMin}}, nil
+}
+
+// SetLogger задаёт логгер бота этой таблицы (предохранитель, повторы, миграции, фоновые задачи).
+// Вызывать до первых запросов.
+func (s *SheetsAPI) SetLogger(l *slog.Logger) { s.log = l }
+
+// SetTenant задаёт имя бота для метки tenant метрик таблицы и её кэша. Вызывать до первых запросов.
+func (s *SheetsAPI) SetTenant(name string) { s.tenant = name }
+
+// logger — логгер таблицы или slog.Default().
+func (s *SheetsAPI) logger() *slog.Logger {
+	if s.log != nil {
+		return s.log
+	}
+	return slog.Default()
+}
+
+// Title возвращает название таблицы — лёгкая проверка доступности для /readyz.
+func (s *SheetsAPI) Title(ctx context.Context) (string, error) {
+	sp, err := s.getSpreadsheet(ctx, "properties.title")
+	if err != nil {
+		return "", err
+	}
+	if sp.Properties == nil {
+		return "", nil
+	}
+	return sp.Properties.Title, nil
 }
 
 // EnsureSheets создаёт недостающие листы с заголовками.
 func (s *SheetsAPI) EnsureSheets(ctx context.Context) error {
-	spreadsheet, err := s.svc.Spreadsheets.Get(s.spreadsheetID).Context(ctx).Do()
+	spreadsheet, err := s.getSpreadsheet(ctx, "")
 	if err != nil {
 		return fmt.Errorf("Spreadsheets.Get: %w", err)
 	}
@@ -91,9 +154,7 @@ func (s *SheetsAPI) EnsureSheets(ctx context.Context) error {
 		return nil
 	}
 
-	_, err = s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
-		Requests: addReqs,
-	}).Context(ctx).Do()
+	err = s.batchUpdate(ctx, addReqs)
 	if err != nil {
 		return fmt.Errorf("BatchUpdate AddSheet: %w", err)
 	}
@@ -114,8 +175,7 @@ func (s *SheetsAPI) EnsureSheets(ctx context.Context) error {
 		}
 		vr := &sheets.ValueRange{Values: [][]interface{}{row}}
 
-		_, err = s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, vr).
-			ValueInputOption("RAW").Context(ctx).Do()
+		err = s.updateValues(ctx, rangeStr, vr)
 		if err != nil {
 			return fmt.Errorf("Values.Update %s: %w", title, err)
 		}
@@ -135,111 +195,62 @@ func colToLetter(n int) string {
 	return colToLetter((n-1)/26) + string(rune('A'+(n-1)%26))
 }
 
-// EnsureSchema создаёт недостающие листы, затем для каждого листа проверяет первую строку:
-// если какой-то колонки из sheetHeaders нет — дописывает её в конец первой строки (авто-миграция).
-// Вызывать при старте main.
+// EnsureSchema создаёт недостающие листы, применяет непримененные миграции (см. schema.go) и
+// дописывает в конец первой строки колонки из sheetHeaders, которых всё ещё нет. Вызывать при старте main.
 func (s *SheetsAPI) EnsureSchema(ctx context.Context) error {
 	if err := s.EnsureSheets(ctx); err != nil {
 		return err
 	}
-	for title := range sheetHeaders {
-		if err := s.ensureSheetColumns(ctx, title); err != nil {
-			return fmt.Errorf("ensureSheetColumns %s: %w", title, err)
-		}
-	}
-	return nil
-}
-
-// ensureSheetColumns читает первую строку листа, находит недостающие заголовки из sheetHeaders
-// и дописывает их в конец первой строки.
-func (s *SheetsAPI) ensureSheetColumns(ctx context.Context, title string) error {
-	expected := sheetHeaders[title]
-	if len(expected) == 0 {
-		return nil
-	}
-	rangeStr := title + "!A1:ZZ1"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
-	if err != nil {
+	if _, _, err := s.Migrate(ctx); err != nil {
 		return err
 	}
-	var existing []string
-	if len(resp.Values) > 0 {
-		for _, c := range resp.Values[0] {
-			existing = append(existing, strings.TrimSpace(strCell(c)))
+	for _, title := range sortedSheets() {
+		if err := s.addColumns(ctx, title, sheetHeaders[title]...); err != nil {
+			return fmt.Errorf("addColumns %s: %w", title, err)
 		}
 	}
-	has := make(map[string]bool)
-	for _, h := range existing {
-		has[h] = true
-	}
-	var toAdd []string
-	for _, h := range expected {
-		if !has[h] {
-			toAdd = append(toAdd, h)
-			has[h] = true
-		}
-	}
-	if len(toAdd) == 0 {
-		return nil
-	}
-	startCol := len(existing) + 1
-	endCol := startCol + len(toAdd) - 1
-	updateRange := fmt.Sprintf("%s!%s1:%s1", title, colToLetter(startCol), colToLetter(endCol))
-	row := make([]interface{}, len(toAdd))
-	for i, h := range toAdd {
-		row[i] = h
-	}
-	vr := &sheets.ValueRange{Values: [][]interface{}{row}}
-	_, err = s.svc.Spreadsheets.Values.Update(s.spreadsheetID, updateRange, vr).
-		ValueInputOption("RAW").Context(ctx).Do()
-	return err
+	return nil
 }
 
-// WriteSheetData записывает строки в лист, начиная с указанной (startRow 1-based). Перезаписывает ячейки.
+// WriteSheetData записывает строки (в порядке колонок sheetHeaders) в лист, начиная с указанной
+// (startRow 1-based). Перезаписывает ячейки.
 func (s *SheetsAPI) WriteSheetData(ctx context.Context, sheet string, startRow int, rows [][]interface{}) error {
 	if len(rows) == 0 {
 		return nil
 	}
-	cols := len(rows[0])
-	endCol := string(rune('A' + cols - 1))
-	endRow := startRow + len(rows) - 1
-	rangeStr := fmt.Sprintf("%s!A%d:%s%d", sheet, startRow, endCol, endRow)
-	vr := &sheets.ValueRange{Values: rows}
-	_, err := s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, vr).
-		ValueInputOption("RAW").Context(ctx).Do()
-	return err
+	aligned, err := s.alignRows(ctx, sheet, rows)
+	if err != nil {
+		return err
+	}
+	rangeStr := fmt.Sprintf("%s!A%d", sheet, startRow)
+	return s.updateValues(ctx, rangeStr, &sheets.ValueRange{Values: aligned})
 }
 
 // UpdateSettingsText записывает строки [Ключ, Текст] в лист "Настройки_Текста" начиная со 2-й строки.
 func (s *SheetsAPI) UpdateSettingsText(ctx context.Context, rows [][]interface{}) error {
-	if len(rows) == 0 {
-		return nil
-	}
-	endRow := 1 + len(rows)
-	rangeStr := fmt.Sprintf("%s!A2:B%d", sheetНастройкиТекста, endRow)
-	vr := &sheets.ValueRange{Values: rows}
-	_, err := s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, vr).
-		ValueInputOption("RAW").Context(ctx).Do()
-	return err
+	return s.WriteSheetData(ctx, sheetНастройкиТекста, 2, rows)
 }
 
-// GetTextSettings возвращает карту ключ -> текст из "Настройки_Текста".
-func (s *SheetsAPI) GetTextSettings(ctx context.Context) (map[string]string, error) {
-	rangeStr := sheetНастройкиТекста + "!A2:B"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+// GetTextSettings читает тексты из "Настройки_Текста" по языкам (пустой «Язык» — defaultLang).
+func (s *SheetsAPI) GetTextSettings(ctx context.Context) (textSet, error) {
+	t, err := s.readTable(ctx, sheetНастройкиТекста)
 	if err != nil {
-		return nil, fmt.Errorf("Values.Get Настройки_Текста: %w", err)
+		return nil, err
 	}
-	out := make(map[string]string)
-	for _, row := range resp.Values {
-		if len(row) < 2 {
+	out := make(textSet)
+	for _, row := range t.rows {
+		k := t.get(row, "Ключ")
+		if k == "" {
 			continue
 		}
-		k := strings.TrimSpace(strCell(row[0]))
-		v := strings.TrimSpace(strCell(row[1]))
-		if k != "" {
-			out[k] = v
+		lang := normalizeLang(t.get(row, "Язык"))
+		if lang == "" {
+			lang = defaultLang
+		}
+		if out[lang] == nil {
+			out[lang] = make(map[string]string)
 		}
+		out[lang][k] = t.get(row, "Текст")
 	}
 	return out, nil
 }
@@ -257,107 +268,200 @@ func strCell(v interface{}) string {
 
 // Category — категория документов.
 type Category struct {
-	ID   string
-	Name string
+	ID     string
+	Name   string
+	Доступ string // правило видимости (см. accessAllows); пусто — видна всем
+	Locked bool   // недоступна пользователю, но доступ можно запросить (заполняет listedCategories)
 }
 
 // GetCategories возвращает категории. Пустые ID заполняются UUID и сохраняются в таблицу.
 func (s *SheetsAPI) GetCategories(ctx context.Context) ([]Category, error) {
-	rangeStr := sheetКатегории + "!A2:B"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+	t, err := s.readTable(ctx, sheetКатегории)
 	if err != nil {
-		return nil, fmt.Errorf("Values.Get Категории: %w", err)
+		return nil, err
 	}
-
 	var list []Category
-	var updates []struct {
-		row int
-		id  string
-	}
-	for i, row := range resp.Values {
-		rowNum := i + 2
-		name := ""
-		id := ""
-		if len(row) >= 1 {
-			name = strings.TrimSpace(strCell(row[0]))
-		}
-		if len(row) >= 2 {
-			id = strings.TrimSpace(strCell(row[1]))
-		}
-		if name == "" {
+	for i, row := range t.rows {
+		cat := Category{ID: t.get(row, "ID"), Name: t.get(row, "Название"), Доступ: t.get(row, "Доступ")}
+		if cat.Name == "" {
 			continue
 		}
-		if id == "" {
-			id = uuid.New().String()
-			updates = append(updates, struct {
-				row int
-				id  string
-			}{rowNum, id})
-		}
-		list = append(list, Category{ID: id, Name: name})
-	}
-
-	for _, u := range updates {
-		rangeStr := fmt.Sprintf("%s!B%d", sheetКатегории, u.row)
-		vr := &sheets.ValueRange{Values: [][]interface{}{{u.id}}}
-		_, err = s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, vr).
-			ValueInputOption("RAW").Context(ctx).Do()
-		if err != nil {
-			return nil, fmt.Errorf("Values.Update Категории ID: %w", err)
+		if cat.ID == "" {
+			cat.ID = uuid.New().String()
+			if err := s.updateCells(ctx, sheetКатегории, i+2, map[string]interface{}{"ID": cat.ID}); err != nil {
+				return nil, fmt.Errorf("Values.Update Категории ID: %w", err)
+			}
 		}
+		list = append(list, cat)
 	}
-
 	return list, nil
 }
 
 // Document — документ.
 type Document struct {
+	ID          string // ID_Документа (UUID); если пуст, генерируется при чтении
 	IDКатегории string
 	Название    string
 	Описание    string
 	Ссылка      string
-	FileID      string // Telegram File_ID архива (ZIP) для повторной отправки
+	FileID      string // Telegram File_ID: архива (ZIP) для повторной отправки или загруженного админом файла (если Ссылка пуста)
+	Доступ      string // правило видимости (см. accessAllows); пусто — виден всем, кому видна категория
+	Доставка    string // zip | original | auto; пусто — DELIVERY_MODE
+	FileIDOrig  string // Telegram File_ID исходного файла (без ZIP), кэш для режимов original/auto
+	Версия      int    // 1, если в таблице пусто
+	Обновлён    string // дата последнего изменения содержимого («2006-01-02 15:04:05»)
 	SheetRow    int    // номер строки в листе (1-based) для обновления File_ID
 }
 
-// GetDocumentsByCategory возвращает документы по ID категории.
-func (s *SheetsAPI) GetDocumentsByCategory(ctx context.Context, categoryID string) ([]Document, error) {
-	rangeStr := sheetДокументы + "!A2:E"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+// Колонки листа "Документы" — названия заголовков (см. sheetHeaders).
+const (
+	docColКатегория  = "ID_Категории"
+	docColНазвание   = "Название"
+	docColОписание   = "Описание"
+	docColСсылка     = "Ссылка"
+	docColFileID     = "Telegram_File_ID"
+	docColДоступ     = "Доступ"
+	docColID         = "ID_Документа"
+	docColДоставка   = "Доставка"
+	docColFileIDOrig = "Telegram_File_ID_Оригинал"
+	docColВерсия     = "Версия"
+	docColОбновлён   = "Обновлён"
+)
+
+// GetDocuments возвращает все документы. Пустые ID_Документа заполняются UUID и сохраняются в таблицу.
+func (s *SheetsAPI) GetDocuments(ctx context.Context) ([]Document, error) {
+	t, err := s.readTable(ctx, sheetДокументы)
 	if err != nil {
-		return nil, fmt.Errorf("Values.Get Документы: %w", err)
+		return nil, err
 	}
 	var list []Document
-	for i, row := range resp.Values {
-		if len(row) < 4 {
-			continue
+	for i, row := range t.rows {
+		d := Document{
+			ID:          t.get(row, docColID),
+			IDКатегории: t.get(row, docColКатегория),
+			Название:    t.get(row, docColНазвание),
+			Описание:    t.get(row, docColОписание),
+			Ссылка:      t.get(row, docColСсылка),
+			FileID:      t.get(row, docColFileID),
+			Доступ:      t.get(row, docColДоступ),
+			Доставка:    t.get(row, docColДоставка),
+			FileIDOrig:  t.get(row, docColFileIDOrig),
+			Версия:      1,
+			Обновлён:    t.get(row, docColОбновлён),
+			SheetRow:    2 + i,
 		}
-		idCat := strings.TrimSpace(strCell(row[0]))
-		if idCat != categoryID {
+		if d.IDКатегории == "" && d.Название == "" {
 			continue
 		}
-		d := Document{
-			IDКатегории: idCat,
-			Название:    strings.TrimSpace(strCell(row[1])),
-			Описание:    strings.TrimSpace(strCell(row[2])),
-			Ссылка:      strings.TrimSpace(strCell(row[3])),
-			SheetRow:    2 + i,
+		if n, err := strconv.Atoi(t.get(row, docColВерсия)); err == nil && n > 0 {
+			d.Версия = n
 		}
-		if len(row) >= 5 {
-			d.FileID = strings.TrimSpace(strCell(row[4]))
+		if d.ID == "" && d.IDКатегории != "" {
+			d.ID = uuid.New().String()
+			if err := s.UpdateDocumentCell(ctx, d.SheetRow, docColID, d.ID); err != nil {
+				return nil, fmt.Errorf("Values.Update Документы ID: %w", err)
+			}
 		}
 		list = append(list, d)
 	}
 	return list, nil
 }
 
-// UpdateDocumentFileID записывает Telegram File_ID в колонку E для строки sheetRow.
+// GetDocumentsByCategory возвращает документы по ID категории.
+func (s *SheetsAPI) GetDocumentsByCategory(ctx context.Context, categoryID string) ([]Document, error) {
+	all, err := s.GetDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []Document
+	for _, d := range all {
+		if d.IDКатегории == categoryID {
+			list = append(list, d)
+		}
+	}
+	return list, nil
+}
+
+// GetDocument возвращает документ по ID_Документа.
+func (s *SheetsAPI) GetDocument(ctx context.Context, id string) (*Document, error) {
+	all, err := s.GetDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].ID == id {
+			return &all[i], nil
+		}
+	}
+	return nil, fmt.Errorf("документ %s не найден", id)
+}
+
+// UpdateDocumentFileID записывает Telegram File_ID в строку sheetRow.
 func (s *SheetsAPI) UpdateDocumentFileID(ctx context.Context, sheetRow int, fileID string) error {
-	rangeStr := fmt.Sprintf("%s!E%d", sheetДокументы, sheetRow)
-	vr := &sheets.ValueRange{Values: [][]interface{}{{fileID}}}
-	_, err := s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, vr).
-		ValueInputOption("RAW").Context(ctx).Do()
-	return err
+	return s.UpdateDocumentCell(ctx, sheetRow, docColFileID, fileID)
+}
+
+// UpdateDocumentCell записывает значение в колонку col (docCol*) строки sheetRow листа "Документы".
+func (s *SheetsAPI) UpdateDocumentCell(ctx context.Context, sheetRow int, col, value string) error {
+	return s.updateCells(ctx, sheetДокументы, sheetRow, map[string]interface{}{col: value})
+}
+
+// AppendDocument добавляет документ в "Документы" (версия 1, Обновлён — сейчас) и возвращает его ID.
+func (s *SheetsAPI) AppendDocument(ctx context.Context, d Document) (string, error) {
+	if d.ID == "" {
+		d.ID = uuid.New().String()
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	row := []interface{}{d.IDКатегории, d.Название, d.Описание, d.Ссылка, d.FileID, d.Доступ, d.ID, d.Доставка, d.FileIDOrig, "1", now}
+	if err := s.appendRowRaw(ctx, sheetДокументы, row); err != nil {
+		return "", err
+	}
+	return d.ID, nil
+}
+
+// AppendCategory добавляет категорию с новым UUID в "Категории".
+func (s *SheetsAPI) AppendCategory(ctx context.Context, name, access string) (Category, error) {
+	cat := Category{ID: uuid.New().String(), Name: name, Доступ: access}
+	if err := s.appendRowRaw(ctx, sheetКатегории, []interface{}{cat.Name, cat.ID, cat.Доступ}); err != nil {
+		return Category{}, err
+	}
+	return cat, nil
+}
+
+// DeleteRow удаляет строку sheetRow (1-based) из листа sheet со сдвигом нижних строк.
+func (s *SheetsAPI) DeleteRow(ctx context.Context, sheet string, sheetRow int) error {
+	sheetID, err := s.sheetID(ctx, sheet)
+	if err != nil {
+		return err
+	}
+	err = s.batchUpdate(ctx, []*sheets.Request{{
+		DeleteDimension: &sheets.DeleteDimensionRequest{
+			Range: &sheets.DimensionRange{
+				SheetId:    sheetID,
+				Dimension:  "ROWS",
+				StartIndex: int64(sheetRow - 1),
+				EndIndex:   int64(sheetRow),
+			},
+		},
+	}})
+	if err != nil {
+		return fmt.Errorf("BatchUpdate DeleteDimension %s: %w", sheet, err)
+	}
+	return nil
+}
+
+// sheetID возвращает числовой ID листа по названию (нужен для BatchUpdate).
+func (s *SheetsAPI) sheetID(ctx context.Context, title string) (int64, error) {
+	spreadsheet, err := s.getSpreadsheet(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("Spreadsheets.Get: %w", err)
+	}
+	for _, sh := range spreadsheet.Sheets {
+		if sh.Properties != nil && sh.Properties.Title == title {
+			return sh.Properties.SheetId, nil
+		}
+	}
+	return 0, fmt.Errorf("лист %s не найден", title)
 }
 
 // AppendWish добавляет запись в "Пожелания".
@@ -371,8 +475,9 @@ func (s *SheetsAPI) AppendWish(ctx context.Context, username, userID, text strin
 	return s.appendRow(ctx, sheetПожелания, row)
 }
 
-// AppendIMO добавляет заявку в "Заявки_IMO".
-func (s *SheetsAPI) AppendIMO(ctx context.Context, username, userID, fio, phone, position, source string) error {
+// AppendIMO добавляет заявку в "Заявки_IMO" со статусом «Новая» и возвращает ID заявки.
+func (s *SheetsAPI) AppendIMO(ctx context.Context, username, userID, fio, phone, position, source string) (string, error) {
+	id := uuid.New().String()
 	row := []interface{}{
 		time.Now().Format("2006-01-02 15:04:05"),
 		username,
@@ -381,16 +486,128 @@ func (s *SheetsAPI) AppendIMO(ctx context.Context, username, userID, fio, phone,
 		phone,
 		position,
 		source,
+		imoСтатусНовая,
+		id,
+		imoСтатусНовая,
+	}
+	if err := s.appendRow(ctx, sheetЗаявкиIMO, row); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// IMORequest — заявка из "Заявки_IMO".
+type IMORequest struct {
+	ID         string
+	Дата       string
+	Юзернейм   string
+	UserID     int64
+	ФИО        string
+	Телефон    string
+	Должность  string
+	Источник   string
+	Статус     string // «Новая», если в таблице пусто
+	Уведомлено string // статус, о котором пользователь уже уведомлён
+	SheetRow   int    // номер строки в листе (1-based)
+}
+
+// GetIMORequests возвращает все заявки из "Заявки_IMO".
+// Только чтение: пустые ID_Заявки заполняют миграция 6 (schema.go) и поллер (AssignIMORequestID).
+func (s *SheetsAPI) GetIMORequests(ctx context.Context) ([]IMORequest, error) {
+	t, err := s.readTable(ctx, sheetЗаявкиIMO)
+	if err != nil {
+		return nil, err
+	}
+	var list []IMORequest
+	for i, row := range t.rows {
+		r := IMORequest{
+			Дата:       t.get(row, "Дата"),
+			Юзернейм:   t.get(row, "Юзернейм"),
+			ФИО:        t.get(row, "ФИО"),
+			Телефон:    t.get(row, "Телефон"),
+			Должность:  t.get(row, "Должность"),
+			Источник:   t.get(row, "Источник"),
+			Статус:     t.get(row, "Статус"),
+			ID:         t.get(row, "ID_Заявки"),
+			Уведомлено: t.get(row, "Статус_Уведомления"),
+			SheetRow:   2 + i,
+		}
+		if _, e := fmt.Sscanf(t.get(row, "ID_Юзера"), "%d", &r.UserID); e != nil {
+			continue
+		}
+		if r.Статус == "" {
+			r.Статус = imoСтатусНовая
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// GetIMORequest перечитывает заявку с данным ID.
+func (s *SheetsAPI) GetIMORequest(ctx context.Context, id string) (*IMORequest, error) {
+	list, err := s.GetIMORequests(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return s.appendRow(ctx, sheetЗаявкиIMO, row)
+	for i := range list {
+		if id != "" && list[i].ID == id {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("заявка %s не найдена", id)
 }
 
+// SetIMOStatus записывает статус заявки с данным ID. Возвращает обновлённую заявку.
+func (s *SheetsAPI) SetIMOStatus(ctx context.Context, id, status string) (*IMORequest, error) {
+	list, err := s.GetIMORequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].ID != id {
+			continue
+		}
+		if err := s.updateCells(ctx, sheetЗаявкиIMO, list[i].SheetRow, map[string]interface{}{"Статус": status}); err != nil {
+			return nil, err
+		}
+		list[i].Статус = status
+		return &list[i], nil
+	}
+	return nil, fmt.Errorf("заявка %s не найдена", id)
+}
+
+// AssignIMORequestID записывает новый UUID в пустой «ID_Заявки» строки sheetRow (строка вписана вручную).
+func (s *SheetsAPI) AssignIMORequestID(ctx context.Context, sheetRow int) (string, error) {
+	id := uuid.New().String()
+	if err := s.updateCells(ctx, sheetЗаявкиIMO, sheetRow, map[string]interface{}{"ID_Заявки": id}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SetIMONotifiedStatus записывает в «Статус_Уведомления» статус, о котором пользователь уведомлён.
+func (s *SheetsAPI) SetIMONotifiedStatus(ctx context.Context, sheetRow int, status string) error {
+	return s.updateCells(ctx, sheetЗаявкиIMO, sheetRow, map[string]interface{}{"Статус_Уведомления": status})
+}
+
+// appendRow дописывает строку (значения в порядке колонок sheetHeaders) в конец листа.
 func (s *SheetsAPI) appendRow(ctx context.Context, sheet string, row []interface{}) error {
-	rangeStr := sheet + "!A:Z"
-	vr := &sheets.ValueRange{Values: [][]interface{}{row}}
-	_, err := s.svc.Spreadsheets.Values.Append(s.spreadsheetID, rangeStr, vr).
-		ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
-	return err
+	return s.appendRows(ctx, sheet, [][]interface{}{row}, "USER_ENTERED")
+}
+
+// appendRowRaw — как appendRow, но без интерпретации значений (ссылки, ID и file_id пишутся как есть).
+func (s *SheetsAPI) appendRowRaw(ctx context.Context, sheet string, row []interface{}) error {
+	return s.appendRows(ctx, sheet, [][]interface{}{row}, "RAW")
+}
+
+// appendRows дописывает строки, разложив значения по фактическим колонкам листа (alignRows).
+func (s *SheetsAPI) appendRows(ctx context.Context, sheet string, rows [][]interface{}, inputOption string) error {
+	aligned, err := s.alignRows(ctx, sheet, rows)
+	if err != nil {
+		return err
+	}
+	vr := &sheets.ValueRange{Values: aligned}
+	return s.appendValues(ctx, sheet+"!A:ZZ", vr, inputOption)
 }
 
 // LogToSheets добавляет запись в лист "Логи_Сервера" [Дата | Уровень | Сообщение].
@@ -403,59 +620,192 @@ func (s *SheetsAPI) LogToSheets(ctx context.Context, level, message string) erro
 	return s.appendRow(ctx, sheetЛогиСервера, row)
 }
 
-// EnsureUser добавляет пользователя в "Пользователи", если его ещё нет.
-func (s *SheetsAPI) EnsureUser(ctx context.Context, userID, username string) error {
-	rangeStr := sheetПользователи + "!A2:C"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+// UserProfile — строка листа «Пользователи» без тегов (их читает GetUserTags).
+type UserProfile struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Lang       string `json:"lang"`       // language_code из Telegram
+	BotLang    string `json:"bot_lang"`   // язык, выбранный /lang (пусто — как в Telegram)
+	Registered string `json:"registered"` // Дата_Регистрации
+	LastSeen   string `json:"last_seen"`  // Последний_Визит
+}
+
+// GetUsers читает профили из «Пользователи». Строки без числового ID пропускаются, повторы ID — тоже.
+func (s *SheetsAPI) GetUsers(ctx context.Context) ([]UserProfile, error) {
+	t, err := s.readTable(ctx, sheetПользователи)
 	if err != nil {
-		return fmt.Errorf("Values.Get Пользователи: %w", err)
+		return nil, err
 	}
-	idStr := userID
-	for _, row := range resp.Values {
-		if len(row) >= 1 && strCell(row[0]) == idStr {
-			return nil
+	var out []UserProfile
+	seen := make(map[int64]bool)
+	for _, row := range t.rows {
+		id, err := strconv.ParseInt(t.get(row, "ID_Пользователя"), 10, 64)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, UserProfile{
+			ID: id, Username: t.get(row, "Юзернейм"), Registered: t.get(row, "Дата_Регистрации"),
+			FirstName: t.get(row, "Имя"), LastName: t.get(row, "Фамилия"), Lang: t.get(row, "Язык"),
+			LastSeen: t.get(row, "Последний_Визит"), BotLang: t.get(row, "Язык_Бота"),
+		})
+	}
+	return out, nil
+}
+
+// GetUserRows возвращает номер строки листа «Пользователи» для каждого ID (первое вхождение).
+// Читает только колонку ID — перед записью строки сверяются заново, ведь их могли сдвинуть вручную.
+func (s *SheetsAPI) GetUserRows(ctx context.Context) (map[int64]int, error) {
+	col, err := s.colLetter(ctx, sheetПользователи, "ID_Пользователя")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.getValues(ctx, fmt.Sprintf("%s!%s2:%s", sheetПользователи, col, col))
+	if err != nil {
+		return nil, fmt.Errorf("Values.Get Пользователи: %w", err)
+	}
+	rows := make(map[int64]int, len(resp.Values))
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(strCell(row[0])), 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := rows[id]; !ok {
+			rows[id] = i + 2
+		}
+	}
+	return rows, nil
+}
+
+// AppendUsers дописывает новых пользователей одним запросом. RAW — имена задаёт сам пользователь,
+// они не должны стать формулой.
+func (s *SheetsAPI) AppendUsers(ctx context.Context, users []UserProfile) error {
+	rows := make([][]interface{}, 0, len(users))
+	for _, u := range users {
+		rows = append(rows, []interface{}{strconv.FormatInt(u.ID, 10), u.Username, u.Registered, "", u.FirstName, u.LastName, u.Lang, u.LastSeen, u.BotLang})
+	}
+	return s.appendRows(ctx, sheetПользователи, rows, "RAW")
+}
+
+// userUpdate — изменения одной строки «Пользователи»: профиль или только Последний_Визит.
+type userUpdate struct {
+	Row     int
+	Profile bool
+	User    UserProfile
+}
+
+// UpdateUsers записывает изменения профилей одним запросом values.batchUpdate. Теги не трогаются.
+func (s *SheetsAPI) UpdateUsers(ctx context.Context, updates []userUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	cols, err := s.columns(ctx, sheetПользователи)
+	if err != nil {
+		return err
+	}
+	var data []*sheets.ValueRange
+	cell := func(row int, name string, v interface{}) error {
+		i, ok := cols[name]
+		if !ok {
+			return fmt.Errorf("в листе %s нет колонки %s", sheetПользователи, name)
+		}
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!%s%d", sheetПользователи, colToLetter(i+1), row),
+			Values: [][]interface{}{{v}},
+		})
+		return nil
+	}
+	for _, u := range updates {
+		if err := cell(u.Row, "Последний_Визит", u.User.LastSeen); err != nil {
+			return err
+		}
+		if !u.Profile {
+			continue
+		}
+		for name, v := range map[string]string{"Юзернейм": u.User.Username, "Имя": u.User.FirstName, "Фамилия": u.User.LastName, "Язык": u.User.Lang, "Язык_Бота": u.User.BotLang} {
+			if err := cell(u.Row, name, v); err != nil {
+				return err
+			}
+		}
+	}
+	return s.batchUpdateValues(ctx, data)
+}
+
+// GetUserTags возвращает теги пользователей из колонки «Теги» листа «Пользователи»
+// (через запятую, в нижнем регистре, без #). Пользователи без тегов не попадают в карту.
+func (s *SheetsAPI) GetUserTags(ctx context.Context) (map[int64]map[string]bool, error) {
+	t, err := s.readTable(ctx, sheetПользователи)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]map[string]bool)
+	for _, row := range t.rows {
+		var id int64
+		if _, e := fmt.Sscanf(t.get(row, "ID_Пользователя"), "%d", &id); e != nil {
+			continue
+		}
+		for _, tag := range splitList(t.get(row, "Теги")) {
+			tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+			if tag == "" {
+				continue
+			}
+			if out[id] == nil {
+				out[id] = make(map[string]bool)
+			}
+			out[id][tag] = true
 		}
 	}
-	row := []interface{}{userID, username, time.Now().Format("2006-01-02 15:04:05")}
-	return s.appendRow(ctx, sheetПользователи, row)
+	return out, nil
 }
 
-// GetAdminChatIDs возвращает ID чатов админов с заполненным ID_Чата (для уведомлений).
-func (s *SheetsAPI) GetAdminChatIDs(ctx context.Context) ([]int64, error) {
+// GetAdminChatIDs возвращает ID чатов админов с заполненным ID_Чата,
+// чья роль получает уведомления типа kind (см. notifyRoles).
+func (s *SheetsAPI) GetAdminChatIDs(ctx context.Context, kind string) ([]int64, error) {
 	chatIDs, _, err := s.GetAdmins(ctx)
 	if err != nil {
 		return nil, err
 	}
 	ids := make([]int64, 0, len(chatIDs))
-	for id := range chatIDs {
-		ids = append(ids, id)
+	for id, role := range chatIDs {
+		if canNotify(role, kind) {
+			ids = append(ids, id)
+		}
 	}
 	return ids, nil
 }
 
-// GetAdmins возвращает множество ID чатов админов (по колонке ID_Чата) и юзернеймы.
+// GetAdmins возвращает роли админов по ID чата (колонка ID_Чата) и по юзернейму.
 // Админ может быть добавлен по юзернейму; ID_Чата заполняется при первом /start.
-func (s *SheetsAPI) GetAdmins(ctx context.Context) (chatIDs map[int64]bool, usernames map[string]bool, err error) {
-	rangeStr := sheetАдмины + "!A2:B"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+// Строки с неизвестной ролью пропускаются.
+func (s *SheetsAPI) GetAdmins(ctx context.Context) (chatIDs map[int64]Role, usernames map[string]Role, err error) {
+	t, err := s.readTable(ctx, sheetАдмины)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Values.Get Админы: %w", err)
-	}
-	chatIDs = make(map[int64]bool)
-	usernames = make(map[string]bool)
-	for _, row := range resp.Values {
-		if len(row) >= 1 {
-			usernames[strings.TrimSpace(strings.TrimPrefix(strCell(row[0]), "@"))] = true
-		}
-		if len(row) >= 2 {
-			idStr := strings.TrimSpace(strCell(row[1]))
-			if idStr != "" {
-				var id int64
-				if _, e := fmt.Sscanf(idStr, "%d", &id); e == nil {
-					chatIDs[id] = true
-				} else if f, e := strconv.ParseFloat(idStr, 64); e == nil {
-					chatIDs[int64(f)] = true
-				}
+		return nil, nil, err
+	}
+	chatIDs = make(map[int64]Role)
+	usernames = make(map[string]Role)
+	for _, row := range t.rows {
+		role := roleOwner
+		if r := t.get(row, "Роль"); r != "" {
+			role = parseRole(r)
+		}
+		if role == "" {
+			continue
+		}
+		if u := strings.TrimSpace(strings.TrimPrefix(t.get(row, "Юзернейм"), "@")); u != "" {
+			usernames[u] = role
+		}
+		if idStr := t.get(row, "ID_Чата"); idStr != "" {
+			var id int64
+			if _, e := fmt.Sscanf(idStr, "%d", &id); e == nil {
+				chatIDs[id] = role
+			} else if f, e := strconv.ParseFloat(idStr, 64); e == nil {
+				chatIDs[int64(f)] = role
 			}
 		}
 	}
@@ -465,60 +815,293 @@ func (s *SheetsAPI) GetAdmins(ctx context.Context) (chatIDs map[int64]bool, user
 // SetAdminChatID обновляет ID_Чата для строки с данным юзернеймом, если ID_Чата пуст.
 func (s *SheetsAPI) SetAdminChatID(ctx context.Context, username string, chatID int64) error {
 	username = strings.TrimSpace(strings.TrimPrefix(username, "@"))
-	rangeStr := sheetАдмины + "!A2:B"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+	t, err := s.readTable(ctx, sheetАдмины)
 	if err != nil {
 		return err
 	}
-	for i, row := range resp.Values {
-		if len(row) < 1 {
+	for i, row := range t.rows {
+		u := strings.TrimSpace(strings.TrimPrefix(t.get(row, "Юзернейм"), "@"))
+		if u == "" || !strings.EqualFold(u, username) {
 			continue
 		}
-		u := strings.TrimSpace(strings.TrimPrefix(strCell(row[0]), "@"))
-		if !strings.EqualFold(u, username) {
-			continue
-		}
-		if len(row) >= 2 && strings.TrimSpace(strCell(row[1])) != "" {
+		if t.get(row, "ID_Чата") != "" {
 			return nil
 		}
-		rowNum := i + 2
-		updateRange := fmt.Sprintf("%s!B%d", sheetАдмины, rowNum)
-		vr := &sheets.ValueRange{Values: [][]interface{}{{fmt.Sprintf("%d", chatID)}}}
-		_, err = s.svc.Spreadsheets.Values.Update(s.spreadsheetID, updateRange, vr).
-			ValueInputOption("RAW").Context(ctx).Do()
-		return err
+		return s.updateCells(ctx, sheetАдмины, i+2, map[string]interface{}{"ID_Чата": fmt.Sprintf("%d", chatID)})
 	}
 	return nil
 }
 
-// GetAllUserChatIDs возвращает все ID чатов из "Пользователи" (для рассылки).
-// В листе хранится ID_Пользователя — в приватном чате с ботом chat_id = user_id, используем как есть.
-func (s *SheetsAPI) GetAllUserChatIDs(ctx context.Context) ([]int64, error) {
-	rangeStr := sheetПользователи + "!A2:B"
-	resp, err := s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+// AppendLogRows дописывает строки в лист логов ("Логи_Ошибок" или "Логи_Сервера") одним запросом.
+// Значения пишутся как есть (RAW), чтобы текст ошибки вида "=..." не стал формулой.
+func (s *SheetsAPI) AppendLogRows(ctx context.Context, sheet string, rows [][]interface{}) error {
+	return s.appendRows(ctx, sheet, rows, "RAW")
+}
+
+// AccessGrant — запись из "Доступы": заявка пользователя на группу доступа или выданный доступ.
+type AccessGrant struct {
+	ID          string
+	UserID      int64
+	Юзернейм    string
+	Группа      string // тег, который получает пользователь (сравнивается с #тег в «Доступ»)
+	Статус      string
+	ДатаЗапроса string
+	Выдан       string
+	Истекает    time.Time // нулевое значение — бессрочно
+	Выдал       string
+	SheetRow    int
+}
+
+// Active — действует ли доступ в момент now.
+func (g *AccessGrant) Active(now time.Time) bool {
+	return g.Статус == accessАктивен && (g.Истекает.IsZero() || now.Before(g.Истекает))
+}
+
+// parseSheetTime разбирает дату из таблицы: «2006-01-02 15:04:05» или «2006-01-02» (конец дня).
+func parseSheetTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.Add(24*time.Hour - time.Second)
+	}
+	if t, err := time.ParseInLocation("02.01.2006", s, time.Local); err == nil {
+		return t.Add(24*time.Hour - time.Second)
+	}
+	return time.Time{}
+}
+
+// GetAccessGrants возвращает все записи листа "Доступы".
+func (s *SheetsAPI) GetAccessGrants(ctx context.Context) ([]AccessGrant, error) {
+	t, err := s.readTable(ctx, sheetДоступы)
 	if err != nil {
-		return nil, fmt.Errorf("Values.Get Пользователи: %w", err)
+		return nil, err
 	}
-	var ids []int64
-	seen := make(map[int64]bool)
-	for _, row := range resp.Values {
-		if len(row) < 1 {
+	var list []AccessGrant
+	for i, row := range t.rows {
+		g := AccessGrant{
+			ID:          t.get(row, "ID"),
+			Юзернейм:    t.get(row, "Юзернейм"),
+			Группа:      strings.ToLower(strings.TrimPrefix(t.get(row, "Группа"), "#")),
+			Статус:      t.get(row, "Статус"),
+			ДатаЗапроса: t.get(row, "Дата_Запроса"),
+			Выдан:       t.get(row, "Выдан"),
+			Истекает:    parseSheetTime(t.get(row, "Истекает")),
+			Выдал:       t.get(row, "Выдал"),
+			SheetRow:    2 + i,
+		}
+		if _, e := fmt.Sscanf(t.get(row, "ID_Пользователя"), "%d", &g.UserID); e != nil || g.Группа == "" {
 			continue
 		}
-		var id int64
-		if _, e := fmt.Sscanf(strCell(row[0]), "%d", &id); e != nil {
+		list = append(list, g)
+	}
+	return list, nil
+}
+
+// AppendAccessRequest добавляет в "Доступы" заявку со статусом «Запрошен» и возвращает её ID.
+func (s *SheetsAPI) AppendAccessRequest(ctx context.Context, userID int64, username, group string) (string, error) {
+	id := uuid.New().String()
+	row := []interface{}{
+		id,
+		fmt.Sprintf("%d", userID),
+		username,
+		group,
+		accessЗапрошен,
+		time.Now().Format("2006-01-02 15:04:05"),
+		"",
+		"",
+		"",
+	}
+	if err := s.appendRow(ctx, sheetДоступы, row); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SetAccessStatus меняет статус записи id в "Доступы". Для «Активен» записывает дату выдачи и срок
+// (expires нулевое — бессрочно); by — кто принял решение. Возвращает обновлённую запись.
+// Решение принимается только по записи «Запрошен», иначе — ErrAccessDecided и запись как есть.
+func (s *SheetsAPI) SetAccessStatus(ctx context.Context, id, status string, expires time.Time, by string) (*AccessGrant, error) {
+	list, err := s.GetAccessGrants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		g := &list[i]
+		if g.ID != id {
 			continue
 		}
-		if !seen[id] {
-			seen[id] = true
-			ids = append(ids, id)
+		if g.Статус != accessЗапрошен {
+			return g, fmt.Errorf("%w: %s", ErrAccessDecided, g.Статус)
+		}
+		g.Статус = status
+		g.Выдал = by
+		exp := ""
+		if status == accessАктивен {
+			g.Выдан = time.Now().Format("2006-01-02 15:04:05")
+			g.Истекает = expires
+			if !expires.IsZero() {
+				exp = expires.Format("2006-01-02 15:04:05")
+			}
 		}
+		if err := s.updateCells(ctx, sheetДоступы, g.SheetRow, map[string]interface{}{
+			"Статус": g.Статус, "Выдан": g.Выдан, "Истекает": exp, "Выдал": g.Выдал,
+		}); err != nil {
+			return nil, err
+		}
+		return g, nil
 	}
-	return ids, nil
+	return nil, fmt.Errorf("запись доступа %s не найдена", id)
+}
+
+// RevokeAccess помечает «Отозван» все активные записи пользователя на группу group.
+// Пользователь задаётся ID или юзернеймом (userID == 0). Возвращает отозванные записи.
+func (s *SheetsAPI) RevokeAccess(ctx context.Context, userID int64, username, group, by string) ([]AccessGrant, error) {
+	list, err := s.GetAccessGrants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	username = strings.TrimPrefix(username, "@")
+	group = strings.ToLower(strings.TrimPrefix(group, "#"))
+	var revoked []AccessGrant
+	for _, g := range list {
+		if g.Статус != accessАктивен || g.Группа != group {
+			continue
+		}
+		if userID != 0 && g.UserID != userID {
+			continue
+		}
+		if userID == 0 && !strings.EqualFold(strings.TrimPrefix(g.Юзернейм, "@"), username) {
+			continue
+		}
+		if err := s.updateCells(ctx, sheetДоступы, g.SheetRow, map[string]interface{}{"Статус": accessОтозван, "Выдал": by}); err != nil {
+			return revoked, err
+		}
+		g.Статус = accessОтозван
+		revoked = append(revoked, g)
+	}
+	return revoked, nil
+}
+
+// BumpDocumentVersion сохраняет прежние ссылку и file_id документа d (снимок до изменения) в
+// "История_Документов", затем увеличивает «Версия» и ставит «Обновлён» — сейчас. Вызывать после
+// успешной записи нового содержимого, чтобы неудачная правка не попала в историю.
+func (s *SheetsAPI) BumpDocumentVersion(ctx context.Context, d *Document, by string) (int, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	hist := []interface{}{now, d.ID, d.Название, strconv.Itoa(d.Версия), d.Ссылка, d.FileID, d.FileIDOrig, by}
+	if err := s.appendRowRaw(ctx, sheetИсторияДок, hist); err != nil {
+		return 0, fmt.Errorf("append История_Документов: %w", err)
+	}
+	next := d.Версия + 1
+	if err := s.updateCells(ctx, sheetДокументы, d.SheetRow, map[string]interface{}{docColВерсия: strconv.Itoa(next), docColОбновлён: now}); err != nil {
+		return 0, err
+	}
+	d.Версия, d.Обновлён = next, now
+	return next, nil
+}
+
+// Тип записи в «Скачивания».
+const (
+	dlSingle  = "single"  // один документ
+	dlBulk    = "bulk"    // документ в архиве «Скачать все»
+	dlArchive = "archive" // сам архив «Скачать все» (ID_Документа пуст)
+)
+
+// Результат записи в «Скачивания».
+const (
+	dlOK    = "ok"
+	dlError = "ошибка"
+	dlLink  = "ссылка" // файл не отправлен, пользователю отдана ссылка (лимит, не Яндекс.Диск, мало места)
+)
+
+// DownloadRecord — строка листа «Скачивания».
+type DownloadRecord struct {
+	Дата       time.Time
+	UserID     int64
+	DocID      string
+	Версия     int
+	CategoryID string
+	Тип        string // dlSingle, dlBulk, dlArchive
+	Кэш        bool   // отправлено по сохранённому file_id, без скачивания с Яндекса
+	Байты      int64
+	Результат  string // dlOK, dlError, dlLink
+}
+
+// AppendDownloads записывает записи в «Скачивания» одним запросом. Пустая Дата — сейчас.
+func (s *SheetsAPI) AppendDownloads(ctx context.Context, recs []DownloadRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(recs))
+	for _, r := range recs {
+		if r.Дата.IsZero() {
+			r.Дата = time.Now()
+		}
+		version, cached, bytes := "", "", ""
+		if r.Версия > 0 {
+			version = strconv.Itoa(r.Версия)
+		}
+		if r.Кэш {
+			cached = "да"
+		}
+		if r.Байты > 0 {
+			bytes = strconv.FormatInt(r.Байты, 10)
+		}
+		rows = append(rows, []interface{}{r.Дата.Format("2006-01-02 15:04:05"), fmt.Sprintf("%d", r.UserID), r.DocID, version, r.CategoryID, r.Тип, cached, bytes, r.Результат})
+	}
+	return s.appendRows(ctx, sheetСкачивания, rows, "RAW")
 }
 
-// LogError пишет в "Логи_Ошибок".
-func (s *SheetsAPI) LogError(ctx context.Context, errStr, context string) {
-	row := []interface{}{time.Now().Format("2006-01-02 15:04:05"), errStr, context}
-	_ = s.appendRow(ctx, sheetЛогиОшибок, row)
+// GetDownloads возвращает все записи «Скачивания». Строки без Типа и Результата
+// (записанные до появления этих колонок) считаются успешными одиночными скачиваниями.
+func (s *SheetsAPI) GetDownloads(ctx context.Context) ([]DownloadRecord, error) {
+	t, err := s.readTable(ctx, sheetСкачивания)
+	if err != nil {
+		return nil, err
+	}
+	var list []DownloadRecord
+	for _, row := range t.rows {
+		r := DownloadRecord{
+			Дата:       parseSheetTime(t.get(row, "Дата")),
+			DocID:      t.get(row, "ID_Документа"),
+			CategoryID: t.get(row, "ID_Категории"),
+			Тип:        t.get(row, "Тип"),
+			Кэш:        t.get(row, "Кэш") != "",
+			Результат:  t.get(row, "Результат"),
+		}
+		if _, e := fmt.Sscanf(t.get(row, "ID_Пользователя"), "%d", &r.UserID); e != nil || r.Дата.IsZero() {
+			continue
+		}
+		r.Версия, _ = strconv.Atoi(t.get(row, "Версия"))
+		r.Байты, _ = strconv.ParseInt(t.get(row, "Байты"), 10, 64)
+		if r.Тип == "" {
+			r.Тип = dlSingle
+		}
+		if r.Результат == "" {
+			r.Результат = dlOK
+		}
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+// GetDocumentDownloaders возвращает пользователей, успешно скачивавших документ docID, и последнюю
+// (наибольшую) скачанную каждым версию. Пустая «Версия» в записи — версия 1.
+func (s *SheetsAPI) GetDocumentDownloaders(ctx context.Context, docID string) (map[int64]int, error) {
+	list, err := s.GetDownloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[int64]int)
+	for _, r := range list {
+		if r.DocID != docID || r.Результат != dlOK {
+			continue
+		}
+		v := max(r.Версия, 1)
+		if v > latest[r.UserID] {
+			latest[r.UserID] = v
+		}
+	}
+	return latest, nil
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Все запросы к Sheets API идут через sheetsCall: классификация ошибок, повторы с экспоненциальной
+// задержкой и «предохранитель» (circuit breaker), который при сбоях Google сразу отвечает
+// ErrSheetsUnavailable, а не держит пользователя до таймаута обработчика.
+
+const (
+	sheetsMaxAttempts    = 5 // попыток на один вызов
+	sheetsBaseBackoff    = 500 * time.Millisecond
+	sheetsMaxBackoff     = 8 * time.Second  // потолок задержки между попытками
+	sheetsAttemptTimeout = 15 * time.Second // таймаут одной попытки (внутри ctx вызова)
+	sheetsFlightTimeout  = 45 * time.Second // таймаут общего чтения flightGroup (с повторами)
+
+	breakerThreshold = 5                // подряд неудачных вызовов до размыкания
+	breakerCooldown  = 30 * time.Second // сколько предохранитель разомкнут до пробного запроса
+)
+
+// ErrSheetsUnavailable — таблица временно недоступна (сбой или квота Google, разомкнут предохранитель).
+// Обработчики проверяют его через errors.Is и показывают sheetsErrText.
+var ErrSheetsUnavailable = errors.New("Google Sheets временно недоступен")
+
+// sheetsErrClass — класс ошибки Sheets API.
+type sheetsErrClass int
+
+const (
+	sheetsErrPermanent sheetsErrClass = iota // 4xx, неверный диапазон, нет доступа — повтор не поможет
+	sheetsErrQuota                           // 429: запрос не выполнен, повтор безопасен всегда
+	sheetsErrServer                          // 5xx, 408: запрос мог выполниться
+	sheetsErrNetwork                         // обрыв соединения или таймаут попытки: запрос мог выполниться
+)
+
+// classifySheetsError определяет класс ошибки. Отмена вызова (context.Canceled) — постоянная ошибка.
+func classifySheetsError(err error) sheetsErrClass {
+	if errors.Is(err, context.Canceled) {
+		return sheetsErrPermanent
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch {
+		case gerr.Code == http.StatusTooManyRequests:
+			return sheetsErrQuota
+		case gerr.Code == http.StatusRequestTimeout, gerr.Code >= 500:
+			return sheetsErrServer
+		}
+		return sheetsErrPermanent
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return sheetsErrNetwork
+	}
+	return sheetsErrPermanent
+}
+
+// retryable — можно ли повторить запрос. Неидемпотентные (append, batchUpdate) повторяются только
+// при 429: после 5xx или обрыва строка могла уже добавиться, повтор её задвоит.
+func (c sheetsErrClass) retryable(idempotent bool) bool {
+	switch c {
+	case sheetsErrQuota:
+		return true
+	case sheetsErrServer, sheetsErrNetwork:
+		return idempotent
+	}
+	return false
+}
+
+// backoffDelay — задержка перед попыткой attempt (с 1): base/2 плюс случайная часть до min(max, base·2^attempt),
+// но не меньше Retry-After, если Google его прислал.
+func backoffDelay(attempt int, err error) time.Duration {
+	ceil := sheetsBaseBackoff << attempt
+	if ceil > sheetsMaxBackoff || ceil <= 0 {
+		ceil = sheetsMaxBackoff
+	}
+	d := rand.N(ceil) + sheetsBaseBackoff/2
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Header != nil {
+		if sec, e := strconv.Atoi(gerr.Header.Get("Retry-After")); e == nil && time.Duration(sec)*time.Second > d {
+			d = time.Duration(sec) * time.Second
+		}
+	}
+	return d
+}
+
+// breaker — предохранитель: после breakerThreshold неудачных вызовов подряд размыкается на
+// breakerCooldown, затем пропускает один пробный вызов; успех замыкает его, ошибка — снова размыкает.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow сообщает, можно ли выполнять вызов; при отказе — через сколько будет пробный запрос.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold {
+		return true, 0
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return false, wait
+	}
+	if b.probing {
+		return false, breakerCooldown
+	}
+	b.probing = true
+	return true, 0
+}
+
+// release завершает вызов без учёта в предохранителе (вызывающий сам отменил его или не дождался):
+// снимает только отметку пробного вызова.
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// done учитывает итог вызова: failed — таблица недоступна (квота, 5xx, сеть после всех попыток).
+// tenant — метка серии bugchat_sheets_breaker_open.
+func (b *breaker) done(failed bool, tenant string, l *slog.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := b.failures >= breakerThreshold
+	b.probing = false
+	if !failed {
+		if wasOpen {
+			l.Warn("Sheets: предохранитель замкнут, таблица снова доступна")
+		}
+		b.failures = 0
+		mSheetsBreaker.SetTenant(tenant, "", 0)
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		mSheetsBreaker.SetTenant(tenant, "", 1)
+		if !wasOpen {
+			l.Warn("Sheets: предохранитель разомкнут", "failures", b.failures, "cooldown", breakerCooldown)
+		}
+	}
+}
+
+// sheetsCall выполняет fn с повторами и учётом предохранителя. op — метод для метрик и логов
+// (values.get, values.append…). Повторы прекращаются, если следующая задержка не укладывается
+// в дедлайн ctx; итоговая временная ошибка оборачивается в ErrSheetsUnavailable.
+func sheetsCall[T any](ctx context.Context, s *SheetsAPI, op string, idempotent bool, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	kind := sheetsOpKind(op)
+	if !s.budget.take(s.tenant, kind, isLowPriority(ctx)) {
+		return zero, fmt.Errorf("%s: %w", op, ErrSheetsDeferred)
+	}
+	if ok, wait := s.breaker.allow(); !ok {
+		return zero, fmt.Errorf("%s: %w (предохранитель разомкнут, пробный запрос через %s)", op, ErrSheetsUnavailable, wait.Round(time.Second))
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		actx, cancel := context.WithTimeout(ctx, sheetsAttemptTimeout)
+		var res T
+		res, err = fn(actx)
+		cancel()
+		if err == nil {
+			s.breaker.done(false, s.tenant, s.logger())
+			return res, nil
+		}
+		class := classifySheetsError(err)
+		if ctx.Err() != nil {
+			// Истёк дедлайн или отменён ctx вызывающего — о таблице это ничего не говорит: короткие
+			// дедлайны (проверки здоровья, обработчики) не должны размыкать предохранитель для всех.
+			s.breaker.release()
+			if class == sheetsErrPermanent {
+				return zero, err
+			}
+			return zero, fmt.Errorf("%s: %w: %w", op, ErrSheetsUnavailable, err)
+		}
+		if class == sheetsErrPermanent {
+			// Google ответил (или вызов отменён) — связь с таблицей есть, предохранитель не размыкаем.
+			s.breaker.done(false, s.tenant, s.logger())
+			return zero, err
+		}
+		if !class.retryable(idempotent) || attempt >= sheetsMaxAttempts || ctx.Err() != nil {
+			break
+		}
+		delay := backoffDelay(attempt, err)
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < delay+time.Second {
+			break
+		}
+		mSheetsRetries.IncTenant(s.tenant, op)
+		s.logger().Debug("Sheets: повтор", "op", op, "attempt", attempt, "delay", delay, "err", err)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+			s.budget.take(s.tenant, kind, false)
+			continue
+		case <-ctx.Done():
+			t.Stop()
+		}
+		break
+	}
+	if ctx.Err() != nil {
+		s.breaker.release()
+		return zero, fmt.Errorf("%s: %w: %w", op, ErrSheetsUnavailable, err)
+	}
+	s.breaker.done(true, s.tenant, s.logger())
+	return zero, fmt.Errorf("%s: %w: %w", op, ErrSheetsUnavailable, err)
+}
+
+// getValues читает диапазон (values.get). Одновременные чтения одного диапазона делят один запрос.
+func (s *SheetsAPI) getValues(ctx context.Context, rng string) (*sheets.ValueRange, error) {
+	v, err := s.flight.do(ctx, s.tenant, flightKey(ctx, "values.get", rng), func(ctx context.Context) (interface{}, error) {
+		return sheetsCall(ctx, s, "values.get", true, func(ctx context.Context) (*sheets.ValueRange, error) {
+			return s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rng).Context(ctx).Do()
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*sheets.ValueRange), nil
+}
+
+// getFormulas читает диапазон с формулами вместо вычисленных значений (values.get, FORMULA).
+// Нужен перед записью, которая не должна затереть формулы; с getValues не объединяется.
+func (s *SheetsAPI) getFormulas(ctx context.Context, rng string) (*sheets.ValueRange, error) {
+	return sheetsCall(ctx, s, "values.get", true, func(ctx context.Context) (*sheets.ValueRange, error) {
+		return s.svc.Spreadsheets.Values.Get(s.spreadsheetID, rng).ValueRenderOption("FORMULA").Context(ctx).Do()
+	})
+}
+
+// updateValues перезаписывает диапазон как есть (values.update, RAW). Повтор безопасен.
+func (s *SheetsAPI) updateValues(ctx context.Context, rng string, vr *sheets.ValueRange) error {
+	_, err := sheetsCall(ctx, s, "values.update", true, func(ctx context.Context) (*sheets.UpdateValuesResponse, error) {
+		return s.svc.Spreadsheets.Values.Update(s.spreadsheetID, rng, vr).ValueInputOption("RAW").Context(ctx).Do()
+	})
+	s.flight.forget(rangeSheet(rng))
+	return err
+}
+
+// batchUpdateValues перезаписывает несколько диапазонов одним запросом (values.batchUpdate, RAW).
+func (s *SheetsAPI) batchUpdateValues(ctx context.Context, data []*sheets.ValueRange) error {
+	_, err := sheetsCall(ctx, s, "values.batchUpdate", true, func(ctx context.Context) (*sheets.BatchUpdateValuesResponse, error) {
+		return s.svc.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+			ValueInputOption: "RAW",
+			Data:             data,
+		}).Context(ctx).Do()
+	})
+	for _, vr := range data {
+		s.flight.forget(rangeSheet(vr.Range))
+	}
+	return err
+}
+
+// appendValues добавляет строки в конец листа (values.append, INSERT_ROWS). inputOption — RAW или USER_ENTERED.
+func (s *SheetsAPI) appendValues(ctx context.Context, rng string, vr *sheets.ValueRange, inputOption string) error {
+	_, err := sheetsCall(ctx, s, "values.append", false, func(ctx context.Context) (*sheets.AppendValuesResponse, error) {
+		return s.svc.Spreadsheets.Values.Append(s.spreadsheetID, rng, vr).
+			ValueInputOption(inputOption).InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	})
+	s.flight.forget(rangeSheet(rng))
+	return err
+}
+
+// getSpreadsheet читает свойства таблицы; fields — маска полей ("" — всё). Одновременные запросы объединяются.
+func (s *SheetsAPI) getSpreadsheet(ctx context.Context, fields googleapi.Field) (*sheets.Spreadsheet, error) {
+	v, err := s.flight.do(ctx, s.tenant, flightKey(ctx, "spreadsheets.get", string(fields)), func(ctx context.Context) (interface{}, error) {
+		return sheetsCall(ctx, s, "spreadsheets.get", true, func(ctx context.Context) (*sheets.Spreadsheet, error) {
+			call := s.svc.Spreadsheets.Get(s.spreadsheetID).Context(ctx)
+			if fields != "" {
+				call = call.Fields(fields)
+			}
+			return call.Do()
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*sheets.Spreadsheet), nil
+}
+
+// batchUpdate выполняет структурные изменения (листы, удаление строк). Не идемпотентен.
+func (s *SheetsAPI) batchUpdate(ctx context.Context, reqs []*sheets.Request) error {
+	_, err := sheetsCall(ctx, s, "spreadsheets.batchUpdate", false, func(ctx context.Context) (*sheets.BatchUpdateSpreadsheetResponse, error) {
+		return s.svc.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: reqs}).Context(ctx).Do()
+	})
+	s.flight.forget("")
+	return err
+}
+
+// sheetsErrText — ответ пользователю на ошибку таблицы: при недоступности Google — общий текст
+// «сервис временно недоступен», иначе текст по ключу key.
+func sheetsErrText(t tr, err error, key string) string {
+	if errors.Is(err, ErrSheetsUnavailable) {
+		return t.T(keyСервисНедоступен)
+	}
+	return t.T(key)
+}
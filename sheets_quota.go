@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Экономия квоты Sheets API (по умолчанию Google даёт 60 запросов чтения и 60 записи в минуту
+// на сервисный аккаунт):
+//   - одинаковые одновременные чтения (values.get одного диапазона) объединяются в один запрос;
+//   - бюджет запросов в минуту: когда он почти израсходован, несрочные записи (логи, регистрация
+//     пользователей) откладываются, чтобы запросы пользователей не получали 429. Квота Google —
+//     на учётную запись, поэтому боты с одним ключом делят один бюджет.
+
+const (
+	sheetsDefaultPerMin  = 60 // бюджет запросов в минуту отдельно на чтение и на запись
+	sheetsLowPriorityPct = 80 // несрочные запросы — только пока израсходовано меньше 80% бюджета
+)
+
+// ErrSheetsDeferred — несрочный запрос не выполнен, потому что бюджет минуты почти исчерпан.
+// Вызывающий сохраняет данные и повторяет позже; на предохранитель не влияет.
+var ErrSheetsDeferred = errors.New("запрос к Sheets отложен: бюджет квоты почти исчерпан")
+
+type lowPriorityKey struct{}
+
+// lowPriority помечает запросы ctx как несрочные: при нехватке бюджета они получают ErrSheetsDeferred.
+func lowPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lowPriorityKey{}, true)
+}
+
+func isLowPriority(ctx context.Context) bool {
+	low, _ := ctx.Value(lowPriorityKey{}).(bool)
+	return low
+}
+
+// sheetsOpKind — квота, к которой относится метод: чтение или запись.
+func sheetsOpKind(op string) string {
+	if strings.HasSuffix(op, ".get") {
+		return "read"
+	}
+	return "write"
+}
+
+// sheetsBudget считает запросы к Sheets API за скользящую минуту отдельно для чтения и записи.
+type sheetsBudget struct {
+	mu      sync.Mutex
+	perMin  int // 0 — без ограничения
+	calls   map[string][]time.Time
+	tenants map[string]bool // боты, расходующие бюджет: датчик метрики обновляется у всех
+}
+
+var (
+	sheetsBudgetsMu sync.Mutex
+	sheetsBudgets   = make(map[string]*sheetsBudget)
+)
+
+// sharedSheetsBudget — бюджет учётной записи account (см. sheetsCredentials), общий для всех таблиц
+// процесса с этим ключом.
+func sharedSheetsBudget(account string) *sheetsBudget {
+	sheetsBudgetsMu.Lock()
+	defer sheetsBudgetsMu.Unlock()
+	b := sheetsBudgets[account]
+	if b == nil {
+		b = &sheetsBudget{perMin: sheetsDefaultPerMin}
+		sheetsBudgets[account] = b
+	}
+	return b
+}
+
+// take учитывает запрос вида kind бота tenant. Несрочный запрос (low) при израсходованных
+// sheetsLowPriorityPct% бюджета не учитывается и получает false; обычные учитываются всегда — их
+// ограничивает сам Google.
+func (b *sheetsBudget) take(tenant, kind string, low bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.calls == nil {
+		b.calls = make(map[string][]time.Time)
+		b.tenants = make(map[string]bool)
+	}
+	b.tenants[tenant] = true
+	now := time.Now()
+	list := b.calls[kind]
+	i := 0
+	for i < len(list) && now.Sub(list[i]) >= time.Minute {
+		i++
+	}
+	list = list[i:]
+	if low && b.perMin > 0 && len(list)*100 >= b.perMin*sheetsLowPriorityPct {
+		b.calls[kind] = list
+		return false
+	}
+	b.calls[kind] = append(list, now)
+	for t := range b.tenants {
+		mSheetsBudget.SetTenant(t, kind, float64(len(list)+1))
+	}
+	return true
+}
+
+// SetRequestsPerMin задаёт бюджет запросов в минуту (SHEETS_REQUESTS_PER_MIN); 0 — без ограничения.
+// У ботов с общим ключом действует значение, заданное последним.
+func (s *SheetsAPI) SetRequestsPerMin(n int) {
+	s.budget.mu.Lock()
+	s.budget.perMin = n
+	s.budget.mu.Unlock()
+}
+
+// flightGroup объединяет одновременные одинаковые запросы: первый выполняет запрос, остальные ждут
+// его результат (в том числе ошибку). Результат общий — его нельзя изменять.
+type flightGroup struct {
+	mu sync.Mutex
+	m  map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// do выполняет fn по ключу key или ждёт уже идущий запрос с тем же ключом; tenant — метка метрики
+// объединённых запросов.
+// Общий запрос не принадлежит никому из ждущих: fn получает ctx, отвязанный от отмены вызывающего
+// (значения ctx сохраняются), с таймаутом sheetsFlightTimeout — короткий дедлайн или отмена одного
+// вызывающего не должны достаться остальным. Каждый ждущий, в том числе первый, прекращает ждать
+// при отмене своего ctx; запрос при этом продолжается.
+func (g *flightGroup) do(ctx context.Context, tenant, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*flightCall)
+	}
+	c, ok := g.m[key]
+	if ok {
+		mSheetsCoalesced.IncTenant(tenant, key[:strings.IndexByte(key, '|')])
+	} else {
+		c = &flightCall{done: make(chan struct{})}
+		g.m[key] = c
+		go func() {
+			fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sheetsFlightTimeout)
+			defer cancel()
+			c.val, c.err = fn(fctx)
+			g.mu.Lock()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	g.mu.Unlock()
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forget отвязывает идущие чтения листа sheet ("" — всех листов): чтения, начатые после записи,
+// не должны получить результат запроса, отправленного до неё.
+func (g *flightGroup) forget(sheet string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key := range g.m {
+		if sheet == "" || strings.Contains(key, "|"+sheet+"!") {
+			delete(g.m, key)
+		}
+	}
+}
+
+// flightKey — ключ объединения: метод, диапазон и приоритет (несрочное чтение может быть отложено,
+// поэтому с обычным не объединяется).
+func flightKey(ctx context.Context, op, rng string) string {
+	if isLowPriority(ctx) {
+		return op + "|" + rng + "|low"
+	}
+	return op + "|" + rng + "|"
+}
+
+// rangeSheet — имя листа из диапазона "Лист!A1:B2".
+func rangeSheet(rng string) string {
+	if i := strings.IndexByte(rng, '!'); i >= 0 {
+		return rng[:i]
+	}
+	return rng
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	statsDefaultDays = 30 // период /stats по умолчанию
+	statsTop         = 10 // строк в топах документов и категорий
+)
+
+// recordDownloads записывает попытки скачивания в «Скачивания». Ошибки записи только логируются.
+func recordDownloads(ctx context.Context, app *App, recs ...DownloadRecord) {
+	if len(recs) == 0 || recs[0].UserID == 0 {
+		return
+	}
+	if err := app.Sheets.AppendDownloads(ctx, recs); err != nil {
+		app.Log.Error("AppendDownloads", "err", err)
+	}
+}
+
+// statCount — строка топа: ключ (ID документа или категории) и число скачиваний.
+type statCount struct {
+	Key   string
+	Count int
+}
+
+// topCounts сортирует счётчики по убыванию и обрезает до n.
+func topCounts(m map[string]int, n int) []statCount {
+	list := make([]statCount, 0, len(m))
+	for k, v := range m {
+		list = append(list, statCount{k, v})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// percent — доля part от total в процентах, строкой «12.5%».
+func percent(part, total int) string {
+	if total == 0 {
+		return "—"
+	}
+	return strconv.FormatFloat(float64(part)*100/float64(total), 'f', 1, 64) + "%"
+}
+
+// formatBytes — размер в КБ/МБ/ГБ для отчётов; единицы — текст keyЕдиницыРазмера на языке t.
+func formatBytes(t tr, n int64) string {
+	units := strings.Fields(t.T(keyЕдиницыРазмера))
+	if len(units) < 5 {
+		units = strings.Fields(builtinTexts[keyЕдиницыРазмера])
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d %s", n, units[0])
+	}
+	div, exp := int64(unit), 1
+	for m := n / unit; m >= unit && exp < len(units)-1; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %s", float64(n)/float64(div), units[exp])
+}
+
+// buildStats собирает отчёт /stats по записям «Скачивания» за days дней.
+// Топ документов — успешные скачивания по одному и в составе архивов; топ категорий — успешные
+// одиночные скачивания и архивы «Скачать все». Активные пользователи — любые попытки. Текст — на языке t.
+func buildStats(t tr, recs []DownloadRecord, docs []Document, cats []Category, days int, now time.Time) string {
+	docNames := make(map[string]string)
+	for _, d := range docs {
+		docNames[d.ID] = d.Название
+	}
+	catNames := make(map[string]string)
+	for _, cat := range cats {
+		catNames[cat.ID] = cat.Name
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := today.AddDate(0, 0, -days+1)
+	weekStart := today.AddDate(0, 0, -6)
+
+	byDoc := make(map[string]int)
+	byCat := make(map[string]int)
+	periodUsers := make(map[int64]bool)
+	weekUsers := make(map[int64]bool)
+	dayUsers := make(map[string]map[int64]bool)
+	var single, singleOK, singleCached, singleLink, archives, archivesOK int
+	var bytes int64
+	for _, r := range recs {
+		if !r.Дата.Before(weekStart) {
+			weekUsers[r.UserID] = true
+			day := r.Дата.Format("02.01")
+			if dayUsers[day] == nil {
+				dayUsers[day] = make(map[int64]bool)
+			}
+			dayUsers[day][r.UserID] = true
+		}
+		if r.Дата.Before(since) {
+			continue
+		}
+		periodUsers[r.UserID] = true
+		ok := r.Результат == dlOK
+		switch r.Тип {
+		case dlSingle:
+			single++
+			if r.Результат == dlLink {
+				singleLink++
+			}
+			if ok {
+				singleOK++
+				if r.Кэш {
+					singleCached++
+				}
+			}
+		case dlArchive:
+			archives++
+			if ok {
+				archivesOK++
+			}
+		}
+		if !ok {
+			continue
+		}
+		bytes += r.Байты
+		if r.DocID != "" {
+			byDoc[r.DocID]++
+		}
+		if r.Тип != dlBulk && r.CategoryID != "" {
+			byCat[r.CategoryID]++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(t.T(keyСтатЗаголовок, "{дней}", strconv.Itoa(days)) + "\n\n")
+	b.WriteString(t.T(keyСтатИтоги,
+		"{документов}", strconv.Itoa(singleOK), "{кэш}", percent(singleCached, singleOK),
+		"{архивов}", strconv.Itoa(archivesOK), "{объём}", formatBytes(t, bytes),
+		"{ошибки_документов}", percent(single-singleOK-singleLink, single),
+		"{ошибки_архивов}", percent(archives-archivesOK, archives), "{ссылкой}", percent(singleLink, single)) + "\n")
+
+	b.WriteString("\n" + t.T(keyСтатТопДокументов) + "\n")
+	top := topCounts(byDoc, statsTop)
+	if len(top) == 0 {
+		b.WriteString("—\n")
+	}
+	for i, s := range top {
+		name := docNames[s.Key]
+		if name == "" {
+			name = t.T(keyСтатДокументУдалён, "{id}", s.Key)
+		}
+		fmt.Fprintf(&b, "%d. %s — %d\n", i+1, html.EscapeString(name), s.Count)
+	}
+
+	b.WriteString("\n" + t.T(keyСтатТопКатегорий) + "\n")
+	top = topCounts(byCat, statsTop)
+	if len(top) == 0 {
+		b.WriteString("—\n")
+	}
+	for i, s := range top {
+		name := catNames[s.Key]
+		if name == "" {
+			name = t.T(keyСтатКатегорияУдалена, "{id}", s.Key)
+		}
+		fmt.Fprintf(&b, "%d. %s — %d\n", i+1, html.EscapeString(name), s.Count)
+	}
+
+	b.WriteString("\n" + t.T(keyСтатПользователи, "{период}", strconv.Itoa(len(periodUsers)), "{неделя}", strconv.Itoa(len(weekUsers))) + "\n")
+	for d := weekStart; !d.After(today); d = d.AddDate(0, 0, 1) {
+		day := d.Format("02.01")
+		fmt.Fprintf(&b, "%s — %d\n", day, len(dayUsers[day]))
+	}
+	return b.String()
+}
+
+// onStats — /stats [дней]: статистика скачиваний из листа «Скачивания».
+func onStats(c tele.Context, app *App) error {
+	t := trFor(c, app)
+	days := statsDefaultDays
+	if arg := strings.TrimSpace(strings.TrimPrefix(c.Text(), "/stats")); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return c.Send(t.T(keyСтатИспользование))
+		}
+		days = n
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), app.GetConfig().Timeouts.Long)
+	defer cancel()
+	recs, err := app.Sheets.GetDownloads(ctx)
+	if err != nil {
+		logFor(c, app).Error("GetDownloads /stats", "err", err)
+		return c.Send(sheetsErrText(t, err, keyОшибкаСтатистики))
+	}
+	docs, err := app.Sheets.GetDocuments(ctx)
+	if err != nil {
+		logFor(c, app).Error("GetDocuments /stats", "err", err)
+	}
+	cats, _ := app.GetCategories()
+	return c.Send(buildStats(t, recs, docs, cats, days, time.Now()), tele.ModeHTML)
+}
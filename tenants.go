@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Несколько ботов в одном процессе: основной и дополнительные из [tenants.<имя>] (см. config.go).
+// У каждого бота своя таблица с текстами, свои кэш, FSM, загрузчик Яндекс.Диска, пользователи и листы
+// логов; общие — очередь скачиваний (downloadPool), очистка временного каталога, HTTP-сервер,
+// stderr и LOG_FILE (записи дополнительных ботов — с атрибутом tenant).
+
+// tenant — запущенный бот процесса.
+type tenant struct {
+	live      *liveConfig
+	app       *App
+	bot       *tele.Bot
+	users     *userIndex
+	sheetsLog *sheetsLog
+	health    *healthChecker
+	log       *slog.Logger
+}
+
+// startTenant готовит бота cfg к работе: схема таблицы, кэш, обработчики и фоновые задачи бота.
+// Приём апдейтов запускает run. tenants — дополнительные боты при запуске (для отчёта о перезагрузке).
+func startTenant(ctx context.Context, cfg *Config, api *SheetsAPI, tenants []string, lc *logControl, pool *downloadPool) (*tenant, error) {
+	logger, sl := lc.withSheets(cfg, api)
+	api.SetLogger(logger)
+	api.SetTenant(cfg.Tenant)
+
+	// EnsureSchema с таймаутом; временные ошибки Sheets повторяет sheetsCall (сеть может быть нестабильна)
+	ensureCtx, ensureCancel := context.WithTimeout(ctx, cfg.Timeouts.Startup)
+	defer ensureCancel()
+	schemaErr := api.EnsureSchema(ensureCtx)
+	if schemaErr != nil {
+		logger.Warn("EnsureSchema failed (будет повтор при следующем запросе)", "err", schemaErr)
+		// Не падаем, бот может работать без EnsureSchema (если схема уже создана)
+	}
+
+	cache := newCache(api, cfg.CacheTTLMin)
+	cache.reload(ctx)
+
+	users := newUserIndex(api)
+	if err := users.Load(ctx); err != nil {
+		logger.Warn("Пользователи: индекс не загружен, новые визиты запишутся позже", "err", err)
+	}
+
+	yd := NewYandexDownloader(cfg.YandexMaxMB * 1024 * 1024)
+
+	fsm := newFSM()
+
+	var app *App
+	// Перезагрузка конфигурации: новые значения — работающим компонентам, затем тексты и кэш заново.
+	live := newLiveConfig(cfg, tenants, func(next *Config) {
+		cache.setTTL(next.CacheTTLMin)
+		yd.SetMaxSize(next.YandexMaxMB * 1024 * 1024)
+		api.SetRequestsPerMin(next.SheetsPerMin)
+		lc.apply(next)
+		sl.apply(next)
+		app.OnReload()
+	})
+
+	app = &App{
+		Sheets:       api,
+		Yandex:       yd,
+		Downloads:    pool,
+		GetConfig:    live.Get,
+		ReloadConfig: live.Reload,
+		Texts:        cache.getTexts,
+		GetCategories: func() ([]Category, error) {
+			return cache.getCategories(ctx)
+		},
+		GetRole: func(chatID int64, username string) Role {
+			return cache.role(chatID, username)
+		},
+		GetUserTags: cache.userTags,
+		GetState:    fsm.get,
+		SetState:    fsm.set,
+		ResetState:  fsm.reset,
+		GetData:     fsm.getData,
+		SetData:     fsm.setData,
+		Log:         logger,
+		Users:       users,
+		OnReload: func() {
+			api.ResetColumns()
+			cache.reload(ctx)
+			if err := users.Load(ctx); err != nil {
+				logger.Error("Пользователи: перечитывание", "err", err)
+			}
+		},
+		OnGrantsChanged: func() {
+			cache.reloadGrants(ctx)
+		},
+	}
+
+	bot, err := newBot(cfg, &tele.LongPoller{Timeout: 10 * time.Second})
+	if err != nil {
+		sl.Close(ctx)
+		return nil, fmt.Errorf("telebot: %w", err)
+	}
+	RegisterHandlers(bot, app)
+
+	health := newHealthChecker(bot, api, func() (time.Duration, bool) {
+		cache.ensure(ctx)
+		return cache.age()
+	}, live.Get)
+	health.SetSchemaValidated(schemaErr)
+
+	return &tenant{live: live, app: app, bot: bot, users: users, sheetsLog: sl, health: health, log: logger}, nil
+}
+
+// run запускает фоновые задачи бота и приём апдейтов. Вызывать в горутине.
+func (t *tenant) run() {
+	cfg := t.live.Get()
+	go StartIMOStatusPoller(t.bot, t.app)
+	go StartUserWriter(t.users)
+	if cfg.BackupDir != "" {
+		go StartBackupWorker(t.app.Sheets, cfg.BackupDir, cfg.BackupInterval, cfg.BackupKeep)
+	}
+	t.bot.Start()
+}
+
+// reload перечитывает конфигурацию бота (SIGHUP) и пишет итог в его лог.
+func (t *tenant) reload() {
+	changes, err := t.live.Reload()
+	if err != nil {
+		t.log.Error("SIGHUP: конфигурация не перечитана, действует прежняя", "err", err)
+		return
+	}
+	applied, pending := changedKeys(changes)
+	t.log.Info("SIGHUP: конфигурация перечитана", "applied", applied, "restart_required", pending)
+}
+
+// stop останавливает приём апдейтов и дописывает накопленное: пользователей и логи в таблицу.
+func (t *tenant) stop(ctx context.Context) {
+	t.bot.Stop()
+	if err := t.users.Flush(ctx); err != nil {
+		t.log.Error("Пользователи: запись при остановке", "err", err)
+	}
+	t.sheetsLog.Close(ctx)
+}
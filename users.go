@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	tele "gopkg.in/telebot.v3"
+)
+
+// Индекс пользователей в памяти: загружается из «Пользователи» при старте, обновляется при каждом
+// апдейте (usersMiddleware) без запросов к таблице и раз в usersFlushInterval пишется пачкой:
+// новые пользователи — одним append, изменённые профили и «Последний_Визит» — одним values.batchUpdate.
+
+const usersFlushInterval = time.Minute
+
+// userEntry — пользователь в индексе и что из него ещё не записано в таблицу.
+type userEntry struct {
+	p       UserProfile
+	isNew   bool // строки в листе ещё нет
+	profile bool // изменились юзернейм, имя, фамилия, язык или язык бота
+	seen    bool // изменился Последний_Визит
+}
+
+func (e *userEntry) dirty() bool { return e.isNew || e.profile || e.seen }
+
+type userIndex struct {
+	api *SheetsAPI
+
+	mu    sync.Mutex
+	users map[int64]*userEntry
+}
+
+func newUserIndex(api *SheetsAPI) *userIndex {
+	return &userIndex{api: api, users: make(map[int64]*userEntry)}
+}
+
+// Load перечитывает лист. Ещё не записанные изменения сохраняются поверх прочитанного.
+func (x *userIndex) Load(ctx context.Context) error {
+	list, err := x.api.GetUsers(ctx)
+	if err != nil {
+		return err
+	}
+	users := make(map[int64]*userEntry, len(list))
+	for _, p := range list {
+		users[p.ID] = &userEntry{p: p}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for id, e := range x.users {
+		if !e.dirty() {
+			continue
+		}
+		if old, ok := users[id]; ok {
+			e.isNew = false
+			if e.p.Registered == "" {
+				e.p.Registered = old.p.Registered
+			}
+		}
+		users[id] = e
+	}
+	x.users = users
+	return nil
+}
+
+// Touch регистрирует пользователя или обновляет его профиль и время визита. Только память, O(1).
+func (x *userIndex) Touch(u *tele.User) {
+	if u == nil || u.IsBot || u.ID == 0 {
+		return
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e, ok := x.users[u.ID]
+	if !ok {
+		e = &userEntry{p: UserProfile{ID: u.ID, Registered: now}, isNew: true}
+		x.users[u.ID] = e
+	}
+	if e.p.Username != u.Username || e.p.FirstName != u.FirstName || e.p.LastName != u.LastName || e.p.Lang != u.LanguageCode {
+		e.p.Username, e.p.FirstName, e.p.LastName, e.p.Lang = u.Username, u.FirstName, u.LastName, u.LanguageCode
+		e.profile = true
+	}
+	e.p.LastSeen = now
+	e.seen = true
+}
+
+// Lang — язык, выбранный /lang, и последний language_code из Telegram; ok == false — пользователь неизвестен.
+func (x *userIndex) Lang(id int64) (bot, tg string, ok bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e, ok := x.users[id]
+	if !ok {
+		return "", "", false
+	}
+	return e.p.BotLang, e.p.Lang, true
+}
+
+// SetBotLang запоминает язык, выбранный /lang ("" — как в Telegram); в таблицу попадёт со следующей записью.
+func (x *userIndex) SetBotLang(id int64, lang string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.users[id]; ok && e.p.BotLang != lang {
+		e.p.BotLang = lang
+		e.profile = true
+	}
+}
+
+// IDs — ID всех известных пользователей (для рассылки), по возрастанию.
+func (x *userIndex) IDs() []int64 {
+	x.mu.Lock()
+	ids := make([]int64, 0, len(x.users))
+	for id := range x.users {
+		ids = append(ids, id)
+	}
+	x.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Flush записывает накопленные изменения. Строки сверяются по колонке A перед записью; пользователь,
+// чью строку удалили вручную, дописывается заново. При ошибке изменения остаются до следующего раза;
+// несрочный ctx (lowPriority) при нехватке бюджета квоты — не ошибка.
+func (x *userIndex) Flush(ctx context.Context) error {
+	x.mu.Lock()
+	var batch []userEntry
+	for _, e := range x.users {
+		if e.dirty() {
+			batch = append(batch, *e)
+			e.isNew, e.profile, e.seen = false, false, false
+		}
+	}
+	x.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	err := x.write(ctx, batch)
+	if err != nil {
+		x.restore(batch)
+		if errors.Is(err, ErrSheetsDeferred) {
+			mSheetsDeferred.AddTenant(x.api.tenant, "user", float64(len(batch)))
+			return nil
+		}
+	}
+	return err
+}
+
+func (x *userIndex) write(ctx context.Context, batch []userEntry) error {
+	rows, err := x.api.GetUserRows(ctx)
+	if err != nil {
+		return err
+	}
+	var added []UserProfile
+	var updates []userUpdate
+	for _, e := range batch {
+		row, ok := rows[e.p.ID]
+		if !ok {
+			added = append(added, e.p)
+			continue
+		}
+		updates = append(updates, userUpdate{Row: row, Profile: e.profile || e.isNew, User: e.p})
+	}
+	if len(added) > 0 {
+		sort.Slice(added, func(i, j int) bool { return added[i].Registered < added[j].Registered })
+		if err := x.api.AppendUsers(ctx, added); err != nil {
+			return err
+		}
+	}
+	return x.api.UpdateUsers(ctx, updates)
+}
+
+// restore возвращает флаги несохранённых изменений.
+func (x *userIndex) restore(batch []userEntry) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, b := range batch {
+		if e, ok := x.users[b.p.ID]; ok {
+			e.isNew = e.isNew || b.isNew
+			e.profile = e.profile || b.profile
+			e.seen = e.seen || b.seen
+		}
+	}
+}
+
+// StartUserWriter раз в usersFlushInterval записывает изменения индекса (несрочно). Вызывать в горутине.
+func StartUserWriter(x *userIndex) {
+	ticker := time.NewTicker(usersFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(lowPriority(context.Background()), time.Minute)
+		if err := x.Flush(ctx); err != nil {
+			x.api.logger().Error("Пользователи: запись", "err", err)
+		}
+		cancel()
+	}
+}
+
+// usersMiddleware регистрирует автора любого апдейта: сообщения, кнопки, файлы.
+func usersMiddleware(app *App) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			if app.Users != nil {
+				app.Users.Touch(c.Sender())
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Минимальные чтение и запись XLSX (Office Open XML) без внешних библиотек — для -import / -export.
+// Пишется одна вкладка со строковыми ячейками (inlineStr); читаются строки, общие строки, числа и
+// логические значения. Формулы читаются как сохранённый результат, даты — как число Excel.
+
+const (
+	xlsxNSMain = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxNSRel  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	xlsxMaxTab = 31 // Excel ограничивает имя вкладки 31 символом
+)
+
+// writeXLSX пишет grid одной вкладкой tab.
+func writeXLSX(w io.Writer, tab string, grid [][]string) error {
+	if r := []rune(tab); len(r) > xlsxMaxTab {
+		tab = string(r[:xlsxMaxTab])
+	}
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header + `<worksheet xmlns="` + xlsxNSMain + `"><sheetData>`)
+	for i, row := range grid {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, colToLetter(j+1), i+1)
+			if err := xml.EscapeText(&sheet, []byte(xlsxClean(v))); err != nil {
+				return err
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var tabName bytes.Buffer
+	_ = xml.EscapeText(&tabName, []byte(tab))
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + xlsxNSRel + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="` + xlsxNSMain + `" xmlns:r="` + xlsxNSRel + `"><sheets>` +
+			`<sheet name="` + tabName.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + xlsxNSRel + `/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xlsxClean убирает управляющие символы, недопустимые в XML (кроме табуляции и переводов строки).
+func xlsxClean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// XML-структуры для чтения.
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSST struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheetData struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX читает вкладку tab (если её нет — первую) в grid.
+func readXLSX(data []byte, tab string) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("не XLSX: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	var wb xlsxWorkbook
+	if err := xlsxDecode(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, fmt.Errorf("в книге нет вкладок")
+	}
+	var rels xlsxRels
+	if err := xlsxDecode(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	pick := wb.Sheets[0]
+	for _, s := range wb.Sheets {
+		if s.Name == tab {
+			pick = s
+		}
+	}
+	target := ""
+	for _, r := range rels.Rels {
+		if r.ID == pick.RID {
+			target = r.Target
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("вкладка %q: не найден файл листа", pick.Name)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var sst xlsxSST
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := xlsxDecode(files, "xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+	var sd xlsxSheetData
+	if err := xlsxDecode(files, target, &sd); err != nil {
+		return nil, err
+	}
+	var grid [][]string
+	for i, row := range sd.Rows {
+		r := row.R
+		if r == 0 {
+			r = i + 1
+		}
+		for len(grid) < r {
+			grid = append(grid, nil)
+		}
+		line := grid[r-1]
+		for j, c := range row.Cells {
+			col := j
+			if c.Ref != "" {
+				col = xlsxColIndex(c.Ref)
+			}
+			if col < 0 {
+				return nil, fmt.Errorf("ячейка %q: неверный адрес", c.Ref)
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(sst.Items) {
+					return nil, fmt.Errorf("ячейка %s: неверная ссылка на общую строку", c.Ref)
+				}
+				v = sst.Items[n].String()
+			case "inlineStr":
+				v = c.Inline.String()
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			default:
+				v = c.Value
+			}
+			for len(line) <= col {
+				line = append(line, "")
+			}
+			line[col] = v
+		}
+		grid[r-1] = line
+	}
+	return grid, nil
+}
+
+func xlsxDecode(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("в XLSX нет %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// xlsxColIndex — номер колонки (с 0) из адреса ячейки «BC12»; -1 — адрес неверный.
+func xlsxColIndex(ref string) int {
+	n := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		n = n*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 {
+		return -1
+	}
+	return n - 1
+}
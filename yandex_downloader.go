@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,12 +25,12 @@ var (
 // YandexDownloader получает прямую ссылку и скачивает файлы с Яндекс.Диска.
 type YandexDownloader struct {
 	client  *http.Client
-	maxSize int64
+	maxSize atomic.Int64 // меняется при перезагрузке конфигурации (SetMaxSize)
 }
 
 // NewYandexDownloader создаёт загрузчик с лимитом размера в байтах.
 func NewYandexDownloader(maxSizeBytes int64) *YandexDownloader {
-	return &YandexDownloader{
+	y := &YandexDownloader{
 		client: &http.Client{
 			Timeout: 120 * time.Second,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -38,8 +40,14 @@ func NewYandexDownloader(maxSizeBytes int64) *YandexDownloader {
 				return nil
 			},
 		},
-		maxSize: maxSizeBytes,
 	}
+	y.maxSize.Store(maxSizeBytes)
+	return y
+}
+
+// SetMaxSize меняет лимит размера в байтах для следующих скачиваний.
+func (y *YandexDownloader) SetMaxSize(maxSizeBytes int64) {
+	y.maxSize.Store(maxSizeBytes)
 }
 
 // isYandexDiskURL возвращает true, если ссылка ведёт на disk.yandex.
@@ -50,37 +58,66 @@ func isYandexDiskURL(s string) bool {
 // reDirectURL ищет ссылку на downloader.disk.yandex в HTML/тексте.
 var reDirectURL = regexp.MustCompile(`https://downloader\.disk\.yandex\.[a-z.]+/disk/[^"'\s<>]+`)
 
-// GetFileSize возвращает размер файла в байтах по публичной ссылке Яндекс.Диска.
-// Для не-Яндекс URL возвращает ErrNotYandexDisk. Если Content-Length неизвестен, возвращает -1, nil.
-func (y *YandexDownloader) GetFileSize(ctx context.Context, shareURL string) (int64, error) {
+// YandexFileInfo — сведения о файле по HEAD, без скачивания.
+type YandexFileInfo struct {
+	Size int64  // байты; -1, если Content-Length неизвестен
+	Name string // имя из Content-Disposition или "document"
+	MIME string // Content-Type без параметров
+}
+
+// GetFileInfo возвращает размер, имя и тип файла по публичной ссылке Яндекс.Диска.
+// Для не-Яндекс URL возвращает ErrNotYandexDisk.
+func (y *YandexDownloader) GetFileInfo(ctx context.Context, shareURL string) (YandexFileInfo, error) {
 	shareURL = strings.TrimSpace(shareURL)
 	if shareURL == "" {
-		return 0, fmt.Errorf("пустая ссылка")
+		return YandexFileInfo{}, fmt.Errorf("пустая ссылка")
 	}
 	if !isYandexDiskURL(shareURL) {
-		return 0, ErrNotYandexDisk
+		return YandexFileInfo{}, ErrNotYandexDisk
 	}
 	direct, err := y.GetDirectURL(ctx, shareURL)
 	if err != nil {
-		return 0, err
+		return YandexFileInfo{}, err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodHead, direct, nil)
 	if err != nil {
-		return 0, err
+		return YandexFileInfo{}, err
 	}
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; rv:109.0) Gecko/20100101 Firefox/119.0")
 	resp, err := y.client.Do(req)
 	if err != nil {
-		return 0, err
+		return YandexFileInfo{}, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
-		return 0, fmt.Errorf("HEAD %s: %d", direct, resp.StatusCode)
+		return YandexFileInfo{}, fmt.Errorf("HEAD %s: %d", direct, resp.StatusCode)
 	}
+	info := YandexFileInfo{Size: -1, Name: headerFilename(resp.Header)}
 	if resp.ContentLength >= 0 {
-		return resp.ContentLength, nil
+		info.Size = resp.ContentLength
 	}
-	return -1, nil
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		if t, _, err := mime.ParseMediaType(ct); err == nil {
+			info.MIME = t
+		}
+	}
+	return info, nil
+}
+
+// headerFilename — имя файла из Content-Disposition; без него — "document".
+func headerFilename(h http.Header) string {
+	if cd := h.Get("Content-Disposition"); cd != "" {
+		if i := strings.Index(cd, "filename="); i >= 0 {
+			s := strings.Trim(cd[i+9:], " \"'")
+			if end := strings.IndexAny(s, "; \t\n"); end > 0 {
+				s = s[:end]
+			}
+			if s != "" {
+				return s
+			}
+		}
+	}
+	return "document"
 }
 
 // GetDirectURL возвращает прямую ссылку на скачивание. Для Yandex Диска — URL downloader.disk.yandex; для остальных — исходный URL.
@@ -172,11 +209,13 @@ func (y *YandexDownloader) DownloadToFile(ctx context.Context, shareURL, destPat
 		return 0, err
 	}
 	defer f.Close()
-	n, err := io.Copy(f, io.LimitReader(resp.Body, y.maxSize+1))
+	limit := y.maxSize.Load()
+	n, err := io.Copy(f, io.LimitReader(resp.Body, limit+1))
+	mYandexBytes.Add("", float64(n))
 	if err != nil {
 		return 0, err
 	}
-	if n > y.maxSize {
+	if n > limit {
 		return 0, ErrFileTooLarge
 	}
 	return n, nil
@@ -238,23 +277,13 @@ func (y *YandexDownloader) downloadByURL(ctx context.Context, downloadURL string
 		return nil, "", fmt.Errorf("HEAD %s: %d", downloadURL, resp.StatusCode)
 	}
 
+	limit := y.maxSize.Load()
 	size := resp.ContentLength
-	if size > 0 && size > y.maxSize {
+	if size > 0 && size > limit {
 		return nil, "", ErrFileTooLarge
 	}
 
-	filename := "document"
-	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
-		if i := strings.Index(cd, "filename="); i >= 0 {
-			s := strings.Trim(cd[i+9:], " \"'")
-			if end := strings.IndexAny(s, "; \t\n"); end > 0 {
-				s = s[:end]
-			}
-			if s != "" {
-				filename = s
-			}
-		}
-	}
+	filename := headerFilename(resp.Header)
 
 	reqGet, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
 	if err != nil {
@@ -273,16 +302,16 @@ func (y *YandexDownloader) downloadByURL(ctx context.Context, downloadURL string
 	}
 
 	// Ограничение по размеру при чтении.
-	limit := y.maxSize
 	if respGet.ContentLength > 0 && respGet.ContentLength > limit {
 		return nil, "", ErrFileTooLarge
 	}
 	r := io.LimitReader(respGet.Body, limit+1)
 	data, err := io.ReadAll(r)
+	mYandexBytes.Add("", float64(len(data)))
 	if err != nil {
 		return nil, "", err
 	}
-	if int64(len(data)) > y.maxSize {
+	if int64(len(data)) > limit {
 		return nil, "", ErrFileTooLarge
 	}
 	return data, filename, nil